@@ -0,0 +1,322 @@
+// Package agent keeps a certificate, its key and a trust bundle fresh on
+// disk for programs that don't link the transport package. After each
+// rotation it can run a command or signal a process so the program picks
+// up the new files, and it reports its state over a local socket.
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/transport"
+	"github.com/cloudflare/cfssl/transport/kp"
+)
+
+// DefaultRootsRefresh is how often the trusted roots are reloaded if
+// Options.RootsRefresh isn't set.
+const DefaultRootsRefresh = time.Hour
+
+// Options controls what the agent does after each rotation.
+type Options struct {
+	// BundleFile, if set, receives the transport's trusted roots
+	// as PEM.
+	BundleFile string
+
+	// RootsRefresh is how often Run reloads the trusted roots. When
+	// they change, the bundle is rewritten and the consumer notified.
+	RootsRefresh time.Duration
+
+	// Command, if set, is run with "sh -c".
+	Command string
+
+	// PIDFile and Signal, if set, name a process to signal.
+	PIDFile string
+	Signal  os.Signal
+}
+
+// Status describes the agent's certificate and its last rotation.
+type Status struct {
+	Healthy       bool      `json:"healthy"`
+	Serial        string    `json:"serial_number,omitempty"`
+	NotBefore     time.Time `json:"not_before,omitempty"`
+	NotAfter      time.Time `json:"not_after,omitempty"`
+	Rotations     int       `json:"rotations"`
+	LastRotation  time.Time `json:"last_rotation,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitempty"`
+}
+
+// An Agent renews the certificate of a transport and publishes it.
+type Agent struct {
+	tr   *transport.Transport
+	opts Options
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns an agent for tr. The transport's key provider must store
+// its key and certificate on disk.
+func New(tr *transport.Transport, opts Options) (*Agent, error) {
+	if !tr.Provider.Persistent() {
+		return nil, errors.New("agent: the identity must set key and certificate paths")
+	}
+	if (opts.PIDFile == "") != (opts.Signal == nil) {
+		return nil, errors.New("agent: a PID file and a signal must be given together")
+	}
+	return &Agent{tr: tr, opts: opts}, nil
+}
+
+// Refresh renews the certificate if it is due and publishes it if it
+// changed.
+func (a *Agent) Refresh() error {
+	before := a.serial()
+	if err := a.tr.RefreshKeys(); err != nil {
+		a.failed(err)
+		return err
+	}
+	if a.serial() != before {
+		return a.rotated()
+	}
+	a.update(false)
+	return nil
+}
+
+// Run loads or obtains the certificate and writes the bundle, then keeps
+// both fresh until an unrecoverable error occurs. Failed renewals are
+// retried with backoff.
+func (a *Agent) Run() error {
+	if err := a.start(); err != nil {
+		return err
+	}
+
+	updates := make(chan time.Time)
+	errs := make(chan error)
+	go a.tr.AutoUpdate(updates, errs)
+
+	interval := a.opts.RootsRefresh
+	if interval <= 0 {
+		interval = DefaultRootsRefresh
+	}
+	rootChanges := make(chan time.Time)
+	rootErrs := make(chan error)
+	go a.tr.TrustStore.AutoRefresh(interval, nil, rootChanges, rootErrs)
+
+	for {
+		select {
+		case <-updates:
+			if err := a.rotated(); err != nil {
+				log.Errorf("agent: failed to publish certificate: %v", err)
+			}
+		case err := <-errs:
+			log.Warningf("agent: failed to renew certificate: %v", err)
+			a.failed(err)
+		case <-rootChanges:
+			if err := a.RefreshRoots(); err != nil {
+				log.Errorf("agent: failed to publish trusted roots: %v", err)
+			}
+		case err := <-rootErrs:
+			log.Warningf("agent: failed to reload trusted roots: %v", err)
+			a.failed(err)
+		}
+	}
+}
+
+// start loads or obtains the certificate and writes the bundle.
+func (a *Agent) start() error {
+	// A certificate left on disk by an earlier run doesn't count
+	// as a rotation.
+	if !a.tr.Provider.Ready() {
+		if err := a.tr.Provider.Load(); err != nil {
+			if !os.IsNotExist(err) && err != kp.ErrCertificateUnavailable {
+				return err
+			}
+			log.Infof("agent: no certificate on disk yet: %v", err)
+		}
+	}
+	if err := a.Refresh(); err != nil {
+		return err
+	}
+	// Without a rotation, the bundle left by an earlier run may be
+	// missing or stale.
+	if _, err := a.writeBundle(); err != nil {
+		a.failed(err)
+		return err
+	}
+	return nil
+}
+
+// RefreshRoots rewrites the bundle with the transport's trusted roots and
+// notifies the consumer if it changed.
+func (a *Agent) RefreshRoots() error {
+	changed, err := a.writeBundle()
+	if err != nil {
+		a.failed(err)
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	log.Info("agent: trusted roots changed")
+	if err = a.notify(); err != nil {
+		a.failed(err)
+		return err
+	}
+	return nil
+}
+
+func (a *Agent) serial() string {
+	cert := a.tr.Provider.Certificate()
+	if cert == nil {
+		return ""
+	}
+	return cert.SerialNumber.String()
+}
+
+// rotated writes the bundle and notifies the consumer of the new
+// certificate.
+func (a *Agent) rotated() error {
+	log.Infof("agent: certificate %s issued", a.serial())
+	a.update(true)
+
+	if _, err := a.writeBundle(); err != nil {
+		a.failed(err)
+		return err
+	}
+
+	if err := a.notify(); err != nil {
+		a.failed(err)
+		return err
+	}
+	return nil
+}
+
+// writeBundle writes the trusted roots to the bundle file, if one is set,
+// and reports whether its contents changed.
+func (a *Agent) writeBundle() (bool, error) {
+	if a.opts.BundleFile == "" {
+		return false, nil
+	}
+
+	// The roots are sorted so that the same roots make the same bundle.
+	roots := a.tr.TrustStore.Certificates()
+	sort.Slice(roots, func(i, j int) bool { return bytes.Compare(roots[i].Raw, roots[j].Raw) < 0 })
+	var bundle bytes.Buffer
+	for _, cert := range roots {
+		bundle.Write(helpers.EncodeCertificatePEM(cert))
+	}
+	if current, err := ioutil.ReadFile(a.opts.BundleFile); err == nil && bytes.Equal(current, bundle.Bytes()) {
+		return false, nil
+	}
+
+	tmp := a.opts.BundleFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, bundle.Bytes(), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, a.opts.BundleFile)
+}
+
+func (a *Agent) notify() error {
+	if a.opts.Command != "" {
+		out, err := exec.Command("sh", "-c", a.opts.Command).CombinedOutput()
+		if err != nil {
+			return errors.New("agent: reload command failed: " + err.Error() + ": " + strings.TrimSpace(string(out)))
+		}
+	}
+
+	if a.opts.PIDFile != "" {
+		data, err := ioutil.ReadFile(a.opts.PIDFile)
+		if err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return errors.New("agent: invalid PID file " + a.opts.PIDFile)
+		}
+		proc, err := os.FindProcess(pid)
+		if err != nil {
+			return err
+		}
+		if err = proc.Signal(a.opts.Signal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Agent) update(rotated bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if cert := a.tr.Provider.Certificate(); cert != nil {
+		a.status.Serial = cert.SerialNumber.String()
+		a.status.NotBefore = cert.NotBefore
+		a.status.NotAfter = cert.NotAfter
+	}
+	if rotated {
+		a.status.Rotations++
+		a.status.LastRotation = time.Now()
+	}
+}
+
+func (a *Agent) failed(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.LastError = err.Error()
+	a.status.LastErrorTime = time.Now()
+}
+
+// Status returns the agent's current status. The agent is healthy while
+// it holds an unexpired certificate.
+func (a *Agent) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := a.status
+	status.Healthy = status.Serial != "" && time.Now().Before(status.NotAfter)
+	return status
+}
+
+// ServeHTTP answers "/health" with 200 or 503 depending on whether the
+// agent is healthy, and "/status" with the Status as JSON.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := a.Status()
+	switch r.URL.Path {
+	case "/health":
+		if !status.Healthy {
+			http.Error(w, "unhealthy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	case "/status":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ServeStatus serves the agent's health and status on a Unix socket at
+// path, replacing any stale socket file.
+func (a *Agent) ServeStatus(path string) error {
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	return http.Serve(l, a)
+}
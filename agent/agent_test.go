@@ -0,0 +1,326 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/transport"
+	"github.com/cloudflare/cfssl/transport/ca/localca"
+	"github.com/cloudflare/cfssl/transport/core"
+	"github.com/cloudflare/cfssl/transport/kp"
+	"github.com/cloudflare/cfssl/transport/roots"
+)
+
+func newTransport(t *testing.T, dir string) *transport.Transport {
+	lca, err := localca.New(localca.ExampleRequest(), localca.ExampleSigningConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := lca.CACertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	if err = ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	id := &core.Identity{
+		Request: &csr.CertificateRequest{
+			CN:         "agent test",
+			Hosts:      []string{"localhost"},
+			KeyRequest: csr.NewBasicKeyRequest(),
+		},
+		Roots: []*core.Root{{Type: "file", Metadata: map[string]string{"source": caFile}}},
+		Profiles: map[string]map[string]string{
+			"paths": {
+				"private_key": filepath.Join(dir, "key.pem"),
+				"certificate": filepath.Join(dir, "cert.pem"),
+			},
+		},
+	}
+
+	provider, err := kp.NewStandardProvider(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := roots.New(id.Roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &transport.Transport{
+		Before:     time.Minute,
+		Provider:   provider,
+		CA:         lca,
+		TrustStore: store,
+		Identity:   id,
+		Backoff:    &core.Backoff{},
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tr := newTransport(t, dir)
+	bundleFile := filepath.Join(dir, "bundle.pem")
+	marker := filepath.Join(dir, "reloaded")
+	a, err := New(tr, Options{BundleFile: bundleFile, Command: "touch " + marker})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Status().Healthy {
+		t.Fatal("agent without a certificate reported healthy")
+	}
+
+	if err = a.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ioutil.ReadFile(filepath.Join(dir, "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = helpers.ParseCertificatePEM(certPEM); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := ioutil.ReadFile(bundleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs, err := helpers.ParseCertificatesPEM(bundle); err != nil || len(certs) != 1 {
+		t.Fatal("bundle does not hold the trusted root")
+	}
+	if _, err = os.Stat(marker); err != nil {
+		t.Fatal("reload command did not run")
+	}
+
+	status := a.Status()
+	if !status.Healthy || status.Rotations != 1 || status.Serial == "" {
+		t.Fatalf("unexpected status after the first rotation: %+v", status)
+	}
+
+	// A fresh certificate is not renewed again.
+	os.Remove(marker)
+	if err = a.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if a.Status().Rotations != 1 {
+		t.Fatal("certificate renewed before it was due")
+	}
+	if _, err = os.Stat(marker); err == nil {
+		t.Fatal("reload command ran without a rotation")
+	}
+}
+
+func TestStartWritesBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tr := newTransport(t, dir)
+	a, err := New(tr, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart with the certificate on disk writes the bundle
+	// without a rotation.
+	provider, err := kp.NewStandardProvider(tr.Identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Provider = provider
+	bundleFile := filepath.Join(dir, "bundle.pem")
+	if a, err = New(tr, Options{BundleFile: bundleFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.start(); err != nil {
+		t.Fatal(err)
+	}
+	if a.Status().Rotations != 0 {
+		t.Fatal("certificate on disk was renewed")
+	}
+	bundle, err := ioutil.ReadFile(bundleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs, err := helpers.ParseCertificatesPEM(bundle); err != nil || len(certs) != 1 {
+		t.Fatal("bundle does not hold the trusted root")
+	}
+
+	// An unreadable key fails the start instead of being replaced.
+	if err = ioutil.WriteFile(filepath.Join(dir, "key.pem"), []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Provider, err = kp.NewStandardProvider(tr.Identity); err != nil {
+		t.Fatal(err)
+	}
+	if a, err = New(tr, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.start(); err == nil {
+		t.Fatal("expected an error for an unreadable key")
+	}
+}
+
+func TestRefreshRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tr := newTransport(t, dir)
+	bundleFile := filepath.Join(dir, "bundle.pem")
+	marker := filepath.Join(dir, "reloaded")
+	a, err := New(tr, Options{BundleFile: bundleFile, Command: "touch " + marker})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unchanged roots leave the bundle and the consumer alone.
+	os.Remove(marker)
+	if err = a.RefreshRoots(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(marker); err == nil {
+		t.Fatal("reload command ran without a change of roots")
+	}
+
+	other, err := localca.New(localca.ExampleRequest(), localca.ExampleSigningConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPEM, err := other.CACertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(caFile, append(caPEM, otherPEM...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := tr.TrustStore.Refresh(); err != nil || !changed {
+		t.Fatalf("expected the roots to change, have %v %v", changed, err)
+	}
+
+	if err = a.RefreshRoots(); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := ioutil.ReadFile(bundleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs, err := helpers.ParseCertificatesPEM(bundle); err != nil || len(certs) != 2 {
+		t.Fatal("bundle does not hold the new root")
+	}
+	if _, err = os.Stat(marker); err != nil {
+		t.Fatal("reload command did not run")
+	}
+}
+
+func TestFailedReloadCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := New(newTransport(t, dir), Options{Command: "exit 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Refresh(); err == nil {
+		t.Fatal("expected a failing reload command to be reported")
+	}
+	if a.Status().LastError == "" {
+		t.Fatal("failure not recorded in the status")
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := New(newTransport(t, dir), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(a)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("expected an agent without a certificate to be unhealthy")
+	}
+
+	if err = a.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Get(ts.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("expected an agent with a certificate to be healthy")
+	}
+
+	resp, err = http.Get(ts.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status Status
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Serial == "" || status.Rotations != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestNewRequiresPaths(t *testing.T) {
+	tr := &transport.Transport{Provider: &kp.StandardProvider{}}
+	if _, err := New(tr, Options{}); err == nil {
+		t.Fatal("expected a provider without paths to be rejected")
+	}
+
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err = New(newTransport(t, dir), Options{PIDFile: "pid"}); err == nil {
+		t.Fatal("expected a PID file without a signal to be rejected")
+	}
+}
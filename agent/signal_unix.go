@@ -0,0 +1,29 @@
+// +build !windows
+
+package agent
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// ParseSignal returns the signal with the given name, such as "HUP" or
+// "SIGUSR1".
+func ParseSignal(name string) (os.Signal, error) {
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, errors.New("agent: unsupported signal " + name)
+	}
+	return sig, nil
+}
@@ -0,0 +1,20 @@
+// +build !windows
+
+package agent
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"HUP", "hup", "SIGHUP"} {
+		sig, err := ParseSignal(name)
+		if err != nil || sig != syscall.SIGHUP {
+			t.Fatalf("%s parsed as %v, %v", name, sig, err)
+		}
+	}
+	if _, err := ParseSignal("KILLALL"); err == nil {
+		t.Fatal("expected an unknown signal to be rejected")
+	}
+}
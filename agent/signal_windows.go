@@ -0,0 +1,12 @@
+package agent
+
+import (
+	"errors"
+	"os"
+)
+
+// ParseSignal always fails, as Windows processes can't be sent reload
+// signals; use a reload command instead.
+func ParseSignal(name string) (os.Signal, error) {
+	return nil, errors.New("agent: signals are not supported on Windows")
+}
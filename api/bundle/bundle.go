@@ -2,6 +2,7 @@
 package bundle
 
 import (
+	"encoding/base64"
 	"net/http"
 
 	"github.com/cloudflare/cfssl/api"
@@ -48,6 +49,10 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 	if flavor != "" {
 		bf = bundler.BundleFlavor(flavor)
 	}
+	if bf, err = bundler.RankingFlavor(bf, blob["ranking"]); err != nil {
+		log.Warningf("invalid flavor or ranking: %v", err)
+		return errors.NewBadRequest(err)
+	}
 	log.Infof("request for flavor %v", bf)
 
 	var result *bundler.Bundle
@@ -86,6 +91,30 @@ func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
 
 		result = bundle
 	}
+
+	response, err := encodeBundle(result, blob["format"], blob["password"])
+	if err != nil {
+		log.Warningf("couldn't encode the bundle: %v", err)
+		return err
+	}
 	log.Info("wrote response")
-	return api.SendResponse(w, result)
+	return api.SendResponse(w, response)
+}
+
+// encodeBundle returns the response for a bundle in the requested
+// format. JSON bundles are returned as is; other formats are returned
+// base64-encoded, alongside the name of the format.
+func encodeBundle(bundle *bundler.Bundle, format, password string) (interface{}, error) {
+	if format == "" || format == bundler.FormatJSON {
+		return bundle, nil
+	}
+
+	encoded, err := bundle.Encode(format, password)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"format": format,
+		"bundle": base64.StdEncoding.EncodeToString(encoded),
+	}, nil
 }
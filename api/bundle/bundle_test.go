@@ -2,6 +2,8 @@ package bundle
 
 import (
 	"bytes"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -9,6 +11,8 @@ import (
 	"testing"
 
 	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/bundler"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 const (
@@ -211,3 +215,91 @@ func TestBundle(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeBundle(t *testing.T) {
+	certPEM, err := ioutil.ReadFile(testLeafCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := ioutil.ReadFile(testLeafKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := &bundler.Bundle{Chain: []*x509.Certificate{cert}, Cert: cert, Key: key}
+
+	response, err := encodeBundle(bundle, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != bundle {
+		t.Fatal("expected a JSON bundle to be returned as is")
+	}
+
+	response, err = encodeBundle(bundle, bundler.FormatPKCS7, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := response.(map[string]string)
+	if encoded["format"] != bundler.FormatPKCS7 {
+		t.Fatalf("expected the pkcs7 format, have %s", encoded["format"])
+	}
+	der, err := base64.StdEncoding.DecodeString(encoded["bundle"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, _, err := helpers.ParseCertificatesDER(der, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || !bytes.Equal(certs[0].Raw, cert.Raw) {
+		t.Fatal("expected the PKCS #7 bundle to hold the certificate")
+	}
+
+	if _, err = encodeBundle(bundle, bundler.FormatJKS, "changeit"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = encodeBundle(bundle, bundler.FormatPKCS12, ""); err == nil {
+		t.Fatal("expected a PKCS #12 bundle without a password to be refused")
+	}
+	if _, err = encodeBundle(bundle, "xml", ""); err == nil {
+		t.Fatal("expected an unknown format to be refused")
+	}
+}
+
+func TestBundleRankingBadRequest(t *testing.T) {
+	ts := newBundleServer(t)
+	defer ts.Close()
+	certPEM, err := ioutil.ReadFile(testLeafCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, obj := range []map[string]string{
+		{"certificate": string(certPEM), "ranking": "shortest"},
+		{"certificate": string(certPEM), "ranking": "length:0"},
+		{"certificate": string(certPEM), "flavor": "force", "ranking": "length"},
+		{"certificate": string(certPEM), "flavor": "length,expiry"},
+		{"certificate": string(certPEM), "ranking": "chain-through=" + testLeafCertFile},
+	} {
+		blob, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%v: expected %d, have %d", obj, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+}
@@ -255,6 +255,9 @@ func (srv *server) Info(jsonData []byte) (*info.Resp, error) {
 	if val, ok := res["expiry"]; ok && val != nil {
 		info.ExpiryString = val.(string)
 	}
+	if val, ok := res["renewal_window"].(float64); ok {
+		info.RenewalWindow = val
+	}
 
 	info.Usage = make([]string, len(usages))
 	for i, s := range usages {
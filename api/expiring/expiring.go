@@ -0,0 +1,61 @@
+// Package expiring implements the HTTP handler for the expiring command.
+package expiring
+
+import (
+	"net/http"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/expiring"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// A Handler reports the certificates in the certdb that are nearing
+// expiry.
+type Handler struct {
+	dbAccessor certdb.Accessor
+}
+
+// NewHandler returns a new http.Handler that handles an expiring request.
+// Reminders are not sent from the endpoint; run "cfssl expiring -exec"
+// from cron for that.
+func NewHandler(dbAccessor certdb.Accessor) http.Handler {
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			dbAccessor: dbAccessor,
+		},
+		Methods: []string{"GET"},
+	}
+}
+
+// Handle responds to expiring requests. The "within" query parameter
+// sets the window (default 30 days, e.g. "72h" or "14d"), and
+// "format=csv" returns CSV instead of the JSON response.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	within := 30 * helpers.OneDay
+
+	if q := r.URL.Query().Get("within"); q != "" {
+		var err error
+		within, err = expiring.ParseDuration(q)
+		if err != nil {
+			return errors.NewBadRequestString("Invalid duration for 'within'")
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		return errors.NewBadRequestString("Invalid format; expected 'json' or 'csv'")
+	}
+
+	groups, err := expiring.Find(h.dbAccessor, within)
+	if err != nil {
+		return err
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		return expiring.WriteCSV(w, groups)
+	}
+	return api.SendResponse(w, groups)
+}
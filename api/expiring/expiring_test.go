@@ -0,0 +1,124 @@
+package expiring
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+)
+
+func prepDB() (certdb.Accessor, error) {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	var cert = certdb.CertificateRecord{
+		Serial:  "1",
+		AKI:     "fake aki",
+		CALabel: "label",
+		Profile: "server",
+		Status:  "good",
+		Expiry:  time.Now().Add(24 * time.Hour),
+		PEM:     "unexpired cert",
+	}
+
+	dbAccessor := sql.NewAccessor(db)
+	err := dbAccessor.InsertCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	return dbAccessor, nil
+}
+
+func get(t *testing.T, dbAccessor certdb.Accessor, query string) (*http.Response, []byte) {
+	return request(t, NewHandler(dbAccessor), "GET", query)
+}
+
+func request(t *testing.T, h http.Handler, method, query string) (*http.Response, []byte) {
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	req, err := http.NewRequest(method, ts.URL+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, body
+}
+
+func TestExpiring(t *testing.T) {
+	dbAccessor, err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := get(t, dbAccessor, "?within=2d")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected HTTP status code; expected OK", string(body))
+	}
+	message := new(api.Response)
+	if err = json.Unmarshal(body, message); err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	groups := message.Result.([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("expected one group, got %v", groups)
+	}
+
+	resp, body = get(t, dbAccessor, "?within=1h")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected HTTP status code; expected OK", string(body))
+	}
+	if err = json.Unmarshal(body, message); err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	if groups := message.Result.([]interface{}); len(groups) != 0 {
+		t.Fatalf("expected no groups, got %v", groups)
+	}
+
+	resp, body = get(t, dbAccessor, "?format=csv")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected HTTP status code; expected OK", string(body))
+	}
+	if !strings.Contains(string(body), "label,server,1,fake aki") {
+		t.Fatalf("unexpected CSV output %s", body)
+	}
+}
+
+func TestBadExpiringRequests(t *testing.T) {
+	dbAccessor, err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, _ := get(t, dbAccessor, "?within=soon"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected bad request response for an invalid duration")
+	}
+	if resp, _ := get(t, dbAccessor, "?format=xml"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected bad request response for an invalid format")
+	}
+}
+
+func TestExpiringRejectsPOST(t *testing.T) {
+	dbAccessor, err := prepDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, _ := request(t, NewHandler(dbAccessor), "POST", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected POST to be rejected, got status %d", resp.StatusCode)
+	}
+}
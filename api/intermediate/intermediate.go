@@ -0,0 +1,321 @@
+// Package intermediate implements the HTTP handler for creating
+// intermediate CAs under a running signer.
+package intermediate
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+)
+
+// A KeyStore generates and keeps the private keys of new intermediates,
+// e.g. in an HSM. The key never leaves the store.
+type KeyStore interface {
+	GenerateKey(label string, req csr.KeyRequest) (crypto.Signer, error)
+}
+
+// A Registry makes new intermediates available for signing under their
+// label.
+type Registry interface {
+	Registered(label string) bool
+	Register(label string, s signer.Signer) error
+}
+
+// A Store persists the certificates of new intermediates, so that they
+// can be registered again after a restart.
+type Store interface {
+	Save(label string, certPEM []byte) error
+}
+
+// A Request names the new intermediate's label, the parent's signing
+// profile to issue it under, and the certificate request for its key.
+type Request struct {
+	Label   string                  `json:"label"`
+	Profile string                  `json:"profile"`
+	Request *csr.CertificateRequest `json:"request"`
+}
+
+// A Response contains the new intermediate's certificate. The private
+// key is only returned when it was generated in-process.
+type Response struct {
+	Label       string `json:"label"`
+	Certificate string `json:"certificate"`
+	Key         string `json:"private_key,omitempty"`
+}
+
+// A Handler creates intermediates signed by a parent signer.
+type Handler struct {
+	parent   signer.Signer
+	registry Registry
+	keys     KeyStore
+	store    Store
+}
+
+// NewHandler returns a new http.Handler that creates intermediates
+// signed by parent and registers them with registry. If keys is nil,
+// keys are generated in-process and returned to the caller. If store is
+// not nil, new intermediates are saved to it before they are registered.
+func NewHandler(parent signer.Signer, registry Registry, keys KeyStore, store Store) http.Handler {
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			parent:   parent,
+			registry: registry,
+			keys:     keys,
+			store:    store,
+		},
+		Methods: []string{"POST"},
+	}
+}
+
+// validLabel matches labels, which name the files an intermediate is
+// kept in by Dir.
+var validLabel = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// validator requires a common name, which names the intermediate in
+// chains and logs.
+func validator(req *csr.CertificateRequest) error {
+	if req.CN == "" {
+		return errors.NewBadRequestString("missing common name in 'request'")
+	}
+	return nil
+}
+
+// Handle responds to requests for a new intermediate.
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return errors.NewBadRequest(err)
+	}
+	r.Body.Close()
+
+	// The request may be wrapped in an authenticated request, as for
+	// authsign, for profiles with an auth key.
+	var aReq auth.AuthenticatedRequest
+	if json.Unmarshal(body, &aReq) == nil && len(aReq.Token) > 0 {
+		body = aReq.Request
+	}
+
+	req := Request{Request: &csr.CertificateRequest{KeyRequest: csr.NewBasicKeyRequest()}}
+	if err = json.Unmarshal(body, &req); err != nil {
+		return errors.NewBadRequestString("Unable to parse intermediate request")
+	}
+
+	if req.Label == "" {
+		return errors.NewBadRequestString("missing parameter 'label'")
+	}
+	if !validLabel.MatchString(req.Label) {
+		return errors.NewBadRequestString("label may only contain letters, digits, '_', '.' and '-'")
+	}
+	if req.Request == nil {
+		return errors.NewBadRequestString("missing parameter 'request'")
+	}
+	if err = validator(req.Request); err != nil {
+		return err
+	}
+	if h.registry.Registered(req.Label) {
+		return errors.NewBadRequestString("label " + req.Label + " is already in use")
+	}
+
+	profile, err := signer.Profile(h.parent, req.Profile)
+	if err != nil {
+		return err
+	}
+	if !profile.CAConstraint.IsCA {
+		return errors.NewBadRequestString("profile does not issue CA certificates")
+	}
+	if profile.Provider != nil {
+		if len(aReq.Token) == 0 {
+			log.Error("profile requires authentication")
+			return errors.NewBadRequestString("authentication required")
+		}
+		if !profile.Provider.Verify(&aReq) {
+			log.Warning("received authenticated request with invalid token")
+			return errors.NewBadRequestString("invalid token")
+		}
+	}
+
+	if req.Request.KeyRequest == nil {
+		req.Request.KeyRequest = csr.NewBasicKeyRequest()
+	}
+
+	var csrPEM, keyPEM []byte
+	var priv crypto.Signer
+	if h.keys == nil {
+		g := &csr.Generator{Validator: validator}
+		csrPEM, keyPEM, err = g.ProcessRequest(req.Request)
+		if err != nil {
+			return err
+		}
+		priv, err = helpers.ParsePrivateKeyPEM(keyPEM)
+	} else {
+		priv, err = h.keys.GenerateKey(req.Label, req.Request.KeyRequest)
+		if err != nil {
+			return err
+		}
+		csrPEM, err = csr.Generate(priv, req.Request)
+	}
+	if err != nil {
+		return err
+	}
+
+	certPEM, err := h.parent.Sign(signer.SignRequest{
+		Request: string(csrPEM),
+		Profile: req.Profile,
+	})
+	if err != nil {
+		return err
+	}
+
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+
+	s, err := newSigner(h.parent, priv, cert)
+	if err != nil {
+		return err
+	}
+	if h.store != nil {
+		if err = h.store.Save(req.Label, certPEM); err != nil {
+			return err
+		}
+	}
+
+	if err = h.registry.Register(req.Label, s); err != nil {
+		return errors.NewBadRequest(err)
+	}
+	log.Infof("registered intermediate %s with label %s", cert.Subject.CommonName, req.Label)
+
+	return api.SendResponse(w, &Response{
+		Label:       req.Label,
+		Certificate: string(certPEM),
+		Key:         string(keyPEM),
+	})
+}
+
+// newSigner returns a signer for the intermediate cert, with the leaf
+// profiles of its parent's policy and the parent's cert db accessor.
+func newSigner(parent signer.Signer, priv crypto.Signer, cert *x509.Certificate) (signer.Signer, error) {
+	s, err := local.NewSigner(priv, cert, signer.DefaultSigAlgo(priv), LeafPolicy(parent.Policy()))
+	if err != nil {
+		return nil, err
+	}
+	if dbAccessor := parent.GetDBAccessor(); dbAccessor != nil {
+		s.SetDBAccessor(dbAccessor)
+	}
+	return s, nil
+}
+
+// LeafPolicy returns a copy of policy without the profiles that issue CA
+// certificates, for intermediates created by a Handler: they may only
+// issue end-entity certificates. A CA default profile is replaced by a
+// copy without the CA constraint.
+func LeafPolicy(policy *config.Signing) *config.Signing {
+	if policy == nil {
+		return nil
+	}
+
+	leaf := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{},
+		Default:  policy.Default,
+	}
+	for name, profile := range policy.Profiles {
+		if !profile.CAConstraint.IsCA {
+			leaf.Profiles[name] = profile
+		}
+	}
+	if policy.Default != nil && policy.Default.CAConstraint.IsCA {
+		def := *policy.Default
+		def.CAConstraint = config.CAConstraint{}
+		leaf.Default = &def
+	}
+	return leaf
+}
+
+// Dir keeps the keys and certificates of new intermediates in a
+// directory, as <label>-key.pem and <label>-cert.pem, so that they can
+// be restored after a restart. It is both a KeyStore and a Store.
+type Dir string
+
+// GenerateKey generates a key for the intermediate label and writes it
+// to the directory, readable only by its owner.
+func (d Dir) GenerateKey(label string, req csr.KeyRequest) (crypto.Signer, error) {
+	priv, err := req.Generate()
+	if err != nil {
+		return nil, errors.Wrap(errors.PrivateKeyError, errors.GenerationFailed, err)
+	}
+	der, err := ctx509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, errors.Wrap(errors.PrivateKeyError, errors.Unknown, err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err = ioutil.WriteFile(filepath.Join(string(d), label+"-key.pem"), keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	return priv.(crypto.Signer), nil
+}
+
+// Save writes the certificate of the intermediate label to the directory.
+func (d Dir) Save(label string, certPEM []byte) error {
+	return ioutil.WriteFile(filepath.Join(string(d), label+"-cert.pem"), certPEM, 0644)
+}
+
+// Restore registers the intermediates kept in the directory with
+// registry, signing with the policy of parent. Keys left without a
+// certificate by requests that failed are ignored.
+func (d Dir) Restore(parent signer.Signer, registry Registry) error {
+	certFiles, err := filepath.Glob(filepath.Join(string(d), "*-cert.pem"))
+	if err != nil {
+		return err
+	}
+	for _, certFile := range certFiles {
+		label := strings.TrimSuffix(filepath.Base(certFile), "-cert.pem")
+		certPEM, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return err
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			return err
+		}
+		keyPEM, err := ioutil.ReadFile(filepath.Join(string(d), label+"-key.pem"))
+		if os.IsNotExist(err) {
+			log.Warningf("skipping intermediate %s, whose key isn't kept in %s", label, d)
+			continue
+		} else if err != nil {
+			return err
+		}
+		priv, err := helpers.ParsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			return err
+		}
+
+		s, err := newSigner(parent, priv, cert)
+		if err != nil {
+			return err
+		}
+		if err = registry.Register(label, s); err != nil {
+			return err
+		}
+		log.Infof("restored intermediate %s with label %s", cert.Subject.CommonName, label)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package intermediate
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/auth"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+	"github.com/cloudflare/cfssl/signer/universal"
+)
+
+const (
+	testCaFile    = "../testdata/ca.pem"
+	testCaKeyFile = "../testdata/ca_key.pem"
+)
+
+func newParent(t *testing.T) *universal.Labeled {
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{
+			"intermediate": {
+				Usage:        []string{"cert sign", "crl sign"},
+				Expiry:       time.Hour,
+				ExpiryString: "1h",
+				CAConstraint: config.CAConstraint{IsCA: true, MaxPathLenZero: true},
+				NameConstraints: &config.NameConstraints{
+					PermittedDNSDomains: []string{"example.com"},
+				},
+			},
+		},
+		Default: &config.SigningProfile{
+			Usage:        []string{"digital signature", "server auth"},
+			Expiry:       time.Hour,
+			ExpiryString: "1h",
+		},
+	}
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return universal.NewLabeled(s)
+}
+
+func post(t *testing.T, h http.Handler, obj interface{}) (*http.Response, *api.Response) {
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	blob, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := new(api.Response)
+	if err = json.Unmarshal(body, message); err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	return resp, message
+}
+
+func newRequest(label, profile string) Request {
+	return Request{
+		Label:   label,
+		Profile: profile,
+		Request: &csr.CertificateRequest{
+			CN:         "Example Intermediate",
+			KeyRequest: csr.NewBasicKeyRequest(),
+		},
+	}
+}
+
+func TestNewIntermediate(t *testing.T) {
+	parent := newParent(t)
+	h := NewHandler(parent, parent, nil, nil)
+
+	resp, message := post(t, h, newRequest("example", "intermediate"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected HTTP status code %d: %v", resp.StatusCode, message.Errors)
+	}
+	result := message.Result.(map[string]interface{})
+	if result["private_key"] == nil || result["private_key"] == "" {
+		t.Fatal("in-process key not returned")
+	}
+
+	cert, err := helpers.ParseCertificatePEM([]byte(result["certificate"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.IsCA || len(cert.PermittedDNSDomains) != 1 || cert.PermittedDNSDomains[0] != "example.com" {
+		t.Fatal("intermediate is missing the profile's CA and name constraints")
+	}
+
+	if !parent.Registered("example") {
+		t.Fatal("intermediate was not registered")
+	}
+
+	// The new label signs with the intermediate.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, err := csr.Generate(key, &csr.CertificateRequest{CN: "www.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPEM, err := parent.Sign(signer.SignRequest{Hosts: []string{"www.example.com"}, Request: string(csrPEM), Label: "example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := helpers.ParseCertificatePEM(leafPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = leaf.CheckSignatureFrom(cert); err != nil {
+		t.Fatalf("leaf not signed by the intermediate: %v", err)
+	}
+
+	// The intermediate can't issue further CAs.
+	subPEM, err := parent.Sign(signer.SignRequest{Hosts: []string{"www.example.com"}, Request: string(csrPEM), Label: "example", Profile: "intermediate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := helpers.ParseCertificatePEM(subPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.IsCA {
+		t.Fatal("intermediate signed a CA under the parent's CA profile")
+	}
+
+	// Labels can't be reused.
+	resp, _ = post(t, h, newRequest("example", "intermediate"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected a duplicate label to be rejected")
+	}
+}
+
+func TestBadIntermediateRequests(t *testing.T) {
+	parent := newParent(t)
+	h := NewHandler(parent, parent, nil, nil)
+
+	bad := []Request{
+		newRequest("", "intermediate"),
+		{Label: "example", Profile: "intermediate"},
+		{Label: "example", Profile: "intermediate", Request: &csr.CertificateRequest{}},
+		newRequest("example", ""),
+	}
+	for i, req := range bad {
+		resp, _ := post(t, h, req)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("request %d: expected bad request, got %d", i, resp.StatusCode)
+		}
+	}
+	if parent.Registered("example") {
+		t.Fatal("rejected request registered a label")
+	}
+}
+
+type testKeyStore map[string]crypto.Signer
+
+func (ks testKeyStore) GenerateKey(label string, req csr.KeyRequest) (crypto.Signer, error) {
+	key, err := req.Generate()
+	if err != nil {
+		return nil, err
+	}
+	ks[label] = key.(crypto.Signer)
+	return ks[label], nil
+}
+
+func TestNewIntermediateKeyStore(t *testing.T) {
+	parent := newParent(t)
+	keys := testKeyStore{}
+	h := NewHandler(parent, parent, keys, nil)
+
+	resp, message := post(t, h, newRequest("stored", "intermediate"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected HTTP status code %d: %v", resp.StatusCode, message.Errors)
+	}
+	result := message.Result.(map[string]interface{})
+	if _, ok := result["private_key"]; ok {
+		t.Fatal("stored key returned to the caller")
+	}
+	if keys["stored"] == nil {
+		t.Fatal("key store did not generate the key")
+	}
+}
+
+func TestNewIntermediateAuth(t *testing.T) {
+	parent := newParent(t)
+	provider, err := auth.New("0123456789ABCDEF0123456789ABCDEF", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.Policy().Profiles["intermediate"].Provider = provider
+	h := NewHandler(parent, parent, nil, nil)
+
+	resp, _ := post(t, h, newRequest("unauthenticated", "intermediate"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an unauthenticated request to be rejected, got %d", resp.StatusCode)
+	}
+
+	blob, err := json.Marshal(newRequest("authenticated", "intermediate"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aReq := auth.AuthenticatedRequest{Request: blob, Token: []byte("bad token")}
+	resp, _ = post(t, h, aReq)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an invalid token to be rejected, got %d", resp.StatusCode)
+	}
+	if parent.Registered("unauthenticated") || parent.Registered("authenticated") {
+		t.Fatal("rejected request registered a label")
+	}
+
+	if aReq.Token, err = provider.Token(blob); err != nil {
+		t.Fatal(err)
+	}
+	resp, message := post(t, h, aReq)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected HTTP status code %d: %v", resp.StatusCode, message.Errors)
+	}
+	if !parent.Registered("authenticated") {
+		t.Fatal("intermediate was not registered")
+	}
+}
+
+func TestNewIntermediateDir(t *testing.T) {
+	parent := newParent(t)
+	tmp, err := ioutil.TempDir("", "cfssl-intermediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := Dir(tmp)
+	h := NewHandler(parent, parent, dir, dir)
+
+	resp, message := post(t, h, newRequest("persisted", "intermediate"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected HTTP status code %d: %v", resp.StatusCode, message.Errors)
+	}
+	if _, ok := message.Result.(map[string]interface{})["private_key"]; ok {
+		t.Fatal("stored key returned to the caller")
+	}
+	resp, _ = post(t, h, newRequest("../escape", "intermediate"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected a label naming another directory to be rejected")
+	}
+
+	// A restarted server registers the intermediate again.
+	restarted := newParent(t)
+	if err = dir.Restore(restarted, restarted); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.Registered("persisted") {
+		t.Fatal("intermediate was not restored")
+	}
+	if err = dir.Restore(restarted, restarted); err == nil {
+		t.Fatal("expected an error restoring a label twice")
+	}
+}
+
+func TestLeafPolicy(t *testing.T) {
+	policy := newParent(t).Policy()
+	leaf := LeafPolicy(policy)
+	if _, ok := leaf.Profiles["intermediate"]; ok {
+		t.Fatal("leaf policy keeps the CA profile")
+	}
+	if _, ok := policy.Profiles["intermediate"]; !ok {
+		t.Fatal("leaf policy changed the parent's policy")
+	}
+
+	policy.Default.CAConstraint.IsCA = true
+	if LeafPolicy(policy).Default.CAConstraint.IsCA {
+		t.Fatal("leaf policy keeps a CA default profile")
+	}
+	if !policy.Default.CAConstraint.IsCA {
+		t.Fatal("leaf policy changed the parent's default profile")
+	}
+}
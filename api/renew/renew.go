@@ -0,0 +1,102 @@
+// Package renew implements the HTTP handler for the renew command.
+package renew
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/renew"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// A Handler accepts requests naming a previously issued certificate
+// and re-issues it with a fresh validity period.
+type Handler struct {
+	signer signer.Signer
+}
+
+// NewHandler returns a new http.Handler that handles a renew request.
+// The signer must have a certdb accessor.
+func NewHandler(s signer.Signer) http.Handler {
+	return &api.HTTPHandler{
+		Handler: &Handler{
+			signer: s,
+		},
+		Methods: []string{"POST"},
+	}
+}
+
+// This type is meant to be unmarshalled from JSON
+type jsonRenewRequest struct {
+	Certificate string `json:"certificate"`
+	Serial      string `json:"serial"`
+	AKI         string `json:"authority_key_id"`
+	Request     string `json:"certificate_request"`
+	Signature   string `json:"signature"`
+	Revoke      bool   `json:"revoke"`
+}
+
+// Handle responds to renewal requests. The certificate to renew is
+// given either as a PEM-encoded "certificate" or by "serial" and
+// "authority_key_id". "certificate_request" is the CSR for the renewed
+// certificate; if it carries a new key, "signature" must be a base64
+// signature over the DER-encoded CSR made with the old key. If "revoke"
+// is true, the old certificate is revoked with reason "superseded".
+func (h *Handler) Handle(w http.ResponseWriter, r *http.Request) error {
+	log.Info("renewal request received")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+
+	var req jsonRenewRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		return errors.NewBadRequestString("Unable to parse renewal request")
+	}
+
+	if req.Request == "" {
+		return errors.NewBadRequestString("missing parameter 'certificate_request'")
+	}
+
+	renewReq := renew.Request{
+		Serial:  req.Serial,
+		AKI:     req.AKI,
+		Request: []byte(req.Request),
+		Revoke:  req.Revoke,
+	}
+
+	if req.Certificate != "" {
+		renewReq.Certificate, err = helpers.ParseCertificatePEM([]byte(req.Certificate))
+		if err != nil {
+			return errors.NewBadRequestString("Unable to parse certificate")
+		}
+	} else if req.Serial == "" {
+		return errors.NewBadRequestString("either certificate or serial number is required")
+	}
+
+	if req.Signature != "" {
+		renewReq.Signature, err = base64.StdEncoding.DecodeString(req.Signature)
+		if err != nil {
+			return errors.NewBadRequestString("Unable to decode signature")
+		}
+	}
+
+	cert, err := renew.Renew(h.signer, renewReq)
+	if err != nil {
+		log.Warningf("failed to renew certificate: %v", err)
+		return err
+	}
+
+	result := map[string]interface{}{"certificate": string(cert)}
+	log.Info("wrote response")
+	return api.SendResponse(w, result)
+}
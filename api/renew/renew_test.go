@@ -0,0 +1,126 @@
+package renew
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/cfssl/api"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+)
+
+const (
+	testCaFile    = "../testdata/ca.pem"
+	testCaKeyFile = "../testdata/ca_key.pem"
+)
+
+func newTestSigner(t *testing.T) signer.Signer {
+	db := testdb.SQLiteDB("../../certdb/testdb/certstore_development.db")
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetDBAccessor(sql.NewAccessor(db))
+	return s
+}
+
+func newTestCSR(t *testing.T, key *ecdsa.PrivateKey) string {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func testRenew(t *testing.T, s signer.Signer, obj map[string]interface{}) (resp *http.Response, body []byte) {
+	ts := httptest.NewServer(NewHandler(s))
+	defer ts.Close()
+
+	blob, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = http.Post(ts.URL, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestBadRenewRequests(t *testing.T) {
+	s := newTestSigner(t)
+
+	resp, _ := testRenew(t, s, map[string]interface{}{"serial": "1"})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected bad request response for a missing CSR")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ = testRenew(t, s, map[string]interface{}{"certificate_request": newTestCSR(t, key)})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("expected bad request response for a missing certificate")
+	}
+}
+
+func TestRenew(t *testing.T) {
+	s := newTestSigner(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := newTestCSR(t, key)
+
+	cert, err := s.Sign(signer.SignRequest{Hosts: []string{"example.com"}, Request: csrPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := testRenew(t, s, map[string]interface{}{
+		"certificate":         string(cert),
+		"certificate_request": csrPEM,
+		"revoke":              true,
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal("unexpected HTTP status code; expected OK", string(body))
+	}
+
+	message := new(api.Response)
+	if err = json.Unmarshal(body, message); err != nil {
+		t.Fatalf("failed to read response body: %v", err)
+	}
+	result := message.Result.(map[string]interface{})
+	if _, ok := result["certificate"].(string); !ok {
+		t.Fatal("response has no certificate")
+	}
+
+	// The renewed certificate is superseded and can't be renewed again.
+	resp, _ = testRenew(t, s, map[string]interface{}{
+		"certificate":         string(cert),
+		"certificate_request": csrPEM,
+	})
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("expected renewing a superseded certificate to fail")
+	}
+}
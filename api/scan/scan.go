@@ -2,7 +2,10 @@ package scan
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cloudflare/cfssl/api"
@@ -11,38 +14,53 @@ import (
 	"github.com/cloudflare/cfssl/scan"
 )
 
-// scanHandler is an HTTP handler that accepts GET parameters for host (required)
-// family and scanner, and uses these to perform scans, returning a JSON blob result.
-func scanHandler(w http.ResponseWriter, r *http.Request) error {
+// scanRequest holds the parameters of a scan request.
+type scanRequest struct {
+	host, ip, family, scanner string
+	timeout                   time.Duration
+}
+
+// parseScanRequest reads the GET parameters for host (required), ip,
+// family, scanner and timeout.
+func parseScanRequest(r *http.Request) (*scanRequest, error) {
 	if err := r.ParseForm(); err != nil {
 		log.Warningf("failed to parse body: %v", err)
-		return errors.NewBadRequest(err)
+		return nil, errors.NewBadRequest(err)
 	}
 
-	family := r.Form.Get("family")
-	scanner := r.Form.Get("scanner")
-	ip := r.Form.Get("ip")
-	timeoutStr := r.Form.Get("timeout")
-	var timeout time.Duration
-	var err error
-	if timeoutStr != "" {
-		if timeout, err = time.ParseDuration(timeoutStr); err != nil {
-			return errors.NewBadRequest(err)
+	req := &scanRequest{
+		host:    r.Form.Get("host"),
+		ip:      r.Form.Get("ip"),
+		family:  r.Form.Get("family"),
+		scanner: r.Form.Get("scanner"),
+		timeout: time.Minute,
+	}
+	if timeoutStr := r.Form.Get("timeout"); timeoutStr != "" {
+		var err error
+		if req.timeout, err = time.ParseDuration(timeoutStr); err != nil {
+			return nil, errors.NewBadRequest(err)
 		}
-		if timeout < time.Second || timeout > 5*time.Minute {
-			return errors.NewBadRequestString("invalid timeout given")
+		if req.timeout < time.Second || req.timeout > 5*time.Minute {
+			return nil, errors.NewBadRequestString("invalid timeout given")
 		}
-	} else {
-		timeout = time.Minute
 	}
 
-	host := r.Form.Get("host")
-	if host == "" {
+	if req.host == "" {
 		log.Warningf("no host given")
-		return errors.NewBadRequestString("no host given")
+		return nil, errors.NewBadRequestString("no host given")
+	}
+	return req, nil
+}
+
+// scanHandler is an HTTP handler that accepts GET parameters for host (required)
+// family and scanner, and uses these to perform scans, returning a JSON blob result.
+func scanHandler(w http.ResponseWriter, r *http.Request) error {
+	req, err := parseScanRequest(r)
+	if err != nil {
+		return err
 	}
 
-	results, err := scan.Default.RunScans(host, ip, family, scanner, timeout)
+	results, err := scan.Default.RunScans(req.host, req.ip, req.family, req.scanner, req.timeout)
 	if err != nil {
 		return errors.NewBadRequest(err)
 	}
@@ -74,3 +92,93 @@ func NewInfoHandler() http.Handler {
 		Methods: []string{"GET"},
 	}
 }
+
+// streamHandler is an HTTP handler that accepts the parameters of
+// scanHandler and streams each scanner's result as it completes: as
+// server-sent events if the client accepts text/event-stream, and as JSON
+// lines otherwise. The scan is cancelled when the client disconnects or the
+// timeout passes.
+func streamHandler(w http.ResponseWriter, r *http.Request) error {
+	req, err := parseScanRequest(r)
+	if err != nil {
+		return err
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.NewBadRequestString("streaming isn't supported by the connection")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	results, err := scan.Default.StreamScans(done, req.host, req.ip, req.family, req.scanner)
+	if err != nil {
+		return errors.NewBadRequest(err)
+	}
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	streamResults(w, flusher, results, r.Context().Done(), req.host, req.timeout, sse)
+	return nil
+}
+
+// streamResults writes each result to w as it arrives, as a server-sent
+// event if sse is set and as a JSON line otherwise, until results is closed,
+// cancel is closed or timeout passes.
+func streamResults(w io.Writer, flusher http.Flusher, results <-chan *scan.Result, cancel <-chan struct{}, host string, timeout time.Duration, sse bool) {
+	deadline := time.After(timeout)
+	for {
+		var result *scan.Result
+		select {
+		case result = <-results:
+		case <-cancel:
+			log.Infof("client cancelled scan of %s", host)
+			return
+		case <-deadline:
+			log.Warningf("Scan timed out after %v", timeout)
+			if sse {
+				fmt.Fprintf(w, "event: timeout\ndata: {}\n\n")
+			} else {
+				fmt.Fprintf(w, "{\"timeout\":true}\n")
+			}
+			flusher.Flush()
+			return
+		}
+		if result == nil {
+			break
+		}
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			log.Errorf("failed to marshal result of %s/%s: %v", result.Family, result.Scanner, err)
+			continue
+		}
+		if sse {
+			fmt.Fprintf(w, "event: result\ndata: %s\n\n", data)
+		} else {
+			fmt.Fprintf(w, "%s\n", data)
+		}
+		flusher.Flush()
+	}
+
+	if sse {
+		fmt.Fprintf(w, "event: done\ndata: {}\n\n")
+		flusher.Flush()
+	}
+}
+
+// NewStreamHandler returns a new http.Handler that handles a streaming scan
+// request.
+func NewStreamHandler(caBundleFile string) (http.Handler, error) {
+	return api.HTTPHandler{
+		Handler: api.HandlerFunc(streamHandler),
+		Methods: []string{"GET"},
+	}, scan.LoadRootCAs(caBundleFile)
+}
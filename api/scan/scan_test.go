@@ -1,9 +1,16 @@
 package scan
 
 import (
+	"bufio"
+	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan"
 )
 
 var (
@@ -61,3 +68,120 @@ func TestNewInfoHandler(t *testing.T) {
 		t.Fatal("Handler error")
 	}
 }
+
+func newStreamServer(t *testing.T) *httptest.Server {
+	handler, err := NewStreamHandler("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(handler)
+}
+
+func streamScan(t *testing.T, ts *httptest.Server, host, accept string) *http.Response {
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	data := req.URL.Query()
+	if host != "" {
+		data.Add("host", host)
+	}
+	data.Add("family", "Connectivity")
+	data.Add("scanner", "TCPDial")
+	req.URL.RawQuery = data.Encode()
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestStreamBadRequest(t *testing.T) {
+	ts := newStreamServer(t)
+	defer ts.Close()
+	resp := streamScan(t, ts, "", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal(resp.Status)
+	}
+}
+
+func TestStreamJSONLines(t *testing.T) {
+	ts := newStreamServer(t)
+	defer ts.Close()
+	l := listen(t)
+	defer l.Close()
+	resp := streamScan(t, ts, l.Addr().String(), "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatal(resp.Status, resp.Header)
+	}
+
+	var results []scan.Result
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var result scan.Result
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+	if len(results) != 1 || results[0].Family != "Connectivity" || results[0].Scanner != "TCPDial" || results[0].Grade != scan.Good.String() {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	ts := newStreamServer(t)
+	defer ts.Close()
+	l := listen(t)
+	defer l.Close()
+	resp := streamScan(t, ts, l.Addr().String(), "text/event-stream")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal(resp.Status, resp.Header)
+	}
+
+	var events, data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if len(events) != 2 || events[0] != "result" || events[1] != "done" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	var result scan.Result
+	if err := json.Unmarshal([]byte(data[0]), &result); err != nil || result.Scanner != "TCPDial" {
+		t.Fatalf("unexpected result %s: %v", data[0], err)
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	results := make(chan *scan.Result)
+	for _, sse := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		streamResults(w, w, results, nil, "example.com", time.Millisecond, sse)
+
+		expected := "{\"timeout\":true}\n"
+		if sse {
+			expected = "event: timeout\ndata: {}\n\n"
+		}
+		if body := w.Body.String(); body != expected {
+			t.Fatalf("expected %q after a timeout, have %q", expected, body)
+		}
+	}
+}
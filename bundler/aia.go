@@ -0,0 +1,103 @@
+package bundler
+
+import (
+	"crypto/x509"
+	goerr "errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// A Fetcher retrieves the certificates published at an AIA "CA
+// Issuers" URL. A URL may publish more than one certificate, e.g. as a
+// PKCS #7 (.p7c) bundle.
+type Fetcher interface {
+	Fetch(url string) ([]*x509.Certificate, error)
+}
+
+// AIAFetcher is the fetcher used by bundlers that weren't given one
+// with WithFetcher. It fetches from the network without caching; set
+// it to an AIACache to cache fetched intermediates, or to Offline to
+// stop bundlers from fetching them.
+var AIAFetcher Fetcher = &HTTPFetcher{}
+
+// ErrOffline is returned when fetching an intermediate isn't allowed.
+var ErrOffline = goerr.New("bundler: fetching intermediates is disabled")
+
+type offline struct{}
+
+func (offline) Fetch(url string) ([]*x509.Certificate, error) {
+	return nil, ErrOffline
+}
+
+// Offline is a fetcher that never accesses the network, for tests and
+// air-gapped deployments.
+var Offline Fetcher = offline{}
+
+// maxAIAResponse bounds the size of a response read from an AIA URL.
+const maxAIAResponse = 1 << 20
+
+// HTTPFetcher fetches certificates over HTTP. Responses may be DER or
+// PEM certificates, or PKCS #7 bundles in either encoding.
+type HTTPFetcher struct {
+	// Client is used for requests; http.DefaultClient is used if
+	// it is nil.
+	Client *http.Client
+}
+
+// Fetch retrieves the certificates published at url.
+func (f *HTTPFetcher) Fetch(url string) ([]*x509.Certificate, error) {
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	log.Debugf("fetching remote certificate: %s", url)
+	resp, err := client.Get(url)
+	if err != nil {
+		log.Debugf("failed HTTP get: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bundler: fetching %s failed: %s", url, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAIAResponse))
+	if err != nil {
+		log.Debugf("failed to read response body: %v", err)
+		return nil, err
+	}
+	return parseAIACertificates(data)
+}
+
+// parseAIACertificates parses the certificates in an AIA response,
+// trying DER (including PKCS #7) and then PEM.
+func parseAIACertificates(data []byte) ([]*x509.Certificate, error) {
+	// Plain DER is tried on its own first, since ParseCertificatesDER
+	// trims bytes off the end that may belong to the signature.
+	log.Debugf("attempting to parse certificates as DER")
+	if certs, err := x509.ParseCertificates(data); err == nil && len(certs) > 0 {
+		return certs, nil
+	}
+	certs, _, err := helpers.ParseCertificatesDER(data, "")
+	if err == nil && len(certs) > 0 {
+		return certs, nil
+	}
+
+	log.Debugf("attempting to parse certificates as PEM")
+	certs, err = helpers.ParseCertificatesPEM(data)
+	if err != nil {
+		log.Debugf("failed to parse certificates: %v", err)
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, goerr.New("bundler: no certificates in AIA response")
+	}
+	return certs, nil
+}
@@ -0,0 +1,247 @@
+package bundler
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	goerr "errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// Default lifetimes of AIA cache entries.
+const (
+	DefaultAIATTL         = 24 * time.Hour
+	DefaultAIANegativeTTL = 10 * time.Minute
+)
+
+// aiaIndexFile is the name of the file mapping URLs to certificates
+// in an AIA cache directory.
+const aiaIndexFile = "index.json"
+
+// An aiaEntry is the cached result of fetching a URL: either the
+// hashes of the certificates it published, or the error fetching it.
+type aiaEntry struct {
+	Certs   []string  `json:"certs,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// AIACache is a Fetcher that caches the results of another. Fetched
+// certificates are stored by the SHA-256 hash of their DER encoding,
+// so that URLs publishing the same intermediate share it.
+//
+// A successful fetch is cached for TTL, or until the earliest expiry
+// of the certificates, whichever comes first. A failed fetch is cached
+// for NegativeTTL, so that unreachable URLs aren't retried on every
+// bundle. Fetches that weren't allowed (ErrOffline) aren't cached, and
+// are answered with the certificates of an expired entry if there is
+// one, since nothing newer can be had.
+//
+// If the cache has a directory, certificates and the URL index are
+// kept there as well, and are loaded when the cache is created. A
+// cache directory filled by an online deployment can be used with the
+// Offline fetcher by an air-gapped one.
+type AIACache struct {
+	Fetcher     Fetcher
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	dir     string
+	mu      sync.Mutex
+	entries map[string]*aiaEntry
+	certs   map[string]*x509.Certificate
+	now     func() time.Time
+}
+
+// NewAIACache returns a cache in front of fetcher, kept in dir if it
+// isn't empty. Entries in dir that can't be read are ignored.
+func NewAIACache(fetcher Fetcher, dir string) *AIACache {
+	c := &AIACache{
+		Fetcher:     fetcher,
+		TTL:         DefaultAIATTL,
+		NegativeTTL: DefaultAIANegativeTTL,
+		dir:         dir,
+		entries:     map[string]*aiaEntry{},
+		certs:       map[string]*x509.Certificate{},
+		now:         time.Now,
+	}
+	if dir != "" {
+		c.load()
+	}
+	return c
+}
+
+// NewAIAFetcher returns the fetcher for the -aia-cache and -offline
+// flags: the network, or Offline if offline is true, behind a cache kept
+// in dir if dir isn't empty. Without a directory nothing is cached.
+func NewAIAFetcher(dir string, offline bool) Fetcher {
+	var fetcher Fetcher = &HTTPFetcher{}
+	if offline {
+		fetcher = Offline
+	}
+	if dir == "" {
+		return fetcher
+	}
+	return NewAIACache(fetcher, dir)
+}
+
+func certHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Fetch returns the certificates published at url, from the cache if
+// there is a live entry for it, or an expired one when the fetcher is
+// offline.
+func (c *AIACache) Fetch(url string) ([]*x509.Certificate, error) {
+	if certs, hit, err := c.lookup(url, false); hit {
+		log.Debugf("AIA cache hit for %s", url)
+		return certs, err
+	}
+
+	certs, err := c.Fetcher.Fetch(url)
+	if err == ErrOffline {
+		if certs, hit, _ := c.lookup(url, true); hit && len(certs) > 0 {
+			log.Debugf("offline; using expired AIA cache entry for %s", url)
+			return certs, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entry := &aiaEntry{}
+	if err != nil {
+		entry.Error = err.Error()
+		entry.Expires = now.Add(c.NegativeTTL)
+	} else {
+		entry.Expires = now.Add(c.TTL)
+		for _, cert := range certs {
+			hash := certHash(cert)
+			entry.Certs = append(entry.Certs, hash)
+			if cert.NotAfter.Before(entry.Expires) {
+				entry.Expires = cert.NotAfter
+			}
+			if _, ok := c.certs[hash]; !ok {
+				c.certs[hash] = cert
+				c.storeCert(hash, cert)
+			}
+		}
+	}
+	c.entries[url] = entry
+	c.storeIndex()
+	return certs, err
+}
+
+// lookup returns the cached result for url, if it hasn't expired or
+// expired is true.
+func (c *AIACache) lookup(url string, expired bool) ([]*x509.Certificate, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[url]
+	if !ok || (!expired && !c.now().Before(entry.Expires)) {
+		return nil, false, nil
+	}
+	if entry.Error != "" {
+		return nil, true, goerr.New(entry.Error)
+	}
+
+	var certs []*x509.Certificate
+	for _, hash := range entry.Certs {
+		cert, ok := c.certs[hash]
+		if !ok {
+			return nil, false, nil
+		}
+		certs = append(certs, cert)
+	}
+	return certs, true, nil
+}
+
+// load reads the index and certificates kept in the cache directory,
+// creating it if needed.
+func (c *AIACache) load() {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		log.Warningf("failed to create AIA cache directory %s: %v", c.dir, err)
+		return
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, aiaIndexFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warningf("failed to read AIA cache index: %v", err)
+		}
+		return
+	}
+	if err = json.Unmarshal(data, &c.entries); err != nil {
+		log.Warningf("failed to parse AIA cache index: %v", err)
+		c.entries = map[string]*aiaEntry{}
+		return
+	}
+
+	for _, entry := range c.entries {
+		for _, hash := range entry.Certs {
+			if _, ok := c.certs[hash]; ok {
+				continue
+			}
+			certPEM, err := ioutil.ReadFile(filepath.Join(c.dir, hash+".pem"))
+			if err != nil {
+				log.Debugf("cached intermediate %s is missing: %v", hash, err)
+				continue
+			}
+			cert, err := helpers.ParseCertificatePEM(certPEM)
+			if err != nil || certHash(cert) != hash {
+				log.Warningf("cached intermediate %s is invalid", hash)
+				continue
+			}
+			c.certs[hash] = cert
+		}
+	}
+}
+
+// storeCert writes a certificate to the cache directory. A failure to
+// write only costs a fetch later, so it is logged and ignored.
+func (c *AIACache) storeCert(hash string, cert *x509.Certificate) {
+	if c.dir == "" {
+		return
+	}
+
+	block := pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+	err := ioutil.WriteFile(filepath.Join(c.dir, hash+".pem"), pem.EncodeToMemory(&block), 0644)
+	if err != nil {
+		log.Warningf("failed to cache intermediate: %v", err)
+	}
+}
+
+// storeIndex writes the URL index to the cache directory.
+func (c *AIACache) storeIndex() {
+	if c.dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		log.Warningf("failed to encode AIA cache index: %v", err)
+		return
+	}
+
+	// Write then rename, so that a reader never sees half an index.
+	tmp := filepath.Join(c.dir, aiaIndexFile+".tmp")
+	if err = ioutil.WriteFile(tmp, data, 0644); err == nil {
+		err = os.Rename(tmp, filepath.Join(c.dir, aiaIndexFile))
+	}
+	if err != nil {
+		log.Warningf("failed to write AIA cache index: %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package bundler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	goerr "errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/crypto/pkcs7"
+)
+
+const testAIAURL = "http://aia.example.com/inter.crt"
+
+// testChain is a root, an intermediate and a leaf whose AIA points at
+// testAIAURL for the intermediate.
+type testChain struct {
+	root, inter, leaf *x509.Certificate
+}
+
+func issue(t *testing.T, template, parent *x509.Certificate, pub, priv interface{}) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newTestChain(t *testing.T, interExpiry time.Duration) *testChain {
+	keys := make([]*ecdsa.PrivateKey, 3)
+	for i := range keys {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+
+	now := time.Now()
+	ca := func(serial int64, cn string, expiry time.Duration) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(expiry),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+	}
+
+	c := &testChain{}
+	rootTemplate := ca(1, "AIA Test Root", 10*365*24*time.Hour)
+	c.root = issue(t, rootTemplate, rootTemplate, &keys[0].PublicKey, keys[0])
+	c.inter = issue(t, ca(2, "AIA Test Intermediate", interExpiry), c.root, &keys[1].PublicKey, keys[0])
+	c.leaf = issue(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "aia.example.com"},
+		DNSNames:              []string{"aia.example.com"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IssuingCertificateURL: []string{testAIAURL},
+	}, c.inter, &keys[2].PublicKey, keys[1])
+	return c
+}
+
+// stubFetcher serves fixed responses and counts fetches.
+type stubFetcher struct {
+	certs   map[string][]*x509.Certificate
+	fetches int
+}
+
+func (f *stubFetcher) Fetch(url string) ([]*x509.Certificate, error) {
+	f.fetches++
+	certs, ok := f.certs[url]
+	if !ok {
+		return nil, goerr.New("not found")
+	}
+	return certs, nil
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	c := newTestChain(t, 365*24*time.Hour)
+	p7c, err := pkcs7.MarshalCertificates([]*x509.Certificate{c.inter, c.root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string][]byte{
+		"/inter.der": c.inter.Raw,
+		"/inter.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.inter.Raw}),
+		"/inter.p7c": p7c,
+		"/garbage":   []byte("not a certificate"),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	f := &HTTPFetcher{}
+	for _, path := range []string{"/inter.der", "/inter.pem", "/inter.p7c"} {
+		certs, err := f.Fetch(ts.URL + path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if certs[0].Subject.CommonName != c.inter.Subject.CommonName {
+			t.Fatalf("%s: expected the intermediate, have %s", path, certs[0].Subject.CommonName)
+		}
+	}
+
+	certs, _ := f.Fetch(ts.URL + "/inter.p7c")
+	if len(certs) != 2 {
+		t.Fatalf("expected both certificates from the .p7c, have %d", len(certs))
+	}
+
+	for _, path := range []string{"/garbage", "/missing"} {
+		if _, err := f.Fetch(ts.URL + path); err == nil {
+			t.Fatalf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestAIACache(t *testing.T) {
+	c := newTestChain(t, 2*time.Hour)
+	stub := &stubFetcher{certs: map[string][]*x509.Certificate{testAIAURL: {c.inter}}}
+
+	now := time.Now()
+	cache := NewAIACache(stub, "")
+	cache.TTL = time.Hour
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		certs, err := cache.Fetch(testAIAURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(certs) != 1 || certs[0] != c.inter {
+			t.Fatal("expected the intermediate")
+		}
+	}
+	if stub.fetches != 1 {
+		t.Fatalf("expected a single fetch, have %d", stub.fetches)
+	}
+
+	now = now.Add(time.Hour)
+	cache.Fetch(testAIAURL)
+	if stub.fetches != 2 {
+		t.Fatal("expected the entry to expire after its TTL")
+	}
+
+	// The intermediate expires before the TTL runs out.
+	cache.TTL = 24 * time.Hour
+	now = now.Add(90 * time.Minute)
+	cache.Fetch(testAIAURL)
+	if stub.fetches != 3 {
+		t.Fatal("expected the entry to expire with its certificate")
+	}
+
+	// Failures are cached for the negative TTL.
+	const missing = "http://aia.example.com/missing.crt"
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Fetch(missing); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if stub.fetches != 4 {
+		t.Fatal("expected the failure to be cached")
+	}
+	now = now.Add(cache.NegativeTTL)
+	cache.Fetch(missing)
+	if stub.fetches != 5 {
+		t.Fatal("expected the failure to expire")
+	}
+
+	// Refused fetches aren't cached.
+	offlineCache := NewAIACache(Offline, "")
+	if _, err := offlineCache.Fetch(testAIAURL); err != ErrOffline {
+		t.Fatalf("expected ErrOffline, have %v", err)
+	}
+	if len(offlineCache.entries) != 0 {
+		t.Fatal("expected the refused fetch not to be cached")
+	}
+}
+
+func TestAIACacheDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aia-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newTestChain(t, 365*24*time.Hour)
+	stub := &stubFetcher{certs: map[string][]*x509.Certificate{testAIAURL: {c.inter}}}
+	if _, err = NewAIACache(stub, dir).Fetch(testAIAURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(dir + "/" + certHash(c.inter) + ".pem"); err != nil {
+		t.Fatal("expected the intermediate to be stored by its hash")
+	}
+
+	// An offline cache over the same directory serves the
+	// intermediate without fetching it.
+	certs, err := NewAIAFetcher(dir, true).Fetch(testAIAURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || certs[0].Subject.CommonName != c.inter.Subject.CommonName {
+		t.Fatal("expected the cached intermediate")
+	}
+
+	// It keeps serving it once the entry has expired, since it can't
+	// be fetched again.
+	offline := NewAIAFetcher(dir, true).(*AIACache)
+	offline.now = func() time.Time { return time.Now().Add(offline.TTL + time.Hour) }
+	if certs, err = offline.Fetch(testAIAURL); err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || certs[0].Subject.CommonName != c.inter.Subject.CommonName {
+		t.Fatal("expected the expired intermediate")
+	}
+	if _, err = offline.Fetch("http://aia.example.com/uncached.crt"); err != ErrOffline {
+		t.Fatalf("expected ErrOffline, have %v", err)
+	}
+}
+
+func TestNewAIAFetcher(t *testing.T) {
+	if _, ok := AIAFetcher.(*HTTPFetcher); !ok {
+		t.Fatal("expected the default fetcher not to cache")
+	}
+	if _, ok := NewAIAFetcher("", false).(*HTTPFetcher); !ok {
+		t.Fatal("expected no cache without a cache directory")
+	}
+	if NewAIAFetcher("", true) != Offline {
+		t.Fatal("expected the offline fetcher")
+	}
+}
+
+func TestBundleWithFetcher(t *testing.T) {
+	c := newTestChain(t, 365*24*time.Hour)
+	rootPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.root.Raw})
+
+	stub := &stubFetcher{certs: map[string][]*x509.Certificate{testAIAURL: {c.inter}}}
+	b, err := NewBundlerFromPEM(rootPEM, nil, WithFetcher(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := b.Bundle([]*x509.Certificate{c.leaf}, nil, Optimal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Chain) != 2 || bundle.Chain[1].Subject.CommonName != c.inter.Subject.CommonName {
+		t.Fatal("expected the fetched intermediate in the chain")
+	}
+	if stub.fetches != 1 {
+		t.Fatalf("expected a single fetch, have %d", stub.fetches)
+	}
+
+	b, err = NewBundlerFromPEM(rootPEM, nil, WithFetcher(Offline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Bundle([]*x509.Certificate{c.leaf}, nil, Optimal); err == nil {
+		t.Fatal("expected bundling to fail without fetching the intermediate")
+	}
+}
@@ -14,11 +14,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/cfssl/errors"
@@ -33,6 +33,8 @@ import (
 var IntermediateStash string
 
 // BundleFlavor is named optimization strategy on certificate chain selection when bundling.
+// Besides the flavors defined here and those registered with RegisterFlavor, RankingFlavor returns
+// flavors selecting chains with a ranking pipeline.
 type BundleFlavor string
 
 const (
@@ -48,6 +50,81 @@ const (
 	Force BundleFlavor = "force"
 )
 
+var (
+	flavorsLock sync.RWMutex
+	// flavorPipelines are the ranking pipelines selecting the chains of each flavor but Force.
+	flavorPipelines = map[BundleFlavor]ubiquity.Pipeline{
+		Optimal:    ubiquity.OptimalPipeline,
+		Ubiquitous: ubiquity.UbiquitousPipeline,
+	}
+)
+
+// rankingFlavorPrefix prefixes the pipeline spec of the flavors RankingFlavor returns.
+const rankingFlavorPrefix = "ranking:"
+
+// RegisterFlavor defines a flavor selecting chains with the ranking pipeline p, replacing any
+// previous definition of the flavor. Force can't be redefined.
+func RegisterFlavor(flavor BundleFlavor, p ubiquity.Pipeline) error {
+	if flavor == "" || flavor == Force {
+		return fmt.Errorf("flavor %q can't be registered", flavor)
+	}
+	if len(p) == 0 {
+		return fmt.Errorf("flavor %s has an empty ranking pipeline", flavor)
+	}
+
+	flavorsLock.Lock()
+	defer flavorsLock.Unlock()
+	flavorPipelines[flavor] = p
+	return nil
+}
+
+// FlavorPipeline returns the ranking pipeline of a registered flavor, or of a flavor RankingFlavor
+// returned. Other flavors fall back to Ubiquitous.
+func FlavorPipeline(flavor BundleFlavor) ubiquity.Pipeline {
+	flavorsLock.RLock()
+	p, ok := flavorPipelines[flavor]
+	if !ok {
+		p = flavorPipelines[Ubiquitous]
+	}
+	flavorsLock.RUnlock()
+	if ok {
+		return p
+	}
+
+	if spec := string(flavor); strings.HasPrefix(spec, rankingFlavorPrefix) {
+		if custom, err := ubiquity.ParsePipeline(spec[len(rankingFlavorPrefix):]); err == nil {
+			return custom
+		}
+	}
+	log.Warningf("unknown flavor %s, falling back to %s", flavor, Ubiquitous)
+	return p
+}
+
+// RankingFlavor returns the flavor selecting chains with the ranking pipeline spec instead of the
+// pipeline of flavor, or flavor if spec is empty. Flavor must be Force or registered, and Force
+// bundles aren't ranked. Spec only names registered rankers, and those resolved with
+// ubiquity.ResolvePipeline.
+func RankingFlavor(flavor BundleFlavor, spec string) (BundleFlavor, error) {
+	flavorsLock.RLock()
+	_, ok := flavorPipelines[flavor]
+	flavorsLock.RUnlock()
+	if !ok && flavor != Force {
+		return "", fmt.Errorf("unknown flavor %q", flavor)
+	}
+
+	if spec == "" {
+		return flavor, nil
+	}
+	if flavor == Force {
+		return "", goerr.New("force bundles can't be ranked")
+	}
+	p, err := ubiquity.ParsePipeline(spec)
+	if err != nil {
+		return "", err
+	}
+	return BundleFlavor(rankingFlavorPrefix + p.String()), nil
+}
+
 const (
 	sha2Warning          = "The bundle contains certificates signed with advanced hash functions such as SHA2, which are problematic for certain operating systems, e.g. Windows XP SP2."
 	ecdsaWarning         = "The bundle contains ECDSA signatures, which are problematic for certain operating systems, e.g. Windows XP, Android 2.2 and Android 2.3."
@@ -68,6 +145,7 @@ type Bundler struct {
 
 type options struct {
 	keyUsages []x509.ExtKeyUsage
+	fetcher   Fetcher
 }
 
 var defaultOptions = options{
@@ -87,6 +165,14 @@ func WithKeyUsages(usages ...x509.ExtKeyUsage) Option {
 	}
 }
 
+// WithFetcher sets the fetcher used to retrieve intermediates from
+// AIA URLs. By default AIAFetcher is used.
+func WithFetcher(f Fetcher) Option {
+	return func(o *options) {
+		o.fetcher = f
+	}
+}
+
 // NewBundler creates a new Bundler from the files passed in; these
 // files should contain a list of valid root certificates and a list
 // of valid intermediate certificates, respectively.
@@ -327,40 +413,42 @@ type fetchedIntermediate struct {
 	Name string
 }
 
-// fetchRemoteCertificate retrieves a single URL pointing to a certificate
-// and attempts to first parse it as a DER-encoded certificate; if
-// this fails, it attempts to decode it as a PEM-encoded certificate.
-func fetchRemoteCertificate(certURL string) (fi *fetchedIntermediate, err error) {
-	log.Debugf("fetching remote certificate: %s", certURL)
-	var resp *http.Response
-	resp, err = http.Get(certURL)
-	if err != nil {
-		log.Debugf("failed HTTP get: %v", err)
-		return
+// fetcher returns the fetcher used to retrieve intermediates.
+func (b *Bundler) fetcher() Fetcher {
+	if b.opts.fetcher != nil {
+		return b.opts.fetcher
 	}
+	return AIAFetcher
+}
 
-	defer resp.Body.Close()
-	var certData []byte
-	certData, err = ioutil.ReadAll(resp.Body)
+// fetchIssuer retrieves the certificates at an AIA URL and returns the
+// one that issued cert, or else the first one that isn't in seen.
+func (b *Bundler) fetchIssuer(cert *x509.Certificate, certURL string, seen map[string]bool) (*fetchedIntermediate, error) {
+	certs, err := b.fetcher().Fetch(certURL)
 	if err != nil {
-		log.Debugf("failed to read response body: %v", err)
-		return
+		log.Debugf("failed to fetch %s: %v", certURL, err)
+		return nil, err
 	}
 
-	log.Debugf("attempting to parse certificate as DER")
-	crt, err := x509.ParseCertificate(certData)
-	if err != nil {
-		log.Debugf("attempting to parse certificate as PEM")
-		crt, err = helpers.ParseCertificatePEM(certData)
-		if err != nil {
-			log.Debugf("failed to parse certificate: %v", err)
-			return
+	var issuer *x509.Certificate
+	for _, c := range certs {
+		if seen[string(c.Signature)] {
+			continue
+		}
+		if cert.CheckSignatureFrom(c) == nil {
+			issuer = c
+			break
 		}
+		if issuer == nil {
+			issuer = c
+		}
+	}
+	if issuer == nil {
+		return nil, nil
 	}
 
 	log.Debugf("certificate fetch succeeds")
-	fi = &fetchedIntermediate{Cert: crt, Name: constructCertFileName(crt)}
-	return
+	return &fetchedIntermediate{Cert: issuer, Name: constructCertFileName(issuer)}, nil
 }
 
 func reverse(certs []*x509.Certificate) []*x509.Certificate {
@@ -529,11 +617,11 @@ func (b *Bundler) fetchIntermediates(certs []*x509.Certificate) (err error) {
 				log.Debugf("url %s has been seen", url)
 				continue
 			}
-			crt, err := fetchRemoteCertificate(url)
+			crt, err := b.fetchIssuer(current.Cert, url, seen)
 			if err != nil {
 				continue
-			} else if seen[string(crt.Cert.Signature)] {
-				log.Debugf("fetched certificate is known")
+			} else if crt == nil {
+				log.Debugf("fetched certificates are known")
 				continue
 			}
 			seen[url] = true
@@ -649,17 +737,12 @@ func (b *Bundler) Bundle(certs []*x509.Certificate, key crypto.Signer, flavor Bu
 			}
 			log.Debugf("verify ok")
 		}
-		var matchingChains [][]*x509.Certificate
-		switch flavor {
-		case Optimal:
-			matchingChains = optimalChains(chains)
-		case Ubiquitous:
-			if len(ubiquity.Platforms) == 0 {
-				log.Warning("No metadata, Ubiquitous falls back to Optimal.")
-			}
-			matchingChains = ubiquitousChains(chains)
-		default:
-			matchingChains = ubiquitousChains(chains)
+		if flavor == Ubiquitous && len(ubiquity.Platforms) == 0 {
+			log.Warning("No metadata, Ubiquitous falls back to Optimal.")
+		}
+		matchingChains, err := FlavorPipeline(flavor).Filter(chains)
+		if err != nil {
+			return nil, errors.Wrap(errors.CertificateError, errors.Unknown, err)
 		}
 
 		bundle.Chain = matchingChains[0]
@@ -792,36 +875,6 @@ func untrustedPlatformsWarning(platforms []string) string {
 	return msg
 }
 
-// Optimal chains are the shortest chains, with newest intermediates and most advanced crypto suite being the tie breaker.
-func optimalChains(chains [][]*x509.Certificate) [][]*x509.Certificate {
-	// Find shortest chains
-	chains = ubiquity.Filter(chains, ubiquity.CompareChainLength)
-	// Find the chains with longest expiry.
-	chains = ubiquity.Filter(chains, ubiquity.CompareChainExpiry)
-	// Find the chains with more advanced crypto suite
-	chains = ubiquity.Filter(chains, ubiquity.CompareChainCryptoSuite)
-
-	return chains
-}
-
-// Ubiquitous chains are the chains with highest platform coverage and break ties with the optimal strategy.
-func ubiquitousChains(chains [][]*x509.Certificate) [][]*x509.Certificate {
-	// Filter out chains with highest cross platform ubiquity.
-	chains = ubiquity.Filter(chains, ubiquity.ComparePlatformUbiquity)
-	// Prefer that all intermediates are SHA-2 certs if the leaf is a SHA-2 cert, in order to improve ubiquity.
-	chains = ubiquity.Filter(chains, ubiquity.CompareSHA2Homogeneity)
-	// Filter shortest chains
-	chains = ubiquity.Filter(chains, ubiquity.CompareChainLength)
-	// Filter chains with highest signature hash ubiquity.
-	chains = ubiquity.Filter(chains, ubiquity.CompareChainHashUbiquity)
-	// Filter chains with highest keyAlgo ubiquity.
-	chains = ubiquity.Filter(chains, ubiquity.CompareChainKeyAlgoUbiquity)
-	// Filter chains with intermediates that last longer.
-	chains = ubiquity.Filter(chains, ubiquity.CompareExpiryUbiquity)
-	// Use the optimal strategy as final tie breaker.
-	return optimalChains(chains)
-}
-
 // diff checkes if two input cert chains are not identical
 func diff(chain1, chain2 []*x509.Certificate) bool {
 	// Check if bundled one is different from the input.
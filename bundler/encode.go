@@ -0,0 +1,53 @@
+package bundler
+
+import (
+	goerr "errors"
+
+	"github.com/cloudflare/cfssl/crypto/jks"
+	"github.com/cloudflare/cfssl/crypto/pkcs12"
+	"github.com/cloudflare/cfssl/crypto/pkcs7"
+	"github.com/cloudflare/cfssl/errors"
+)
+
+// Encodings a bundle can be written in.
+const (
+	// FormatJSON is the JSON bundle returned by MarshalJSON.
+	FormatJSON = "json"
+
+	// FormatPKCS7 is a DER-encoded, certificates-only PKCS #7
+	// structure holding the chain.
+	FormatPKCS7 = "pkcs7"
+
+	// FormatPKCS12 is a password-protected PKCS #12 file holding
+	// the chain and the private key, if the bundle has one.
+	FormatPKCS12 = "pkcs12"
+
+	// FormatJKS is a Java keystore holding the chain and the
+	// private key, if the bundle has one.
+	FormatJKS = "jks"
+)
+
+// KeystoreAlias is the alias of the entries in JKS bundles.
+var KeystoreAlias = "cfssl"
+
+// Encode returns the bundle in the given format. The private key is
+// only included in PKCS #12 and JKS bundles, which are protected with
+// password.
+func (b *Bundle) Encode(format, password string) ([]byte, error) {
+	if b == nil || b.Cert == nil {
+		return nil, goerr.New("no certificate in bundle")
+	}
+
+	switch format {
+	case "", FormatJSON:
+		return b.MarshalJSON()
+	case FormatPKCS7:
+		return pkcs7.MarshalCertificates(b.Chain)
+	case FormatPKCS12:
+		return pkcs12.Encode(b.Key, b.Chain, password)
+	case FormatJKS:
+		return jks.Encode(b.Key, b.Chain, KeystoreAlias, password)
+	default:
+		return nil, errors.Wrap(errors.CertificateError, errors.BadRequest, goerr.New("unknown bundle format "+format))
+	}
+}
@@ -0,0 +1,96 @@
+package bundler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"golang.org/x/crypto/pkcs12"
+)
+
+func TestBundleEncode(t *testing.T) {
+	// The chain is built by hand, as the test certificates have
+	// expired and wouldn't verify.
+	chainPEM, err := ioutil.ReadFile(leafECDSA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intPEM, err := ioutil.ReadFile(testCFSSLIntBundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := helpers.ParseCertificatesPEM(append(chainPEM, intPEM...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := ioutil.ReadFile(leafKeyECDSA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := &Bundle{
+		Chain:   chain,
+		Cert:    chain[0],
+		Key:     key,
+		Issuer:  &chain[0].Issuer,
+		Subject: &chain[0].Subject,
+	}
+
+	out, err := bundle.Encode(FormatJSON, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj map[string]interface{}
+	if err = json.Unmarshal(out, &obj); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = bundle.Encode(FormatPKCS7, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, _, err := helpers.ParseCertificatesDER(out, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != len(bundle.Chain) {
+		t.Fatalf("expected %d certificates, have %d", len(bundle.Chain), len(certs))
+	}
+	for i := range certs {
+		if !bytes.Equal(certs[i].Raw, bundle.Chain[i].Raw) {
+			t.Fatalf("certificate %d doesn't match the chain", i)
+		}
+	}
+
+	out, err = bundle.Encode(FormatPKCS12, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := pkcs12.ToPEM(out, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != len(bundle.Chain)+1 {
+		t.Fatalf("expected the chain and the key, have %d blocks", len(blocks))
+	}
+
+	out, err = bundle.Encode(FormatJKS, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, []byte{0xfe, 0xed, 0xfe, 0xed}) {
+		t.Fatal("expected a JKS keystore")
+	}
+
+	if _, err = bundle.Encode(FormatPKCS12, ""); err == nil {
+		t.Fatal("expected a PKCS #12 bundle without a password to be refused")
+	}
+	if _, err = bundle.Encode("der", ""); err == nil {
+		t.Fatal("expected an unknown format to be refused")
+	}
+}
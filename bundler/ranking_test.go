@@ -0,0 +1,142 @@
+package bundler
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/ubiquity"
+)
+
+// newCrossSignedBundler returns a bundler that can chain c's leaf to its root directly, or through
+// an intermediate cross-signed by another root, and that other root.
+func newCrossSignedBundler(t *testing.T, c *testChain) (*Bundler, *x509.Certificate) {
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	ca := func(serial int64, cn string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+	}
+
+	crossRootTemplate := ca(10, "Cross Test Root")
+	crossRoot := issue(t, crossRootTemplate, crossRootTemplate, &keys[0].PublicKey, keys[0])
+	crossInter := issue(t, ca(11, "Cross Test Intermediate"), crossRoot, &keys[1].PublicKey, keys[0])
+	crossTemplate := ca(12, c.inter.Subject.CommonName)
+	crossSigned := issue(t, crossTemplate, crossInter, c.inter.PublicKey, keys[1])
+
+	var roots, inters bytes.Buffer
+	for _, cert := range []*x509.Certificate{c.root, crossRoot} {
+		pem.Encode(&roots, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	for _, cert := range []*x509.Certificate{c.inter, crossInter, crossSigned} {
+		pem.Encode(&inters, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	b, err := NewBundlerFromPEM(roots.Bytes(), inters.Bytes(), WithFetcher(Offline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, crossRoot
+}
+
+func TestBundleRanking(t *testing.T) {
+	c := newTestChain(t, 365*24*time.Hour)
+	b, crossRoot := newCrossSignedBundler(t, c)
+
+	bundle, err := b.Bundle([]*x509.Certificate{c.leaf}, nil, Ubiquitous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Chain) != 2 || !bundle.Root.Equal(c.root) {
+		t.Fatalf("expected the short chain, have %d certificates to %s", len(bundle.Chain), bundle.Root.Subject.CommonName)
+	}
+
+	if err = ubiquity.RegisterRanker("via-cross-test-root", ubiquity.ChainThrough(crossRoot)); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ubiquity.ParsePipeline("via-cross-test-root,length")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = RegisterFlavor("cross", p); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err = b.Bundle([]*x509.Certificate{c.leaf}, nil, "cross")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Chain) != 3 || !bundle.Root.Equal(crossRoot) {
+		t.Fatalf("expected the cross-signed chain, have %d certificates to %s", len(bundle.Chain), bundle.Root.Subject.CommonName)
+	}
+
+	// RankingFlavor selects chains with a pipeline spec.
+	flavor, err := RankingFlavor(Optimal, "length:1+via-cross-test-root:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle, err = b.Bundle([]*x509.Certificate{c.leaf}, nil, flavor); err != nil || !bundle.Root.Equal(crossRoot) {
+		t.Fatalf("expected the cross-signed chain, have %v %v", bundle, err)
+	}
+	if flavor, err = RankingFlavor(Optimal, "via-cross-test-root:1+length:2"); err != nil {
+		t.Fatal(err)
+	}
+	if bundle, err = b.Bundle([]*x509.Certificate{c.leaf}, nil, flavor); err != nil || !bundle.Root.Equal(c.root) {
+		t.Fatalf("expected the short chain, have %v %v", bundle, err)
+	}
+}
+
+func TestFlavorPipeline(t *testing.T) {
+	if FlavorPipeline(Optimal).String() != ubiquity.OptimalPipeline.String() {
+		t.Fatalf("unexpected optimal pipeline %s", FlavorPipeline(Optimal))
+	}
+	if FlavorPipeline("unknown").String() != ubiquity.UbiquitousPipeline.String() {
+		t.Fatalf("expected unknown flavors to fall back to ubiquitous, have %s", FlavorPipeline("unknown"))
+	}
+	if FlavorPipeline("expiry,length").String() != ubiquity.UbiquitousPipeline.String() {
+		t.Fatalf("expected pipeline specs not to be flavors, have %s", FlavorPipeline("expiry,length"))
+	}
+	if flavor, err := RankingFlavor(Optimal, "expiry,length"); err != nil || FlavorPipeline(flavor).String() != "expiry,length" {
+		t.Fatalf("unexpected pipeline of %s %v", flavor, err)
+	}
+
+	if err := RegisterFlavor(Force, ubiquity.OptimalPipeline); err == nil {
+		t.Fatal("expected an error redefining force")
+	}
+	if err := RegisterFlavor("empty", nil); err == nil {
+		t.Fatal("expected an error for an empty pipeline")
+	}
+
+	if flavor, err := RankingFlavor(Ubiquitous, ""); err != nil || flavor != Ubiquitous {
+		t.Fatalf("unexpected flavor %s %v", flavor, err)
+	}
+	for _, flavor := range []BundleFlavor{"unknown", "expiry,length", "ranking:length"} {
+		if _, err := RankingFlavor(flavor, ""); err == nil {
+			t.Fatalf("%s: expected an error for an unknown flavor", flavor)
+		}
+	}
+	if _, err := RankingFlavor(Force, "length"); err == nil {
+		t.Fatal("expected an error ranking force bundles")
+	}
+	if _, err := RankingFlavor(Optimal, "shortest"); err == nil {
+		t.Fatal("expected an error for an unknown ranker")
+	}
+}
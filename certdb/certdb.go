@@ -15,6 +15,10 @@ type CertificateRecord struct {
 	Expiry    time.Time `db:"expiry"`
 	RevokedAt time.Time `db:"revoked_at"`
 	PEM       string    `db:"pem"`
+	Profile   string    `db:"profile"`
+	// SupersededBy is the serial number of the certificate that
+	// renewed this one. The successor shares this record's AKI.
+	SupersededBy string `db:"superseded_by"`
 }
 
 // OCSPRecord encodes a OCSP response body and its metadata
@@ -34,6 +38,7 @@ type Accessor interface {
 	GetRevokedAndUnexpiredCertificates() ([]CertificateRecord, error)
 	GetRevokedAndUnexpiredCertificatesByLabel(label string) ([]CertificateRecord, error)
 	RevokeCertificate(serial, aki string, reasonCode int) error
+	SupersedeCertificate(serial, aki, successor string) error
 	InsertOCSP(rr OCSPRecord) error
 	GetOCSP(serial, aki string) ([]OCSPRecord, error)
 	GetUnexpiredOCSPs() ([]OCSPRecord, error)
@@ -0,0 +1,11 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN profile varbinary(128) NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN superseded_by varbinary(128) NOT NULL DEFAULT '';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+ALTER TABLE certificates DROP COLUMN superseded_by;
+ALTER TABLE certificates DROP COLUMN profile;
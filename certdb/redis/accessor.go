@@ -28,6 +28,16 @@ const revokedStatus string = "revoked"
 
 const certKeyPrefix string = "cert"
 
+// supersedeScript sets the superseded field of an existing certificate
+// hash only if it is still empty, so that concurrent renewals of the
+// same certificate cannot both succeed.
+const supersedeScript = `
+if redis.call("EXISTS", KEYS[1]) == 0 then return 0 end
+local cur = redis.call("HGET", KEYS[1], ARGV[1])
+if cur and cur ~= "" then return 0 end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return 1`
+
 func certKeyFromCertRec(cr *certdb.CertificateRecord) string {
 	return certKeyPrefix + ":" + cr.Serial + ":" + cr.AKI
 }
@@ -47,15 +57,17 @@ func ocspKeyFromSerialAKI(serial, aki string) string {
 }
 
 const (
-	serialField    string = "serial_number"
-	akiField       string = "authority_key_identifier"
-	calabelField   string = "ca_label"
-	statusField    string = "status"
-	reasonField    string = "reason"
-	expiryField    string = "expiry"
-	revokedatField string = "revoked_at"
-	pemField       string = "pem"
-	bodyField      string = "body"
+	serialField     string = "serial_number"
+	akiField        string = "authority_key_identifier"
+	calabelField    string = "ca_label"
+	statusField     string = "status"
+	reasonField     string = "reason"
+	expiryField     string = "expiry"
+	revokedatField  string = "revoked_at"
+	pemField        string = "pem"
+	bodyField       string = "body"
+	profileField    string = "profile"
+	supersededField string = "superseded_by"
 )
 
 // NewAccessor returns a new Accessor.
@@ -110,6 +122,8 @@ func (a *Accessor) InsertCertificate(cr certdb.CertificateRecord) error {
 	crmap[expiryField] = cr.Expiry.Format(time.RFC3339)
 	crmap[revokedatField] = cr.RevokedAt.Format(time.RFC3339)
 	crmap[pemField] = cr.PEM
+	crmap[profileField] = cr.Profile
+	crmap[supersededField] = cr.SupersededBy
 
 	err = a.db.HMSet(key, crmap).Err()
 
@@ -152,14 +166,16 @@ func (a *Accessor) GetCertificate(serial, aki string) ([]certdb.CertificateRecor
 	}
 
 	cr := certdb.CertificateRecord{
-		Serial:    crmap[serialField],
-		AKI:       crmap[akiField],
-		CALabel:   crmap[calabelField],
-		Status:    crmap[statusField],
-		Reason:    reason,
-		Expiry:    expiry,
-		RevokedAt: revat,
-		PEM:       crmap[pemField],
+		Serial:       crmap[serialField],
+		AKI:          crmap[akiField],
+		CALabel:      crmap[calabelField],
+		Status:       crmap[statusField],
+		Reason:       reason,
+		Expiry:       expiry,
+		RevokedAt:    revat,
+		PEM:          crmap[pemField],
+		Profile:      crmap[profileField],
+		SupersededBy: crmap[supersededField],
 	}
 
 	if err != nil {
@@ -240,14 +256,16 @@ func (a *Accessor) getCertificates(filter filterType, va ...string) ([]certdb.Ce
 		}
 
 		rec := certdb.CertificateRecord{
-			Serial:    crmap[serialField],
-			AKI:       crmap[akiField],
-			CALabel:   crmap[calabelField],
-			Status:    crmap[statusField],
-			Reason:    reason,
-			Expiry:    expiry,
-			RevokedAt: revat,
-			PEM:       crmap[pemField],
+			Serial:       crmap[serialField],
+			AKI:          crmap[akiField],
+			CALabel:      crmap[calabelField],
+			Status:       crmap[statusField],
+			Reason:       reason,
+			Expiry:       expiry,
+			RevokedAt:    revat,
+			PEM:          crmap[pemField],
+			Profile:      crmap[profileField],
+			SupersededBy: crmap[supersededField],
 		}
 		recs = append(recs, rec)
 	}
@@ -296,6 +314,28 @@ func (a *Accessor) RevokeCertificate(serial, aki string, reasonCode int) error {
 	return nil
 }
 
+// SupersedeCertificate records successor as the serial number of the
+// certificate that renewed the certificate with the given serial and aki.
+// It fails if that certificate has already been superseded.
+func (a *Accessor) SupersedeCertificate(serial, aki, successor string) error {
+	err := a.checkDB()
+	if err != nil {
+		return err
+	}
+	key := certKeyFromSerialAKI(serial, aki)
+
+	n, err := a.db.Eval(supersedeScript, []string{key}, supersededField, successor).Int64()
+	if err != nil {
+		return wrapError(err)
+	}
+	if n == 0 {
+		return cferr.Wrap(cferr.CertStoreError, cferr.RecordNotFound,
+			errors.New("failed to supersede the certificate: certificate not found or already superseded"))
+	}
+
+	return nil
+}
+
 // InsertOCSP puts a new certdb.OCSPRecord into the db.
 func (a *Accessor) InsertOCSP(rr certdb.OCSPRecord) error {
 	err := a.checkDB()
@@ -19,8 +19,8 @@ func init() {
 
 const (
 	insertSQL = `
-INSERT INTO certificates (serial_number, authority_key_identifier, ca_label, status, reason, expiry, revoked_at, pem)
-	VALUES (:serial_number, :authority_key_identifier, :ca_label, :status, :reason, :expiry, :revoked_at, :pem);`
+INSERT INTO certificates (serial_number, authority_key_identifier, ca_label, status, reason, expiry, revoked_at, pem, profile, superseded_by)
+	VALUES (:serial_number, :authority_key_identifier, :ca_label, :status, :reason, :expiry, :revoked_at, :pem, :profile, :superseded_by);`
 
 	selectSQL = `
 SELECT %s FROM certificates
@@ -43,6 +43,11 @@ UPDATE certificates
 	SET status='revoked', revoked_at=CURRENT_TIMESTAMP, reason=:reason
 	WHERE (serial_number = :serial_number AND authority_key_identifier = :authority_key_identifier);`
 
+	updateSupersedeSQL = `
+UPDATE certificates
+	SET superseded_by=:superseded_by
+	WHERE (serial_number = :serial_number AND authority_key_identifier = :authority_key_identifier AND superseded_by = '');`
+
 	insertOCSPSQL = `
 INSERT INTO ocsp_responses (serial_number, authority_key_identifier, body, expiry)
   VALUES (:serial_number, :authority_key_identifier, :body, :expiry);`
@@ -100,14 +105,16 @@ func (d *Accessor) InsertCertificate(cr certdb.CertificateRecord) error {
 	}
 
 	res, err := d.db.NamedExec(insertSQL, &certdb.CertificateRecord{
-		Serial:    cr.Serial,
-		AKI:       cr.AKI,
-		CALabel:   cr.CALabel,
-		Status:    cr.Status,
-		Reason:    cr.Reason,
-		Expiry:    cr.Expiry.UTC(),
-		RevokedAt: cr.RevokedAt.UTC(),
-		PEM:       cr.PEM,
+		Serial:       cr.Serial,
+		AKI:          cr.AKI,
+		CALabel:      cr.CALabel,
+		Status:       cr.Status,
+		Reason:       cr.Reason,
+		Expiry:       cr.Expiry.UTC(),
+		RevokedAt:    cr.RevokedAt.UTC(),
+		PEM:          cr.PEM,
+		Profile:      cr.Profile,
+		SupersededBy: cr.SupersededBy,
 	})
 	if err != nil {
 		return wrapSQLError(err)
@@ -215,6 +222,37 @@ func (d *Accessor) RevokeCertificate(serial, aki string, reasonCode int) error {
 	return err
 }
 
+// SupersedeCertificate records successor as the serial number of the
+// certificate that renewed the certificate with the given serial and aki.
+// It fails if that certificate has already been superseded.
+func (d *Accessor) SupersedeCertificate(serial, aki, successor string) error {
+	err := d.checkDB()
+	if err != nil {
+		return err
+	}
+
+	result, err := d.db.NamedExec(updateSupersedeSQL, &certdb.CertificateRecord{
+		AKI:          aki,
+		Serial:       serial,
+		SupersededBy: successor,
+	})
+	if err != nil {
+		return wrapSQLError(err)
+	}
+
+	numRowsAffected, err := result.RowsAffected()
+
+	if numRowsAffected == 0 {
+		return cferr.Wrap(cferr.CertStoreError, cferr.RecordNotFound, fmt.Errorf("failed to supersede the certificate: certificate not found or already superseded"))
+	}
+
+	if numRowsAffected != 1 {
+		return wrapSQLError(fmt.Errorf("%d rows are affected, should be 1 row", numRowsAffected))
+	}
+
+	return err
+}
+
 // InsertOCSP puts a new certdb.OCSPRecord into the db.
 func (d *Accessor) InsertOCSP(rr certdb.OCSPRecord) error {
 	err := d.checkDB()
@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+ALTER TABLE certificates ADD COLUMN profile blob NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN superseded_by blob NOT NULL DEFAULT '';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- SQLite cannot drop columns; the added columns are left in place.
@@ -0,0 +1,93 @@
+// Package agent implements the agent command.
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/cloudflare/cfssl/agent"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/transport"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+var agentUsageText = `cfssl agent -- keep a certificate, key and trust bundle fresh on disk
+
+Usage of agent:
+        cfssl agent -identity identity.json [-before 24h] [-trust-bundle file] \
+                    [-exec command] [-pid-file file [-signal HUP]] [-status-socket path] \
+                    [-reload-interval interval]
+
+The identity is a transport identity; its "paths" profile names the key
+and certificate files, and its "cfssl" profile the CA to request
+certificates from. The agent renews the certificate before it expires and,
+after each rotation, writes the trusted roots to the trust bundle, runs
+the command with "sh -c" and signals the process in the PID file. The
+trust bundle is also written when the agent starts, and the trusted roots
+are reloaded every -reload-interval (hourly by default); when they change,
+the trust bundle is rewritten and the command run and process signalled.
+
+With -status-socket, GET /health on the socket returns 200 while the agent
+holds a valid certificate and 503 otherwise; GET /status returns details.
+
+Flags:
+`
+
+var agentFlags = []string{"identity", "before", "trust-bundle", "exec", "pid-file", "signal", "status-socket", "reload-interval"}
+
+func agentMain(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	if c.IdentityFile == "" {
+		return errors.New("need an identity file (provide with -identity)")
+	}
+
+	data, err := ioutil.ReadFile(c.IdentityFile)
+	if err != nil {
+		return err
+	}
+
+	var id core.Identity
+	if err = json.Unmarshal(data, &id); err != nil {
+		return err
+	}
+
+	tr, err := transport.New(c.Before, &id)
+	if err != nil {
+		return err
+	}
+
+	opts := agent.Options{
+		BundleFile:   c.TrustBundleFile,
+		RootsRefresh: c.ReloadInterval,
+		Command:      c.Exec,
+		PIDFile:      c.PIDFile,
+	}
+	if c.PIDFile != "" {
+		if opts.Signal, err = agent.ParseSignal(c.Signal); err != nil {
+			return err
+		}
+	}
+
+	a, err := agent.New(tr, opts)
+	if err != nil {
+		return err
+	}
+
+	if c.StatusSocket != "" {
+		go func() {
+			if err := a.ServeStatus(c.StatusSocket); err != nil {
+				log.Errorf("agent: status socket failed: %v", err)
+			}
+		}()
+	}
+
+	return a.Run()
+}
+
+// Command assembles the definition of Command 'agent'
+var Command = &cli.Command{UsageText: agentUsageText, Flags: agentFlags, Main: agentMain}
@@ -0,0 +1,21 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestAgentMainBadArgs(t *testing.T) {
+	if err := agentMain([]string{}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for a missing identity")
+	}
+
+	if err := agentMain([]string{}, cli.Config{IdentityFile: "testdata/missing.json"}); err == nil {
+		t.Fatal("expected an error for a missing identity file")
+	}
+
+	if err := agentMain([]string{"a"}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for extra arguments")
+	}
+}
@@ -3,7 +3,7 @@ package bundle
 
 import (
 	"errors"
-	"fmt"
+	"os"
 
 	"github.com/cloudflare/cfssl/bundler"
 	"github.com/cloudflare/cfssl/cli"
@@ -15,21 +15,51 @@ var bundlerUsageText = `cfssl bundle -- create a certificate bundle that contain
 
 Usage of bundle:
 	- Bundle local certificate files
-        cfssl bundle -cert file [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-metadata file] [-key keyfile] [-flavor optimal|ubiquitous|force] [-password password]
+        cfssl bundle -cert file [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-aia-cache dir] [-offline] [-metadata file] [-key keyfile] [-flavor optimal|ubiquitous|force] [-ranking pipeline] [-password password] [-format json|pkcs7|pkcs12|jks] [-bundle-password password]
 	- Bundle certificate from remote server.
-        cfssl bundle -domain domain_name [-ip ip_address] [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-metadata file]
+        cfssl bundle -domain domain_name [-ip ip_address] [-ca-bundle file] [-int-bundle file] [-int-dir dir] [-aia-cache dir] [-offline] [-metadata file] [-flavor optimal|ubiquitous] [-ranking pipeline] [-format json|pkcs7|pkcs12|jks] [-bundle-password password]
+
+The pkcs7, pkcs12 and jks formats are written to stdout as DER. The
+pkcs12 and jks formats include the private key given with -key, and
+are protected with -bundle-password.
+
+Missing intermediates are fetched from the AIA URLs of the certificates.
+With -aia-cache, fetched intermediates are kept in a directory and reused
+until they expire; with -offline, only intermediates already in the cache
+are used.
+
+With -ranking, chains are selected by a ranking pipeline instead of the
+flavor's: comma separated stages, each keeping the chains ranked highest
+by one or more rankers joined by "+" and weighted with ":weight". The
+rankers are platform, sha2-homogeneity, length, hash-ubiquity,
+key-algo-ubiquity, expiry-ubiquity, expiry, crypto-suite, hash-priority
+and key-algo-priority. chain-through=file ranks chains through the PEM
+certificate in file above the others, and chain-size-under=bytes ranks
+chains whose certificates, without the root, are smaller than bytes above
+the others and smaller ones higher. The ubiquitous flavor is
+platform,sha2-homogeneity,length,hash-ubiquity,key-algo-ubiquity,expiry-ubiquity,length,expiry,crypto-suite
+and the optimal flavor is length,expiry,crypto-suite.
 
 Flags:
 `
 
 // flags used by 'cfssl bundle'
-var bundlerFlags = []string{"cert", "key", "ca-bundle", "int-bundle", "flavor", "int-dir", "metadata", "domain", "ip", "password"}
+var bundlerFlags = []string{"cert", "key", "ca-bundle", "int-bundle", "flavor", "ranking", "int-dir", "aia-cache", "offline", "metadata", "domain", "ip", "password", "format", "bundle-password"}
 
 // bundlerMain is the main CLI of bundler functionality.
 func bundlerMain(args []string, c cli.Config) (err error) {
 	bundler.IntermediateStash = c.IntDir
+	bundler.AIAFetcher = bundler.NewAIAFetcher(c.AIACacheDir, c.Offline)
 	ubiquity.LoadPlatforms(c.Metadata)
-	flavor := bundler.BundleFlavor(c.Flavor)
+	if c.Ranking != "" {
+		if _, err = ubiquity.ResolvePipeline(c.Ranking); err != nil {
+			return
+		}
+	}
+	flavor, err := bundler.RankingFlavor(bundler.BundleFlavor(c.Flavor), c.Ranking)
+	if err != nil {
+		return
+	}
 	var b *bundler.Bundler
 	// If it is a force bundle, don't require ca bundle and intermediate bundle
 	// Otherwise, initialize a bundler with CA bundle and intermediate bundle.
@@ -76,11 +106,11 @@ func bundlerMain(args []string, c cli.Config) (err error) {
 		return errors.New("Must specify bundle target through -cert or -domain")
 	}
 
-	marshaled, err := bundle.MarshalJSON()
+	encoded, err := bundle.Encode(c.Format, c.BundlePassword)
 	if err != nil {
 		return
 	}
-	fmt.Printf("%s", marshaled)
+	_, err = os.Stdout.Write(encoded)
 	return
 }
 
@@ -31,14 +31,23 @@ type Config struct {
 	Address           string
 	Port              int
 	Password          string
+	BundlePassword    string
 	ConfigFile        string
 	CFG               *config.Config
 	Profile           string
 	IsCA              bool
 	RenewCA           bool
 	IntDir            string
+	IntermediateDir   string
+	AIACacheDir       string
+	Offline           bool
 	Flavor            string
+	Ranking           string
 	Metadata          string
+	Platform          string
+	Weight            int
+	HashAlgo          string
+	KeyAlgo           string
 	Domain            string
 	IP                string
 	Remote            string
@@ -57,6 +66,13 @@ type Config struct {
 	CSVFile           string
 	NumWorkers        int
 	MaxHosts          int
+	CTLogListFile     string
+	CTMinLogs         int
+	CTMinOperators    int
+	ResultsDir        string
+	ResultsDBConfig   string
+	Diff              bool
+	FromCertDB        bool
 	Responses         string
 	Path              string
 	CRL               string
@@ -68,6 +84,20 @@ type Config struct {
 	AKI               string
 	DBConfigFile      string
 	CRLExpiration     time.Duration
+	SignatureFile     string
+	Revoke            bool
+	Within            string
+	Format            string
+	StateFile         string
+	IssuerOnly        bool
+	ReloadInterval    time.Duration
+	IdentityFile      string
+	Before            time.Duration
+	TrustBundleFile   string
+	Exec              string
+	PIDFile           string
+	Signal            string
+	StatusSocket      string
 }
 
 // registerFlags defines all cfssl command flags and associates their values with variables.
@@ -95,8 +125,16 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.BoolVar(&c.IsCA, "initca", false, "initialise new CA")
 	f.BoolVar(&c.RenewCA, "renewca", false, "re-generate a CA certificate from existing CA certificate/key")
 	f.StringVar(&c.IntDir, "int-dir", "", "specify intermediates directory")
+	f.StringVar(&c.IntermediateDir, "intermediate-dir", "", "directory to keep intermediates created through the newintermediate endpoint in; the endpoint is disabled unless set")
+	f.StringVar(&c.AIACacheDir, "aia-cache", "", "directory to cache intermediates fetched from AIA URLs in")
+	f.BoolVar(&c.Offline, "offline", false, "don't fetch intermediates from AIA URLs; only use those already cached")
 	f.StringVar(&c.Flavor, "flavor", "ubiquitous", "Bundle Flavor: ubiquitous, optimal and force.")
+	f.StringVar(&c.Ranking, "ranking", "", "chain ranking pipeline replacing the flavor's, e.g. platform,length:2+expiry,crypto-suite")
 	f.StringVar(&c.Metadata, "metadata", "", "Metadata file for root certificate presence. The content of the file is a json dictionary (k,v): each key k is SHA-1 digest of a root certificate while value v is a list of key store filenames.")
+	f.StringVar(&c.Platform, "platform", "", "name of the platform to import a trust store as")
+	f.IntVar(&c.Weight, "weight", 1, "weight of the imported platform in ubiquity scoring")
+	f.StringVar(&c.HashAlgo, "hash-algo", "SHA2", "strongest hash algorithm the imported platform supports: SHA1 or SHA2")
+	f.StringVar(&c.KeyAlgo, "key-algo", "ECDSA256", "strongest key algorithm the imported platform supports: RSA, ECDSA256, ECDSA384 or ECDSA521")
 	f.StringVar(&c.Domain, "domain", "", "remote server domain name")
 	f.StringVar(&c.IP, "ip", "", "remote server ip")
 	f.StringVar(&c.Remote, "remote", "", "remote CFSSL server")
@@ -115,10 +153,18 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.StringVar(&c.CSVFile, "csv", "", "file containing CSV of hosts")
 	f.IntVar(&c.NumWorkers, "num-workers", 10, "number of workers to use for scan")
 	f.IntVar(&c.MaxHosts, "max-hosts", 100, "maximum number of hosts to scan")
+	f.StringVar(&c.CTLogListFile, "ct-log-list", "", "CT log list (v3 JSON) to verify SCTs against")
+	f.IntVar(&c.CTMinLogs, "ct-min-logs", 2, "minimum number of distinct CT logs with valid SCTs for a host")
+	f.IntVar(&c.CTMinOperators, "ct-min-operators", 2, "minimum number of distinct CT log operators with valid SCTs for a host")
+	f.StringVar(&c.ResultsDir, "results-dir", "", "directory to store scan results in")
+	f.StringVar(&c.ResultsDBConfig, "results-db", "", "db configuration file of the certdb to store scan results in")
+	f.BoolVar(&c.Diff, "diff", false, "report changes and regressions since the previous scan of each host")
+	f.BoolVar(&c.FromCertDB, "from-certdb", false, "scan the hosts named by unexpired certificates in the certdb")
 	f.StringVar(&c.Responses, "responses", "", "file to load OCSP responses from")
 	f.StringVar(&c.Path, "path", "/", "Path on which the server will listen")
 	f.StringVar(&c.CRL, "crl", "", "CRL URL Override")
 	f.StringVar(&c.Password, "password", "0", "Password for accessing PKCS #12 data passed to bundler")
+	f.StringVar(&c.BundlePassword, "bundle-password", "", "Password protecting PKCS #12 and JKS bundles")
 	f.StringVar(&c.Usage, "usage", "", "usage of private key")
 	f.StringVar(&c.PGPPrivate, "pgp-private", "", "file to load a PGP Private key decryption")
 	f.StringVar(&c.PGPName, "pgp-name", "", "PGP public key name, can be a comma-sepearted  key name list")
@@ -127,6 +173,20 @@ func registerFlags(c *Config, f *flag.FlagSet) {
 	f.StringVar(&c.AKI, "aki", "", "certificate issuer (authority) key identifier")
 	f.StringVar(&c.DBConfigFile, "db-config", "", "certificate db configuration file")
 	f.DurationVar(&c.CRLExpiration, "expiry", 7*helpers.OneDay, "time from now after which the CRL will expire (default: one week)")
+	f.StringVar(&c.SignatureFile, "signature", "", "file containing a signature over the CSR by the key of the certificate being renewed")
+	f.BoolVar(&c.Revoke, "revoke", false, "revoke the renewed certificate with reason superseded")
+	f.StringVar(&c.Within, "within", "30d", "report certificates expiring within this duration (e.g. 72h, 30d)")
+	f.StringVar(&c.Format, "format", "", "output format")
+	f.StringVar(&c.StateFile, "state", "", "state file of a staged operation; it is resumed if it exists")
+	f.BoolVar(&c.IssuerOnly, "issuer-only", false, "only cover certificates issued by the key of -ca")
+	f.StringVar(&c.IdentityFile, "identity", "", "transport identity file")
+	f.DurationVar(&c.Before, "before", helpers.OneDay, "renew certificates this long before they expire")
+	f.StringVar(&c.TrustBundleFile, "trust-bundle", "", "file to write the trusted roots to")
+	f.StringVar(&c.Exec, "exec", "", "command to run after each certificate rotation, or with expiring certificates as JSON on its standard input")
+	f.StringVar(&c.PIDFile, "pid-file", "", "file containing the PID of the process to signal after each certificate rotation")
+	f.StringVar(&c.Signal, "signal", "HUP", "signal to send to the process in -pid-file")
+	f.StringVar(&c.StatusSocket, "status-socket", "", "Unix socket to serve health and status on")
+	f.DurationVar(&c.ReloadInterval, "reload-interval", 0, "interval to check configuration, CA and TLS files for changes (default: 0, only reload on SIGHUP); agent reloads its trusted roots at this interval (default: hourly)")
 	f.IntVar(&log.Level, "loglevel", log.LevelInfo, "Log level (0 = DEBUG, 5 = FATAL)")
 }
 
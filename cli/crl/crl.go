@@ -16,11 +16,14 @@ import (
 var crlUsageText = `cfssl crl -- generate a new Certificate Revocation List from Database
 
 Usage of crl:
-        cfssl crl
+        cfssl crl [-issuer-only]
+
+With -issuer-only, certificates whose authority key is not the key of -ca,
+such as those of a CA replaced by "cfssl rollover", are left out.
 
 Flags:
 `
-var crlFlags = []string{"db-config", "ca", "ca-key", "expiry"}
+var crlFlags = []string{"db-config", "ca", "ca-key", "expiry", "issuer-only"}
 
 func generateCRL(c cli.Config) (crlBytes []byte, err error) {
 	if c.CAFile == "" {
@@ -78,6 +81,10 @@ func generateCRL(c cli.Config) (crlBytes []byte, err error) {
 		return nil, err
 	}
 
+	if c.IssuerOnly {
+		certs = crl.FilterByIssuer(certs, issuerCert)
+	}
+
 	req, err := crl.NewCRLFromDB(certs, issuerCert, key, c.CRLExpiration)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,83 @@
+// Package expiring implements the expiring command.
+package expiring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cloudflare/cfssl/certdb/db"
+	"github.com/cloudflare/cfssl/certdb/dbconf"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/expiring"
+)
+
+var expiringUsageText = `cfssl expiring -- list certificates in the certificate store that are nearing expiry
+
+Usage of expiring:
+        cfssl expiring -db-config db-config [-within duration] [-format json|csv] [-exec command]
+
+The duration accepts Go duration units as well as days, e.g. 72h or 30d.
+Revoked and already renewed certificates are not listed. With -exec, the
+command is run with the expiring certificates, if any, on its standard
+input as JSON, e.g. to send a reminder.
+
+Flags:
+`
+
+var expiringFlags = []string{"db-config", "within", "format", "exec"}
+
+func expiringMain(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	if c.DBConfigFile == "" {
+		return errors.New("need DB config file (provide with -db-config)")
+	}
+
+	within, err := expiring.ParseDuration(c.Within)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := dbconf.LoadFile(c.DBConfigFile)
+	if err != nil {
+		return err
+	}
+
+	dbAccessor, err := db.NewAccessor(cfg)
+	if err != nil {
+		return err
+	}
+
+	if c.Format != "" && c.Format != "json" && c.Format != "csv" {
+		return errors.New("unknown format " + c.Format + "; expected json or csv")
+	}
+
+	groups, err := expiring.Find(dbAccessor, within)
+	if err != nil {
+		return err
+	}
+
+	if c.Format == "csv" {
+		err = expiring.WriteCSV(os.Stdout, groups)
+	} else {
+		var jsonOut []byte
+		if jsonOut, err = json.Marshal(groups); err == nil {
+			fmt.Printf("%s\n", jsonOut)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.Exec != "" && len(groups) > 0 {
+		return expiring.CommandNotifier{Command: c.Exec}.Notify(groups)
+	}
+	return nil
+}
+
+// Command assembles the definition of Command 'expiring'
+var Command = &cli.Command{UsageText: expiringUsageText, Flags: expiringFlags, Main: expiringMain}
@@ -0,0 +1,46 @@
+package expiring
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+	_ "github.com/mattn/go-sqlite3" // import just to initialize SQLite for testing
+)
+
+func TestExpiringMain(t *testing.T) {
+	c := cli.Config{DBConfigFile: "../testdata/db-config.json", Within: "30d"}
+	if err := expiringMain([]string{}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Format = "csv"
+	if err := expiringMain([]string{}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Exec = "exit 1"
+	c.Within = "0s"
+	if err := expiringMain([]string{}, c); err != nil {
+		t.Fatal("the command was run without expiring certificates")
+	}
+}
+
+func TestExpiringMainBadArgs(t *testing.T) {
+	if err := expiringMain([]string{"arg"}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for an argument")
+	}
+
+	if err := expiringMain([]string{}, cli.Config{Within: "30d"}); err == nil {
+		t.Fatal("expected an error for a missing DB config")
+	}
+
+	c := cli.Config{DBConfigFile: "../testdata/db-config.json", Within: "soon"}
+	if err := expiringMain([]string{}, c); err == nil {
+		t.Fatal("expected an error for an invalid duration")
+	}
+
+	c = cli.Config{DBConfigFile: "../testdata/db-config.json", Within: "30d", Format: "xml"}
+	if err := expiringMain([]string{}, c); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/cloudflare/cfssl/certdb/db"
 	"github.com/cloudflare/cfssl/certdb/dbconf"
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/crl"
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/ocsp"
@@ -19,13 +20,16 @@ var ocsprefreshUsageText = `cfssl ocsprefresh -- refreshes the ocsp_responses ta
 with new OCSP responses for all known unexpired certificates
 
 Usage of ocsprefresh:
-        cfssl ocsprefresh -db-config db-config -ca cert -responder cert -responder-key key [-interval 96h]
+        cfssl ocsprefresh -db-config db-config -ca cert -responder cert -responder-key key [-interval 96h] [-issuer-only]
+
+With -issuer-only, certificates whose authority key is not the key of -ca,
+such as those of a CA replaced by "cfssl rollover", are skipped.
 
 Flags:
 `
 
 // Flags of 'cfssl ocsprefresh'
-var ocsprefreshFlags = []string{"ca", "responder", "responder-key", "db-config", "interval"}
+var ocsprefreshFlags = []string{"ca", "responder", "responder-key", "db-config", "interval", "issuer-only"}
 
 // ocsprefreshMain is the main CLI of OCSP refresh functionality.
 func ocsprefreshMain(args []string, c cli.Config) error {
@@ -51,6 +55,16 @@ func ocsprefreshMain(args []string, c cli.Config) error {
 		return err
 	}
 
+	caBytes, err := helpers.ReadBytes(c.CAFile)
+	if err != nil {
+		return err
+	}
+
+	issuer, err := helpers.ParseCertificatePEM(caBytes)
+	if err != nil {
+		return err
+	}
+
 	cfg, err := dbconf.LoadFile(c.DBConfigFile)
 	if err != nil {
 		return err
@@ -75,6 +89,13 @@ func ocsprefreshMain(args []string, c cli.Config) error {
 			return err
 		}
 
+		// Certificates from another issuer, e.g. the old CA after a
+		// rollover, are refreshed by a run with that CA's certificate.
+		if c.IssuerOnly && !crl.IssuedBy(certRecord, issuer) {
+			log.Debugf("skipping certificate %s from another issuer", certRecord.Serial)
+			continue
+		}
+
 		req := ocsp.SignRequest{
 			Certificate: cert,
 			Status:      certRecord.Status,
@@ -0,0 +1,108 @@
+// Package renew implements the renew command.
+package renew
+
+import (
+	"errors"
+	"io/ioutil"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/sign"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/renew"
+)
+
+var renewUsageText = `cfssl renew -- re-issue a certificate from the certificate store with a fresh validity period
+
+Usage of renew:
+        cfssl renew -ca cert -ca-key key -db-config db-config [-config config] -cert cert [-signature file] [-revoke] CSR
+        cfssl renew -ca cert -ca-key key -db-config db-config [-config config] -serial serial -aki authority_key_id [-signature file] [-revoke] CSR
+
+Arguments:
+        CSR:        PEM file for the certificate request of the renewed certificate, use '-' for reading PEM from stdin.
+
+Note: CSR can also be supplied via flag values; flag value will take precedence over the argument.
+
+The subject, hosts, label and profile are taken from the certificate being
+renewed. If the CSR carries a new key, -signature must name a file holding a
+SHA-256 signature over the DER-encoded CSR made with the old key.
+
+Flags:
+`
+
+var renewFlags = []string{"ca", "ca-key", "config", "db-config", "cert", "serial", "aki", "csr", "signature", "revoke"}
+
+func renewMain(args []string, c cli.Config) (err error) {
+	if c.CSRFile == "" {
+		c.CSRFile, args, err = cli.PopFirstArgument(args)
+		if err != nil {
+			return
+		}
+	}
+	if len(args) > 0 {
+		return errors.New("too many arguments are provided, please check with usage")
+	}
+
+	if c.DBConfigFile == "" {
+		return errors.New("need DB config file (provide with -db-config)")
+	}
+
+	if c.CertFile == "" && c.Serial == "" {
+		return errors.New("need the certificate to renew (provide one with -cert or -serial and -aki)")
+	}
+
+	if c.CAFile == "" {
+		log.Error("need CA certificate (provide one with -ca)")
+		return
+	}
+
+	if c.CAKeyFile == "" {
+		log.Error("need CA key (provide one with -ca-key)")
+		return
+	}
+
+	req := renew.Request{
+		Serial: c.Serial,
+		AKI:    c.AKI,
+		Revoke: c.Revoke,
+	}
+
+	if c.CertFile != "" {
+		var certPEM []byte
+		certPEM, err = helpers.ReadBytes(c.CertFile)
+		if err != nil {
+			return
+		}
+		req.Certificate, err = helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			return
+		}
+	}
+
+	req.Request, err = cli.ReadStdin(c.CSRFile)
+	if err != nil {
+		return
+	}
+
+	if c.SignatureFile != "" {
+		req.Signature, err = ioutil.ReadFile(c.SignatureFile)
+		if err != nil {
+			return
+		}
+	}
+
+	s, err := sign.SignerFromConfig(c)
+	if err != nil {
+		return
+	}
+
+	cert, err := renew.Renew(s, req)
+	if err != nil {
+		return
+	}
+	cli.PrintCert(nil, req.Request, cert)
+	return
+}
+
+// Command assembles the definition of Command 'renew'
+var Command = &cli.Command{UsageText: renewUsageText, Flags: renewFlags, Main: renewMain}
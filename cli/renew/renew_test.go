@@ -0,0 +1,31 @@
+package renew
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestRenewMainBadArgs(t *testing.T) {
+	// No CSR.
+	if err := renewMain([]string{}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for a missing CSR")
+	}
+
+	// No DB config.
+	c := cli.Config{CSRFile: "../testdata/test.txt", Serial: "1"}
+	if err := renewMain([]string{}, c); err == nil {
+		t.Fatal("expected an error for a missing DB config")
+	}
+
+	// No certificate to renew.
+	c = cli.Config{CSRFile: "../testdata/test.txt", DBConfigFile: "../testdata/db-config.json"}
+	if err := renewMain([]string{}, c); err == nil {
+		t.Fatal("expected an error for a missing certificate")
+	}
+
+	// Too many arguments.
+	if err := renewMain([]string{"a", "b"}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for too many arguments")
+	}
+}
@@ -0,0 +1,72 @@
+// Package rollover implements the rollover command.
+package rollover
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/rollover"
+)
+
+var rolloverUsageText = `cfssl rollover -- replace a CA key with a cross-signed successor
+
+Usage of rollover:
+        cfssl rollover -state state.json [-ca cert -ca-key key]
+
+The first run needs the current CA certificate and key. It generates a new
+key and CA certificate with the same subject, cross-signs the new CA with
+the old key and the old CA with the new key, and writes a bundle holding
+all four certificates. Finally it copies the old CA certificate and key to
+old-ca.pem and old-ca-key.pem and installs the new ones in their place, so
+a signer using -ca and -ca-key issues from the new key; cfssl serve picks
+them up on SIGHUP or with -reload-interval. The files are written next to
+the state file, which records each completed stage; running the command
+again with the same state file resumes an interrupted rollover.
+
+Keep generating CRLs and OCSP responses for the old CA with old-ca.pem and
+old-ca-key.pem until the certificates it issued expire, passing
+-issuer-only to cfssl crl and cfssl ocsprefresh so that each CA only
+covers the certificates it issued.
+
+Flags:
+`
+
+var rolloverFlags = []string{"state", "ca", "ca-key"}
+
+func rolloverMain(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	if c.StateFile == "" {
+		return errors.New("need a state file (provide with -state)")
+	}
+
+	state, err := rollover.LoadState(c.StateFile)
+	if os.IsNotExist(err) {
+		if c.CAFile == "" || c.CAKeyFile == "" {
+			return errors.New("need CA certificate and key to start a rollover (provide with -ca and -ca-key)")
+		}
+		state = rollover.NewState(c.CAFile, c.CAKeyFile, filepath.Dir(c.StateFile))
+	} else if err != nil {
+		return err
+	}
+
+	if err = rollover.Run(c.StateFile, state); err != nil {
+		return err
+	}
+
+	jsonOut, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", jsonOut)
+	return nil
+}
+
+// Command assembles the definition of Command 'rollover'
+var Command = &cli.Command{UsageText: rolloverUsageText, Flags: rolloverFlags, Main: rolloverMain}
@@ -0,0 +1,23 @@
+package rollover
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestRolloverMainBadArgs(t *testing.T) {
+	if err := rolloverMain([]string{}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for a missing state file")
+	}
+
+	// A new rollover needs the CA to replace.
+	c := cli.Config{StateFile: "testdata/missing-state.json"}
+	if err := rolloverMain([]string{}, c); err == nil {
+		t.Fatal("expected an error for a missing CA")
+	}
+
+	if err := rolloverMain([]string{"a"}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for extra arguments")
+	}
+}
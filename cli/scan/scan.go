@@ -1,28 +1,49 @@
 package scan
 
 import (
+	"crypto/sha256"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/cloudflare/cfssl/certdb/db"
+	"github.com/cloudflare/cfssl/certdb/dbconf"
 	"github.com/cloudflare/cfssl/cli"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/scan"
+	"github.com/cloudflare/cfssl/scan/history"
 )
 
 var scanUsageText = `cfssl scan -- scan a host for issues
 Usage of scan:
-        cfssl scan [-family regexp] [-scanner regexp] [-timeout duration] [-ip IPAddr] [-num-workers num] [-max-hosts num] [-csv hosts.csv] HOST+
+        cfssl scan [-family regexp] [-scanner regexp] [-timeout duration] [-ip IPAddr] [-num-workers num] [-max-hosts num] [-csv hosts.csv] \
+                   [-ct-log-list file] [-ct-min-logs num] [-ct-min-operators num] \
+                   [-results-dir dir | -results-db db-config] [-diff] HOST+
+        cfssl scan -from-certdb -db-config db-config [-label label] [-profile profile] [flags] [HOST+]
         cfssl scan -list
 
 Arguments:
         HOST:    Host(s) to scan (including port)
+
+Results are stored per host and time in -results-dir, or in the scan_results
+table of the certdb given by -results-db, which can be the -db-config of
+-from-certdb. With -diff, the changes since the previous scan of each host are
+reported, and the command fails if any of them are regressions.
+
+With -from-certdb, the DNS names of the unexpired certificates in the certdb,
+optionally only those issued by a CA label or profile, are scanned as well.
+Each of these hosts is also checked for serving the newest certificate issued
+for it.
+
 Flags:
 `
-var scanFlags = []string{"list", "family", "scanner", "timeout", "ip", "ca-bundle", "num-workers", "csv", "max-hosts"}
+var scanFlags = []string{"list", "family", "scanner", "timeout", "ip", "ca-bundle", "num-workers", "csv", "max-hosts", "ct-log-list", "ct-min-logs", "ct-min-operators",
+	"results-dir", "results-db", "db-config", "diff", "from-certdb", "label", "profile"}
 
 func printJSON(v interface{}) {
 	b, err := json.MarshalIndent(v, "", "  ")
@@ -34,14 +55,21 @@ func printJSON(v interface{}) {
 
 type context struct {
 	sync.WaitGroup
-	c     cli.Config
-	hosts chan string
+	c       cli.Config
+	hosts   chan string
+	store   history.Store
+	targets map[string]scan.Target
+
+	mu          sync.Mutex
+	regressions int
 }
 
-func newContext(c cli.Config, numWorkers int) *context {
+func newContext(c cli.Config, numWorkers int, store history.Store, targets map[string]scan.Target) *context {
 	ctx := &context{
-		c:     c,
-		hosts: make(chan string, numWorkers),
+		c:       c,
+		hosts:   make(chan string, numWorkers),
+		store:   store,
+		targets: targets,
 	}
 	ctx.Add(numWorkers)
 	for i := 0; i < numWorkers; i++ {
@@ -53,17 +81,105 @@ func newContext(c cli.Config, numWorkers int) *context {
 func (ctx *context) runWorker() {
 	for host := range ctx.hosts {
 		fmt.Printf("Scanning %s...\n", host)
-		results, err := scan.Default.RunScans(host, ctx.c.IP, ctx.c.Family, ctx.c.Scanner, ctx.c.Timeout)
+		families := scan.Default
+		if target, ok := ctx.targets[host]; ok {
+			families = make(scan.FamilySet, len(scan.Default)+1)
+			for name, family := range scan.Default {
+				families[name] = family
+			}
+			families["Inventory"] = target.Family()
+		}
+		results, err := families.RunScans(host, ctx.c.IP, ctx.c.Family, ctx.c.Scanner, ctx.c.Timeout)
 		fmt.Printf("=== %s ===\n", host)
 		if err != nil {
 			log.Error(err)
-		} else {
-			printJSON(results)
+			continue
+		}
+		printJSON(results)
+
+		if ctx.store != nil {
+			if err = ctx.record(host, results); err != nil {
+				log.Errorf("failed to store results of %s: %v", host, err)
+			}
 		}
 	}
 	ctx.Done()
 }
 
+// record stores the results of scanning host and, with -diff, prints the
+// changes since its previous run.
+func (ctx *context) record(host string, results map[string]scan.FamilyResult) error {
+	run := &history.Run{Host: host, Time: time.Now().UTC(), Results: results}
+	previous, err := ctx.store.Last(host, run.Time)
+	if err != nil {
+		return err
+	}
+	if err = ctx.store.Put(run); err != nil {
+		return err
+	}
+	if !ctx.c.Diff {
+		return nil
+	}
+
+	report, err := history.Diff(previous, run)
+	if err != nil {
+		return err
+	}
+	printJSON(report)
+
+	ctx.mu.Lock()
+	ctx.regressions += len(report.Regressions)
+	ctx.mu.Unlock()
+	return nil
+}
+
+// certdbTargets adds the hosts named by the certificates in the certdb to
+// hosts.
+func certdbTargets(hosts []string, c cli.Config) ([]string, map[string]scan.Target, error) {
+	if c.DBConfigFile == "" {
+		return nil, nil, errors.New("-from-certdb needs a DB config file (provide with -db-config)")
+	}
+	cfg, err := dbconf.LoadFile(c.DBConfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbAccessor, err := db.NewAccessor(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list, err := scan.TargetsFromCertDB(dbAccessor, c.Label, c.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets := make(map[string]scan.Target, len(list))
+	for _, target := range list {
+		targets[target.Host] = target
+		hosts = append(hosts, target.Host)
+	}
+	return hosts, targets, nil
+}
+
+// openStore returns the store of scan results selected by the flags, if
+// any.
+func openStore(c cli.Config) (history.Store, error) {
+	switch {
+	case c.ResultsDBConfig != "" && c.ResultsDir != "":
+		return nil, errors.New("-results-db and -results-dir can't be used together")
+	case c.ResultsDBConfig != "":
+		sqlDB, err := dbconf.DBFromConfig(c.ResultsDBConfig)
+		if err != nil {
+			return nil, err
+		}
+		return history.NewSQLStore(sqlDB), nil
+	case c.ResultsDir != "":
+		return history.NewFileStore(c.ResultsDir), nil
+	case c.Diff:
+		return nil, errors.New("-diff needs stored results (provide with -results-dir or -results-db)")
+	}
+	return nil, nil
+}
+
 func parseCSV(hosts []string, csvFile string, maxHosts int) ([]string, error) {
 	f, err := os.Open(csvFile)
 	if err != nil {
@@ -91,6 +207,11 @@ func scanMain(args []string, c cli.Config) (err error) {
 		if err = scan.LoadRootCAs(c.CABundleFile); err != nil {
 			return
 		}
+		var logs map[[sha256.Size]byte]*scan.CTLog
+		if logs, err = scan.LoadCTLogList(c.CTLogListFile); err != nil {
+			return
+		}
+		scan.SetCTConfig(&scan.CTConfig{Logs: logs, Policy: scan.CTPolicy{MinLogs: c.CTMinLogs, MinOperators: c.CTMinOperators}})
 
 		if len(args) >= c.MaxHosts {
 			log.Warningf("Only scanning max-hosts=%d out of %d args given", c.MaxHosts, len(args))
@@ -102,7 +223,23 @@ func scanMain(args []string, c cli.Config) (err error) {
 			}
 		}
 
-		ctx := newContext(c, c.NumWorkers)
+		var targets map[string]scan.Target
+		if c.FromCertDB {
+			if args, targets, err = certdbTargets(args, c); err != nil {
+				return
+			}
+			if len(args) > c.MaxHosts {
+				log.Warningf("Only scanning max-hosts=%d out of %d hosts", c.MaxHosts, len(args))
+				args = args[:c.MaxHosts]
+			}
+		}
+
+		var store history.Store
+		if store, err = openStore(c); err != nil {
+			return
+		}
+
+		ctx := newContext(c, c.NumWorkers, store, targets)
 		// Execute for each HOST argument given
 		for len(args) > 0 {
 			var host string
@@ -115,6 +252,10 @@ func scanMain(args []string, c cli.Config) (err error) {
 		}
 		close(ctx.hosts)
 		ctx.Wait()
+
+		if ctx.regressions > 0 {
+			err = fmt.Errorf("found %d regressions since the previous scans", ctx.regressions)
+		}
 	}
 	return
 }
@@ -19,3 +19,22 @@ func TestScanMain(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestOpenStore(t *testing.T) {
+	// The certdb of -from-certdb doesn't store results unless asked to.
+	if store, err := openStore(cli.Config{DBConfigFile: "../testdata/db-config.json"}); err != nil || store != nil {
+		t.Fatalf("expected no store, have %v %v", store, err)
+	}
+	if store, err := openStore(cli.Config{ResultsDir: "results"}); err != nil || store == nil {
+		t.Fatalf("expected a file store, have %v %v", store, err)
+	}
+
+	for _, c := range []cli.Config{
+		{ResultsDir: "results", ResultsDBConfig: "../testdata/db-config.json"},
+		{Diff: true, DBConfigFile: "../testdata/db-config.json"},
+	} {
+		if _, err := openStore(c); err == nil {
+			t.Fatalf("%+v: expected an error", c)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package serve
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloudflare/cfssl/api/intermediate"
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/ocspsign"
+	"github.com/cloudflare/cfssl/cli/sign"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/ocsp"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/universal"
+)
+
+// A keyPair holds the server's TLS certificate so that it can be
+// replaced without restarting the listener.
+type keyPair struct {
+	mu       sync.RWMutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+}
+
+func newKeyPair(certFile, keyFile string) (*keyPair, error) {
+	kp := &keyPair{certFile: certFile, keyFile: keyFile}
+	if err := kp.load(); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+// load reads the certificate and key. The current pair is kept if
+// either fails to load.
+func (kp *keyPair) load() error {
+	cert, err := kp.read()
+	if err != nil {
+		return err
+	}
+	kp.set(cert)
+	return nil
+}
+
+// read reads the certificate and key without replacing the current
+// pair.
+func (kp *keyPair) read() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (kp *keyPair) set(cert *tls.Certificate) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	kp.cert = cert
+}
+
+// GetCertificate implements tls.Config's GetCertificate.
+func (kp *keyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	kp.mu.RLock()
+	defer kp.mu.RUnlock()
+	return kp.cert, nil
+}
+
+// A certPool holds the CAs that client certificates are verified
+// against, so that they can be replaced without restarting the
+// listener.
+type certPool struct {
+	mu   sync.RWMutex
+	file string
+	pool *x509.CertPool
+}
+
+func newCertPool(file string) (*certPool, error) {
+	cp := &certPool{file: file}
+	if err := cp.load(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// load reads the CA file. The current pool is kept if it fails to load.
+func (cp *certPool) load() error {
+	pool, err := cp.read()
+	if err != nil {
+		return err
+	}
+	cp.set(pool)
+	return nil
+}
+
+// read reads the CA file without replacing the current pool.
+func (cp *certPool) read() (*x509.CertPool, error) {
+	pool, err := helpers.LoadPEMCertPool(cp.file)
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		return nil, errors.New("no CA certificates in " + cp.file)
+	}
+	return pool, nil
+}
+
+func (cp *certPool) set(pool *x509.CertPool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.pool = pool
+}
+
+// Pool returns the current pool.
+func (cp *certPool) Pool() *x509.CertPool {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.pool
+}
+
+// reloadEndpoints are the endpoints built from the signing policy or
+// from files a reload reads: the CA certificate and key, the OCSP
+// responder and the CA and intermediate bundles.
+var reloadEndpoints = []string{"sign", "authsign", "newcert", "bundle", "scan", "scanstream", "ocspsign", "crl"}
+
+// A stagedSigner is the signer of the endpoints a reload builds. It
+// sends every call to the Labeled signer, which uses the signer being
+// loaded once the reload is committed, but reports the policy of the
+// signer being loaded until then.
+type stagedSigner struct {
+	*universal.Labeled
+	mu     sync.RWMutex
+	policy *config.Signing
+}
+
+// Policy returns the policy of the signer being loaded until the reload
+// is committed, and the Labeled signer's afterwards.
+func (s *stagedSigner) Policy() *config.Signing {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.policy != nil {
+		return s.policy
+	}
+	return s.Labeled.Policy()
+}
+
+// commit makes Policy follow the Labeled signer.
+func (s *stagedSigner) commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = nil
+}
+
+// A reloader re-reads the signing configuration, the CA, the TLS
+// certificate, the mutual TLS CAs, the OCSP responder and the bundles
+// of a running server. A reload that fails leaves the running material
+// in place.
+type reloader struct {
+	mu        sync.Mutex
+	conf      cli.Config
+	signer    *universal.Labeled
+	responder ocsp.Signer
+	keyPair   *keyPair
+	clientCAs *certPool
+	modTimes  map[string]time.Time
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newReloader(c cli.Config, s *universal.Labeled, responder ocsp.Signer, kp *keyPair, clientCAs *certPool) *reloader {
+	r := &reloader{conf: c, signer: s, responder: responder, keyPair: kp, clientCAs: clientCAs, done: make(chan struct{})}
+	r.modTimes = r.stat()
+	return r
+}
+
+// stop ends the watches for reloads.
+func (r *reloader) stop() {
+	r.stopOnce.Do(func() { close(r.done) })
+}
+
+// files lists the files a reload reads.
+func (r *reloader) files() []string {
+	var files []string
+	for _, file := range []string{r.conf.ConfigFile, r.conf.CAFile, r.conf.CAKeyFile, r.conf.TLSCertFile, r.conf.TLSKeyFile,
+		r.conf.MutualTLSCAFile, r.conf.ResponderFile, r.conf.ResponderKeyFile, r.conf.CABundleFile, r.conf.IntBundleFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (r *reloader) stat() map[string]time.Time {
+	modTimes := map[string]time.Time{}
+	for _, file := range r.files() {
+		if fi, err := os.Stat(file); err == nil {
+			modTimes[file] = fi.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// reload replaces the default signer with one built from the current
+// configuration and CA files, reloads the TLS certificate, the mutual
+// TLS CAs and the OCSP responder, and rebuilds the endpoints of
+// reloadEndpoints. Everything is loaded and built before anything is
+// replaced, so a reload that fails changes nothing.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.modTimes = r.stat()
+
+	var def signer.Signer
+	if r.signer != nil {
+		c := r.conf
+		if c.ConfigFile != "" {
+			cfg, err := config.LoadFile(c.ConfigFile)
+			if err != nil {
+				return err
+			}
+			c.CFG = cfg
+		}
+
+		var err error
+		def, err = sign.SignerFromConfigAndDB(c, r.signer.GetDBAccessor())
+		if err != nil {
+			return err
+		}
+		if def == nil {
+			return errBadSigner
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.keyPair != nil {
+		var err error
+		if cert, err = r.keyPair.read(); err != nil {
+			return err
+		}
+	}
+
+	var pool *x509.CertPool
+	if r.clientCAs != nil {
+		var err error
+		if pool, err = r.clientCAs.read(); err != nil {
+			return err
+		}
+	}
+
+	responder := r.responder
+	if r.conf.ResponderFile != "" {
+		var err error
+		if responder, err = ocspsign.SignerFromConfig(r.conf); err != nil {
+			return err
+		}
+	}
+
+	// The endpoints are built against the new signer and responder.
+	var s signer.Signer
+	var staged *stagedSigner
+	if def != nil {
+		staged = &stagedSigner{Labeled: r.signer, policy: def.Policy()}
+		s = staged
+	}
+	handlers, err := buildEndpoints(s, responder, reloadEndpoints...)
+	if err != nil {
+		return err
+	}
+
+	if def != nil {
+		r.signer.SetDefault(def)
+		// Intermediates registered through the API sign with the
+		// leaf profiles of the reloaded policy.
+		r.signer.SetLabelPolicy(intermediate.LeafPolicy(def.Policy()))
+		staged.commit()
+		log.Info("reloaded signer")
+	}
+	if cert != nil {
+		r.keyPair.set(cert)
+		log.Info("reloaded TLS certificate")
+	}
+	if pool != nil {
+		r.clientCAs.set(pool)
+		log.Info("reloaded mutual TLS CAs")
+	}
+	if r.conf.ResponderFile != "" {
+		r.responder = responder
+		log.Info("reloaded OCSP responder")
+	}
+	setEndpoints(handlers)
+	return nil
+}
+
+func (r *reloader) reloadAndLog() {
+	if err := r.reload(); err != nil {
+		log.Errorf("reload failed, keeping the running configuration: %v", err)
+	}
+}
+
+// changed reports whether any of the files was modified since the last
+// reload.
+func (r *reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes := r.stat()
+	for file, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchSignals reloads whenever the process receives SIGHUP, until the
+// reloader is stopped.
+func (r *reloader) watchSignals() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-sigs:
+				log.Info("received SIGHUP, reloading")
+				r.reloadAndLog()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// watchFiles reloads whenever one of the files changes, checking at the
+// given interval, until the reloader is stopped.
+func (r *reloader) watchFiles(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if r.changed() {
+					log.Info("configuration files changed, reloading")
+					r.reloadAndLog()
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,297 @@
+package serve
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/sign"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/ocsp"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/universal"
+)
+
+func writeConfig(t *testing.T, path, expiry string) {
+	cfg := `{"signing": {"default": {"usages": ["server auth"], "expiry": "` + expiry + `"}}}`
+	if err := ioutil.WriteFile(path, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.json")
+	writeConfig(t, configFile, "1h")
+
+	c := cli.Config{ConfigFile: configFile, CAFile: "../testdata/ca.pem", CAKeyFile: "../testdata/ca-key.pem"}
+	if c.CFG, err = config.LoadFile(configFile); err != nil {
+		t.Fatal(err)
+	}
+	s, err := sign.SignerFromConfigAndDB(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labeled := universal.NewLabeled(s)
+	r := newReloader(c, labeled, nil, nil, nil)
+
+	if r.changed() {
+		t.Fatal("files reported changed before any change")
+	}
+
+	writeConfig(t, configFile, "2h")
+	future := time.Now().Add(time.Hour)
+	if err = os.Chtimes(configFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if !r.changed() {
+		t.Fatal("config change not detected")
+	}
+	if err = r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.changed() {
+		t.Fatal("files reported changed after a reload")
+	}
+	if labeled.Policy().Default.Expiry != 2*time.Hour {
+		t.Fatal("reload did not apply the new policy")
+	}
+
+	// A bad configuration is rejected and the running one kept.
+	if err = ioutil.WriteFile(configFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.reload(); err == nil {
+		t.Fatal("expected a bad configuration to be rejected")
+	}
+	if labeled.Policy().Default.Expiry != 2*time.Hour {
+		t.Fatal("a failed reload replaced the running policy")
+	}
+}
+
+func TestReloadKeyPair(t *testing.T) {
+	if _, err := newKeyPair("../../testdata/garbage.crt", "../../testdata/garbage.key"); err == nil {
+		t.Fatal("expected a bad key pair to fail to load")
+	}
+
+	kp, err := newKeyPair("../../testdata/server.crt", "../../testdata/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := kp.GetCertificate(nil)
+
+	r := newReloader(cli.Config{}, nil, nil, kp, nil)
+	if err = r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := kp.GetCertificate(nil)
+	if after == before || after == nil {
+		t.Fatal("reload did not reload the TLS certificate")
+	}
+
+	kp.certFile = "../../testdata/garbage.crt"
+	if err = r.reload(); err == nil {
+		t.Fatal("expected reloading a bad certificate to fail")
+	}
+	if current, _ := kp.GetCertificate(nil); current != after {
+		t.Fatal("a failed reload replaced the running certificate")
+	}
+}
+
+func TestReloadClientCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "client-ca.pem")
+	caPEM, err := ioutil.ReadFile("../testdata/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	clientCAs, err := newCertPool(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := clientCAs.Pool()
+
+	r := newReloader(cli.Config{MutualTLSCAFile: caFile}, nil, nil, nil, clientCAs)
+	defer r.stop()
+	if err = r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	after := clientCAs.Pool()
+	if after == before || after == nil {
+		t.Fatal("reload did not reload the mutual TLS CAs")
+	}
+
+	if err = ioutil.WriteFile(caFile, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.reload(); err == nil {
+		t.Fatal("expected reloading bad CAs to fail")
+	}
+	if clientCAs.Pool() != after {
+		t.Fatal("a failed reload replaced the running CAs")
+	}
+}
+
+func TestRebuildEndpoints(t *testing.T) {
+	build := func(status int) endpointBuilder {
+		return func(signer.Signer, ocsp.Signer) (http.Handler, error) {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }), nil
+		}
+	}
+	failing := func(signer.Signer, ocsp.Signer) (http.Handler, error) { return nil, errors.New("bad bundle") }
+	defer func() {
+		for _, endpoint := range []string{"test-a", "test-b", "test-disabled"} {
+			delete(endpoints, endpoint)
+			delete(registered, endpoint)
+		}
+	}()
+
+	endpoints["test-a"], endpoints["test-b"] = build(http.StatusOK), build(http.StatusOK)
+	a, _ := endpoints["test-a"](nil, nil)
+	b, _ := endpoints["test-b"](nil, nil)
+	registered["test-a"] = &reloadableHandler{handler: a}
+	registered["test-b"] = &reloadableHandler{handler: b}
+	status := func(endpoint string) int {
+		w := httptest.NewRecorder()
+		registered[endpoint].ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Code
+	}
+
+	// A failure to build either endpoint keeps both.
+	endpoints["test-a"], endpoints["test-b"] = build(http.StatusAccepted), failing
+	if err := rebuildEndpoints(nil, nil, "test-a", "test-b"); err == nil {
+		t.Fatal("expected the failing endpoint to be reported")
+	}
+	if status("test-a") != http.StatusOK {
+		t.Fatal("a failed rebuild replaced a handler")
+	}
+
+	endpoints["test-b"] = build(http.StatusAccepted)
+	endpoints["test-disabled"] = failing
+	if err := rebuildEndpoints(nil, nil, "test-a", "test-b", "test-disabled"); err != nil {
+		t.Fatal(err)
+	}
+	if status("test-a") != http.StatusAccepted || status("test-b") != http.StatusAccepted {
+		t.Fatal("rebuild did not replace the handlers")
+	}
+	if _, ok := registered["test-disabled"]; ok {
+		t.Fatal("rebuild enabled a disabled endpoint")
+	}
+}
+
+func TestReloadAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.json")
+	writeConfig(t, configFile, "1h")
+
+	c := cli.Config{ConfigFile: configFile, CAFile: "../testdata/ca.pem", CAKeyFile: "../testdata/ca-key.pem"}
+	if c.CFG, err = config.LoadFile(configFile); err != nil {
+		t.Fatal(err)
+	}
+	def, err := sign.SignerFromConfigAndDB(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labeled := universal.NewLabeled(def)
+	r := newReloader(c, labeled, nil, nil, nil)
+
+	// The endpoint is built against the new policy, and fails.
+	var built time.Duration
+	endpoints["test-reload"] = func(s signer.Signer, _ ocsp.Signer) (http.Handler, error) {
+		built = s.Policy().Default.Expiry
+		return nil, errors.New("bad bundle")
+	}
+	registered["test-reload"] = &reloadableHandler{handler: http.NotFoundHandler()}
+	running := reloadEndpoints
+	reloadEndpoints = append(reloadEndpoints, "test-reload")
+	defer func() {
+		reloadEndpoints = running
+		delete(endpoints, "test-reload")
+		delete(registered, "test-reload")
+	}()
+
+	writeConfig(t, configFile, "2h")
+	if err = r.reload(); err == nil {
+		t.Fatal("expected the failing endpoint to fail the reload")
+	}
+	if built != 2*time.Hour {
+		t.Fatal("endpoint was not built against the new policy")
+	}
+	if labeled.Default() != def || labeled.Policy().Default.Expiry != time.Hour {
+		t.Fatal("a failed reload replaced the running signer")
+	}
+}
+
+func TestReloadedEndpointsFollowSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.json")
+	writeConfig(t, configFile, "1h")
+
+	c := cli.Config{ConfigFile: configFile, CAFile: "../testdata/ca.pem", CAKeyFile: "../testdata/ca-key.pem"}
+	if c.CFG, err = config.LoadFile(configFile); err != nil {
+		t.Fatal(err)
+	}
+	def, err := sign.SignerFromConfigAndDB(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labeled := universal.NewLabeled(def)
+	r := newReloader(c, labeled, nil, nil, nil)
+
+	var built signer.Signer
+	endpoints["test-follow"] = func(s signer.Signer, _ ocsp.Signer) (http.Handler, error) {
+		built = s
+		return http.NotFoundHandler(), nil
+	}
+	registered["test-follow"] = &reloadableHandler{handler: http.NotFoundHandler()}
+	running := reloadEndpoints
+	reloadEndpoints = append(reloadEndpoints, "test-follow")
+	defer func() {
+		reloadEndpoints = running
+		delete(endpoints, "test-follow")
+		delete(registered, "test-follow")
+	}()
+
+	writeConfig(t, configFile, "2h")
+	if err = r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if built.Policy().Default.Expiry != 2*time.Hour {
+		t.Fatal("endpoint was not built against the new policy")
+	}
+
+	// Once committed, the endpoint's signer reports the running policy.
+	labeled.SetDefault(def)
+	if built.Policy().Default.Expiry != time.Hour {
+		t.Fatal("the endpoint's signer kept the policy of the reload")
+	}
+}
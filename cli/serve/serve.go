@@ -12,17 +12,21 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	rice "github.com/GeertJohan/go.rice"
 	"github.com/cloudflare/cfssl/api"
 	"github.com/cloudflare/cfssl/api/bundle"
 	"github.com/cloudflare/cfssl/api/certinfo"
 	"github.com/cloudflare/cfssl/api/crl"
+	"github.com/cloudflare/cfssl/api/expiring"
 	"github.com/cloudflare/cfssl/api/gencrl"
 	"github.com/cloudflare/cfssl/api/generator"
 	"github.com/cloudflare/cfssl/api/info"
 	"github.com/cloudflare/cfssl/api/initca"
+	"github.com/cloudflare/cfssl/api/intermediate"
 	apiocsp "github.com/cloudflare/cfssl/api/ocsp"
+	"github.com/cloudflare/cfssl/api/renew"
 	"github.com/cloudflare/cfssl/api/revoke"
 	"github.com/cloudflare/cfssl/api/scan"
 	"github.com/cloudflare/cfssl/api/signhandler"
@@ -33,10 +37,11 @@ import (
 	"github.com/cloudflare/cfssl/cli"
 	ocspsign "github.com/cloudflare/cfssl/cli/ocspsign"
 	"github.com/cloudflare/cfssl/cli/sign"
-	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/log"
 	"github.com/cloudflare/cfssl/ocsp"
+	scanner "github.com/cloudflare/cfssl/scan"
 	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/universal"
 	"github.com/cloudflare/cfssl/ubiquity"
 )
 
@@ -46,24 +51,41 @@ var serverUsageText = `cfssl serve -- set up a HTTP server handles CF SSL reques
 Usage of serve:
         cfssl serve [-address address] [-ca cert] [-ca-bundle bundle] \
                     [-ca-key key] [-int-bundle bundle] [-int-dir dir] [-port port] \
+                    [-aia-cache dir] [-offline] \
                     [-metadata file] [-remote remote_host] [-config config] \
                     [-responder cert] [-responder-key key] [-tls-cert cert] [-tls-key key] \
                     [-mutual-tls-ca ca] [-mutual-tls-cn regex] \
                     [-tls-remote-ca ca] [-mutual-tls-client-cert cert] [-mutual-tls-client-key key] \
-                    [-db-config db-config]
+                    [-db-config db-config] [-reload-interval interval] [-intermediate-dir dir] \
+                    [-ct-log-list file] [-ct-min-logs num] [-ct-min-operators num] \
+                    [-ranking pipeline]
+
+Send SIGHUP to re-read the configuration file, the CA certificate and key,
+the TLS certificate and key, the mutual TLS CAs, the OCSP responder
+certificate and key, and the CA and intermediate bundles; with
+-reload-interval, they are also re-read whenever they change on disk. If
+any of them fails to load, the reload is reported and everything running
+is kept. Open connections are not interrupted.
+
+The newintermediate endpoint is only enabled with -intermediate-dir. The
+keys and certificates of the intermediates it creates are kept there, and
+registered again when the server starts.
+
+Bundle requests can only rank chains through a certificate with the
+chain-through=file rankers named in -ranking, which are read when the
+server starts.
 
 Flags:
 `
 
 // Flags used by 'cfssl serve'
-var serverFlags = []string{"address", "port", "ca", "ca-key", "ca-bundle", "int-bundle", "int-dir", "metadata",
+var serverFlags = []string{"address", "port", "ca", "ca-key", "ca-bundle", "int-bundle", "int-dir", "aia-cache", "offline", "metadata",
 	"remote", "config", "responder", "responder-key", "tls-key", "tls-cert", "mutual-tls-ca", "mutual-tls-cn",
-	"tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key", "db-config"}
+	"tls-remote-ca", "mutual-tls-client-cert", "mutual-tls-client-key", "db-config", "reload-interval", "intermediate-dir",
+	"ct-log-list", "ct-min-logs", "ct-min-operators", "ranking"}
 
 var (
 	conf       cli.Config
-	s          signer.Signer
-	ocspSigner ocsp.Signer
 	dbAccessor certdb.Accessor = (certdb.Accessor)(nil)
 )
 
@@ -114,8 +136,12 @@ var staticBox = &httpBox{
 var errBadSigner = errors.New("signer not initialized")
 var errNoCertDBConfigured = errors.New("cert db not configured (missing -db-config)")
 
-var endpoints = map[string]func() (http.Handler, error){
-	"sign": func() (http.Handler, error) {
+// An endpointBuilder builds the handler of an endpoint, which signs with
+// s and answers OCSP requests with responder.
+type endpointBuilder func(s signer.Signer, responder ocsp.Signer) (http.Handler, error)
+
+var endpoints = map[string]endpointBuilder{
+	"sign": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
 		}
@@ -135,7 +161,7 @@ var endpoints = map[string]func() (http.Handler, error){
 		return h, nil
 	},
 
-	"authsign": func() (http.Handler, error) {
+	"authsign": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
 		}
@@ -155,14 +181,14 @@ var endpoints = map[string]func() (http.Handler, error){
 		return h, nil
 	},
 
-	"info": func() (http.Handler, error) {
+	"info": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
 		}
 		return info.NewHandler(s)
 	},
 
-	"crl": func() (http.Handler, error) {
+	"crl": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
 		}
@@ -174,14 +200,14 @@ var endpoints = map[string]func() (http.Handler, error){
 		return crl.NewHandler(dbAccessor, conf.CAFile, conf.CAKeyFile)
 	},
 
-	"gencrl": func() (http.Handler, error) {
+	"gencrl": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
 		}
 		return gencrl.NewHandler(), nil
 	},
 
-	"newcert": func() (http.Handler, error) {
+	"newcert": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if s == nil {
 			return nil, errBadSigner
 		}
@@ -195,45 +221,90 @@ var endpoints = map[string]func() (http.Handler, error){
 		return h, nil
 	},
 
-	"bundle": func() (http.Handler, error) {
+	"bundle": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		return bundle.NewHandler(conf.CABundleFile, conf.IntBundleFile)
 	},
 
-	"newkey": func() (http.Handler, error) {
+	"newkey": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		return generator.NewHandler(generator.CSRValidate)
 	},
 
-	"init_ca": func() (http.Handler, error) {
+	"init_ca": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		return initca.NewHandler(), nil
 	},
 
-	"scan": func() (http.Handler, error) {
+	"newintermediate": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
+		if s == nil {
+			return nil, errBadSigner
+		}
+
+		// Creating CAs is opt-in, and the intermediates need a
+		// directory to outlive a restart.
+		if conf.IntermediateDir == "" {
+			return nil, errors.New("no intermediate directory is configured")
+		}
+
+		registry, ok := s.(intermediate.Registry)
+		if !ok {
+			return nil, errors.New("signer can't register new labels")
+		}
+		dir := intermediate.Dir(conf.IntermediateDir)
+		if err := dir.Restore(s, registry); err != nil {
+			return nil, err
+		}
+		return intermediate.NewHandler(s, registry, dir, dir), nil
+	},
+
+	"scan": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		return scan.NewHandler(conf.CABundleFile)
 	},
 
-	"scaninfo": func() (http.Handler, error) {
+	"scanstream": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
+		return scan.NewStreamHandler(conf.CABundleFile)
+	},
+
+	"scaninfo": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		return scan.NewInfoHandler(), nil
 	},
 
-	"certinfo": func() (http.Handler, error) {
+	"certinfo": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		return certinfo.NewHandler(), nil
 	},
 
-	"ocspsign": func() (http.Handler, error) {
-		if ocspSigner == nil {
+	"ocspsign": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
+		if responder == nil {
 			return nil, errBadSigner
 		}
-		return apiocsp.NewHandler(ocspSigner), nil
+		return apiocsp.NewHandler(responder), nil
 	},
 
-	"revoke": func() (http.Handler, error) {
+	"revoke": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if dbAccessor == nil {
 			return nil, errNoCertDBConfigured
 		}
 		return revoke.NewHandler(dbAccessor), nil
 	},
 
-	"/": func() (http.Handler, error) {
+	"renew": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
+		if s == nil {
+			return nil, errBadSigner
+		}
+
+		if dbAccessor == nil {
+			return nil, errNoCertDBConfigured
+		}
+
+		return renew.NewHandler(s), nil
+	},
+
+	"expiring": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
+		if dbAccessor == nil {
+			return nil, errNoCertDBConfigured
+		}
+		return expiring.NewHandler(dbAccessor), nil
+	},
+
+	"/": func(s signer.Signer, responder ocsp.Signer) (http.Handler, error) {
 		if err := staticBox.findStaticBox(); err != nil {
 			return nil, err
 		}
@@ -242,24 +313,91 @@ var endpoints = map[string]func() (http.Handler, error){
 	},
 }
 
+// A reloadableHandler serves requests with a handler that a reload can
+// replace.
+type reloadableHandler struct {
+	mu      sync.RWMutex
+	handler http.Handler
+}
+
+func (rh *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rh.mu.RLock()
+	handler := rh.handler
+	rh.mu.RUnlock()
+	handler.ServeHTTP(w, r)
+}
+
+func (rh *reloadableHandler) set(handler http.Handler) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	rh.handler = handler
+}
+
+// registered holds the handlers of the enabled endpoints, by endpoint.
+var registered = map[string]*reloadableHandler{}
+
 // registerHandlers instantiates various handlers and associate them to corresponding endpoints.
-func registerHandlers() {
-	for path, getHandler := range endpoints {
-		log.Debugf("getHandler for %s", path)
-		if handler, err := getHandler(); err != nil {
-			log.Warningf("endpoint '%s' is disabled: %v", path, err)
+func registerHandlers(s signer.Signer, responder ocsp.Signer) {
+	for endpoint, getHandler := range endpoints {
+		log.Debugf("getHandler for %s", endpoint)
+		if handler, err := getHandler(s, responder); err != nil {
+			log.Warningf("endpoint '%s' is disabled: %v", endpoint, err)
 		} else {
+			path := endpoint
 			if path, handler, err = wrapHandler(path, handler, err); err != nil {
 				log.Warningf("endpoint '%s' is disabled by wrapper: %v", path, err)
 			} else {
 				log.Infof("endpoint '%s' is enabled", path)
-				http.Handle(path, handler)
+				registered[endpoint] = &reloadableHandler{handler: handler}
+				http.Handle(path, registered[endpoint])
 			}
 		}
 	}
 	log.Info("Handler set up complete.")
 }
 
+// rebuildEndpoints replaces the handlers of the enabled endpoints named
+// with ones built from the current configuration, s and responder. If
+// any fails to build, none are replaced. Endpoints that were disabled
+// stay disabled.
+func rebuildEndpoints(s signer.Signer, responder ocsp.Signer, names ...string) error {
+	handlers, err := buildEndpoints(s, responder, names...)
+	if err != nil {
+		return err
+	}
+	setEndpoints(handlers)
+	return nil
+}
+
+// buildEndpoints builds new handlers for the enabled endpoints named,
+// signing with s and answering OCSP requests with responder, without
+// installing them.
+func buildEndpoints(s signer.Signer, responder ocsp.Signer, names ...string) (map[string]http.Handler, error) {
+	handlers := map[string]http.Handler{}
+	for _, endpoint := range names {
+		if _, ok := registered[endpoint]; !ok {
+			continue
+		}
+		handler, err := endpoints[endpoint](s, responder)
+		if err == nil {
+			_, handler, err = wrapHandler(endpoint, handler, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("endpoint '%s': %v", endpoint, err)
+		}
+		handlers[endpoint] = handler
+	}
+	return handlers, nil
+}
+
+// setEndpoints installs handlers built by buildEndpoints.
+func setEndpoints(handlers map[string]http.Handler) {
+	for endpoint, handler := range handlers {
+		registered[endpoint].set(handler)
+		log.Infof("endpoint '%s' is reloaded", endpoint)
+	}
+}
+
 // serverMain is the command line entry point to the API server. It sets up a
 // new HTTP server to handle sign, bundle, and validate requests.
 func serverMain(args []string, c cli.Config) error {
@@ -270,11 +408,25 @@ func serverMain(args []string, c cli.Config) error {
 	}
 
 	bundler.IntermediateStash = conf.IntDir
+	bundler.AIAFetcher = bundler.NewAIAFetcher(conf.AIACacheDir, conf.Offline)
 	var err error
 
 	if err = ubiquity.LoadPlatforms(conf.Metadata); err != nil {
 		return err
 	}
+	// The CT logs are loaded once, not by the scan endpoints, which are
+	// rebuilt on reload while scans are running.
+	logs, err := scanner.LoadCTLogList(conf.CTLogListFile)
+	if err != nil {
+		return err
+	}
+	scanner.SetCTConfig(&scanner.CTConfig{Logs: logs, Policy: scanner.CTPolicy{MinLogs: conf.CTMinLogs, MinOperators: conf.CTMinOperators}})
+
+	if conf.Ranking != "" {
+		if _, err = ubiquity.ResolvePipeline(conf.Ranking); err != nil {
+			return err
+		}
+	}
 
 	if c.DBConfigFile != "" {
 		cfg, err := dbconf.LoadFile(c.DBConfigFile)
@@ -290,36 +442,71 @@ func serverMain(args []string, c cli.Config) error {
 
 	log.Info("Initializing signer")
 
+	var s signer.Signer
+	var labeled *universal.Labeled
 	if s, err = sign.SignerFromConfigAndDB(c, dbAccessor); err != nil {
 		log.Warningf("couldn't initialize signer: %v", err)
+	} else if s != nil {
+		// Dispatch by label so that intermediates created through
+		// the API can sign without a restart, and so that a reload
+		// can replace the signer.
+		labeled = universal.NewLabeled(s)
+		s = labeled
 	}
 
-	if ocspSigner, err = ocspsign.SignerFromConfig(c); err != nil {
+	responder, err := ocspsign.SignerFromConfig(c)
+	if err != nil {
 		log.Warningf("couldn't initialize ocsp signer: %v", err)
 	}
 
-	registerHandlers()
+	registerHandlers(s, responder)
+
+	var kp *keyPair
+	if conf.TLSCertFile != "" && conf.TLSKeyFile != "" {
+		if kp, err = newKeyPair(conf.TLSCertFile, conf.TLSKeyFile); err != nil {
+			return err
+		}
+	}
+
+	var clientCAs *certPool
+	if kp != nil && conf.MutualTLSCAFile != "" {
+		if clientCAs, err = newCertPool(conf.MutualTLSCAFile); err != nil {
+			return fmt.Errorf("failed to load mutual TLS CA file: %s", err)
+		}
+	}
+
+	r := newReloader(c, labeled, responder, kp, clientCAs)
+	defer r.stop()
+	r.watchSignals()
+	if conf.ReloadInterval > 0 {
+		r.watchFiles(conf.ReloadInterval)
+	}
 
 	addr := net.JoinHostPort(conf.Address, strconv.Itoa(conf.Port))
 
-	if conf.TLSCertFile == "" || conf.TLSKeyFile == "" {
+	if kp == nil {
 		log.Info("Now listening on ", addr)
 		return http.ListenAndServe(addr, nil)
 	}
-	if conf.MutualTLSCAFile != "" {
-		clientPool, err := helpers.LoadPEMCertPool(conf.MutualTLSCAFile)
-		if err != nil {
-			return fmt.Errorf("failed to load mutual TLS CA file: %s", err)
-		}
-
+	if clientCAs != nil {
 		server := http.Server{
 			Addr: addr,
 			TLSConfig: &tls.Config{
-				ClientAuth: tls.RequireAndVerifyClientCert,
-				ClientCAs:  clientPool,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      clientCAs.Pool(),
+				GetCertificate: kp.GetCertificate,
+				// Each handshake verifies against the CAs of the
+				// latest reload.
+				GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+					return &tls.Config{
+						ClientAuth:     tls.RequireAndVerifyClientCert,
+						ClientCAs:      clientCAs.Pool(),
+						GetCertificate: kp.GetCertificate,
+						NextProtos:     []string{"h2", "http/1.1"},
+					}, nil
+				},
 			},
 		}
-
 		if conf.MutualTLSCNRegex != "" {
 			log.Debugf(`Requiring CN matches regex "%s" for client connections`, conf.MutualTLSCNRegex)
 			re, err := regexp.Compile(conf.MutualTLSCNRegex)
@@ -339,10 +526,15 @@ func serverMain(args []string, c cli.Config) error {
 			})
 		}
 		log.Info("Now listening with mutual TLS on https://", addr)
-		return server.ListenAndServeTLS(conf.TLSCertFile, conf.TLSKeyFile)
+		return server.ListenAndServeTLS("", "")
+	}
+
+	server := http.Server{
+		Addr:      addr,
+		TLSConfig: &tls.Config{GetCertificate: kp.GetCertificate},
 	}
 	log.Info("Now listening on https://", addr)
-	return http.ListenAndServeTLS(addr, conf.TLSCertFile, conf.TLSKeyFile, nil)
+	return server.ListenAndServeTLS("", "")
 
 }
 
@@ -365,5 +557,7 @@ func SetWrapHandler(wh func(path string, handler http.Handler, err error) (strin
 
 // SetEndpoint can be used to add additional routes/endpoints to the HTTP server, or to override an existing route/endpoint
 func SetEndpoint(path string, getHandler func() (http.Handler, error)) {
-	endpoints[path] = getHandler
+	endpoints[path] = func(signer.Signer, ocsp.Signer) (http.Handler, error) {
+		return getHandler()
+	}
 }
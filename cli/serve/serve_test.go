@@ -10,7 +10,7 @@ import (
 )
 
 func TestServe(t *testing.T) {
-	registerHandlers()
+	registerHandlers(nil, nil)
 	ts := httptest.NewServer(http.DefaultServeMux)
 	defer ts.Close()
 	expected := make(map[string]int)
@@ -41,6 +41,9 @@ func TestServe(t *testing.T) {
 	expected[v1APIPath("crl")] = http.StatusNotFound
 	expected[v1APIPath("gencrl")] = http.StatusNotFound
 	expected[v1APIPath("revoke")] = http.StatusNotFound
+	expected[v1APIPath("renew")] = http.StatusNotFound
+	expected[v1APIPath("expiring")] = http.StatusNotFound
+	expected[v1APIPath("newintermediate")] = http.StatusNotFound
 
 	// Enabled endpoints should return '405 Method Not Allowed'
 	expected[v1APIPath("init_ca")] = http.StatusMethodNotAllowed
@@ -50,6 +53,7 @@ func TestServe(t *testing.T) {
 
 	// POST-only endpoints should return '400 Bad Request'
 	expected[v1APIPath("scan")] = http.StatusBadRequest
+	expected[v1APIPath("scanstream")] = http.StatusBadRequest
 
 	// Redirected HTML endpoints should return '200 OK'
 	expected["/scan"] = http.StatusOK
@@ -0,0 +1,112 @@
+// Package ubiquity implements the ubiquity command.
+package ubiquity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/ubiquity"
+)
+
+var ubiquityUsageText = `cfssl ubiquity -- manage the platform metadata used for ubiquitous bundling
+
+Usage of ubiquity:
+        cfssl ubiquity -metadata file -platform name [-weight n -hash-algo algo -key-algo algo] import roots
+        cfssl ubiquity -metadata file validate
+
+Import reads the trust store of a platform from roots, which is a PEM
+bundle, a Mozilla certdata.txt file or a directory of PEM or DER
+certificates. It writes the roots to a key store file next to the metadata
+file and adds the platform to the metadata file, replacing any platform of
+the same name. Only certdata.txt roots trusted to issue server certificates
+are imported.
+
+Validate checks the platforms of a metadata file and lists the problems
+found, if any.
+
+Flags:
+`
+
+var ubiquityFlags = []string{"metadata", "platform", "weight", "hash-algo", "key-algo"}
+
+func ubiquityMain(args []string, c cli.Config) error {
+	command, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	if c.Metadata == "" {
+		return errors.New("need a metadata file (provide with -metadata)")
+	}
+
+	switch command {
+	case "import":
+		return importMain(args, c)
+	case "validate":
+		return validateMain(args, c)
+	default:
+		return errors.New("unknown command " + command + "; expected import or validate")
+	}
+}
+
+func importMain(args []string, c cli.Config) error {
+	roots, args, err := cli.PopFirstArgument(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return errors.New("only one argument is accepted; please check the command usage")
+	}
+	if c.Platform == "" {
+		return errors.New("need a platform name (provide with -platform)")
+	}
+
+	certs, err := ubiquity.LoadRoots(roots)
+	if err != nil {
+		return err
+	}
+	platform, err := ubiquity.ImportPlatform(c.Metadata, ubiquity.Platform{
+		Name:     c.Platform,
+		Weight:   c.Weight,
+		HashAlgo: c.HashAlgo,
+		KeyAlgo:  c.KeyAlgo,
+	}, certs)
+	if err != nil {
+		return err
+	}
+
+	jsonOut, err := json.Marshal(map[string]interface{}{
+		"platform": platform.Name,
+		"keystore": platform.KeyStoreFile,
+		"roots":    len(certs),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", jsonOut)
+	return nil
+}
+
+func validateMain(args []string, c cli.Config) error {
+	if len(args) > 0 {
+		return errors.New("argument is provided but not defined; please refer to the usage by flag -h")
+	}
+
+	problems, err := ubiquity.ValidatePlatforms(c.Metadata)
+	if err != nil {
+		return err
+	}
+	jsonOut, err := json.Marshal(map[string]interface{}{"problems": problems})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", jsonOut)
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in %s", len(problems), c.Metadata)
+	}
+	return nil
+}
+
+// Command assembles the definition of Command 'ubiquity'
+var Command = &cli.Command{UsageText: ubiquityUsageText, Flags: ubiquityFlags, Main: ubiquityMain}
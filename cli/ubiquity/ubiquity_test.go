@@ -0,0 +1,63 @@
+package ubiquity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudflare/cfssl/cli"
+)
+
+func TestUbiquityMainBadArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ubiquity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := filepath.Join(dir, "platforms.json")
+	for _, args := range [][]string{
+		{},
+		{"unknown"},
+		{"import"},
+		{"import", "a", "b"},
+		{"validate", "a"},
+	} {
+		if err := ubiquityMain(args, cli.Config{Metadata: metadata, Platform: "Fleet"}); err == nil {
+			t.Fatalf("expected an error for arguments %v", args)
+		}
+	}
+
+	if err := ubiquityMain([]string{"validate"}, cli.Config{}); err == nil {
+		t.Fatal("expected an error for a missing metadata file")
+	}
+	if err := ubiquityMain([]string{"import", "../../ubiquity/testdata/rsa2048sha2.pem"}, cli.Config{Metadata: metadata}); err == nil {
+		t.Fatal("expected an error for a missing platform name")
+	}
+}
+
+func TestUbiquityImportValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ubiquity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := filepath.Join(dir, "platforms.json")
+	c := cli.Config{Metadata: metadata, Platform: "Fleet", Weight: 10, HashAlgo: "SHA2", KeyAlgo: "RSA"}
+	if err := ubiquityMain([]string{"import", "../../ubiquity/testdata/rsa2048sha2.pem"}, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(dir, "fleet.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ubiquityMain([]string{"validate"}, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(metadata, []byte(`[{"name": "Fleet", "hash_algo": "MD5", "key_algo": "RSA"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ubiquityMain([]string{"validate"}, c); err == nil {
+		t.Fatal("expected an error for an invalid platform")
+	}
+}
@@ -16,6 +16,11 @@ Usage:
 	gencert  generates a key and a signed certificate
 	gencsr   generates a certificate request
 	selfsign generates a self-signed certificate
+	renew    re-issues a certificate from the certificate store
+	expiring lists certificates in the certificate store nearing expiry
+	rollover replaces a CA key with a cross-signed successor
+	agent    keeps a certificate and key on disk renewed
+	ubiquity imports and validates platform trust stores for bundling
 
 Use "cfssl [command] -help" to find out more about a command.
 */
@@ -26,9 +31,11 @@ import (
 	"os"
 
 	"github.com/cloudflare/cfssl/cli"
+	"github.com/cloudflare/cfssl/cli/agent"
 	"github.com/cloudflare/cfssl/cli/bundle"
 	"github.com/cloudflare/cfssl/cli/certinfo"
 	"github.com/cloudflare/cfssl/cli/crl"
+	"github.com/cloudflare/cfssl/cli/expiring"
 	"github.com/cloudflare/cfssl/cli/gencert"
 	"github.com/cloudflare/cfssl/cli/gencrl"
 	"github.com/cloudflare/cfssl/cli/gencsr"
@@ -39,11 +46,14 @@ import (
 	"github.com/cloudflare/cfssl/cli/ocspserve"
 	"github.com/cloudflare/cfssl/cli/ocspsign"
 	"github.com/cloudflare/cfssl/cli/printdefault"
+	"github.com/cloudflare/cfssl/cli/renew"
 	"github.com/cloudflare/cfssl/cli/revoke"
+	"github.com/cloudflare/cfssl/cli/rollover"
 	"github.com/cloudflare/cfssl/cli/scan"
 	"github.com/cloudflare/cfssl/cli/selfsign"
 	"github.com/cloudflare/cfssl/cli/serve"
 	"github.com/cloudflare/cfssl/cli/sign"
+	"github.com/cloudflare/cfssl/cli/ubiquity"
 	"github.com/cloudflare/cfssl/cli/version"
 
 	_ "github.com/go-sql-driver/mysql" // import to support MySQL
@@ -76,6 +86,11 @@ func main() {
 		"info":           info.Command,
 		"print-defaults": printdefaults.Command,
 		"revoke":         revoke.Command,
+		"renew":          renew.Command,
+		"expiring":       expiring.Command,
+		"rollover":       rollover.Command,
+		"agent":          agent.Command,
+		"ubiquity":       ubiquity.Command,
 	}
 
 	// If the CLI returns an error, exit with an appropriate status
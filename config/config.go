@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
@@ -69,26 +70,43 @@ type CAConstraint struct {
 	MaxPathLenZero bool `json:"max_path_len_zero"`
 }
 
+// NameConstraints restricts the names a CA certificate signed under a
+// profile may issue certificates for. IP ranges are in CIDR notation.
+type NameConstraints struct {
+	Critical                bool     `json:"critical"`
+	PermittedDNSDomains     []string `json:"permitted_dns_domains"`
+	ExcludedDNSDomains      []string `json:"excluded_dns_domains"`
+	PermittedIPRanges       []string `json:"permitted_ip_ranges"`
+	ExcludedIPRanges        []string `json:"excluded_ip_ranges"`
+	PermittedEmailAddresses []string `json:"permitted_email_addresses"`
+	ExcludedEmailAddresses  []string `json:"excluded_email_addresses"`
+
+	PermittedIPNets []*net.IPNet `json:"-"`
+	ExcludedIPNets  []*net.IPNet `json:"-"`
+}
+
 // A SigningProfile stores information that the CA needs to store
 // signature policy.
 type SigningProfile struct {
-	Usage               []string     `json:"usages"`
-	IssuerURL           []string     `json:"issuer_urls"`
-	OCSP                string       `json:"ocsp_url"`
-	CRL                 string       `json:"crl_url"`
-	CAConstraint        CAConstraint `json:"ca_constraint"`
-	OCSPNoCheck         bool         `json:"ocsp_no_check"`
-	ExpiryString        string       `json:"expiry"`
-	BackdateString      string       `json:"backdate"`
-	AuthKeyName         string       `json:"auth_key"`
-	RemoteName          string       `json:"remote"`
-	NotBefore           time.Time    `json:"not_before"`
-	NotAfter            time.Time    `json:"not_after"`
-	NameWhitelistString string       `json:"name_whitelist"`
-	AuthRemote          AuthRemote   `json:"auth_remote"`
-	CTLogServers        []string     `json:"ct_log_servers"`
-	AllowedExtensions   []OID        `json:"allowed_extensions"`
-	CertStore           string       `json:"cert_store"`
+	Usage               []string         `json:"usages"`
+	IssuerURL           []string         `json:"issuer_urls"`
+	OCSP                string           `json:"ocsp_url"`
+	CRL                 string           `json:"crl_url"`
+	CAConstraint        CAConstraint     `json:"ca_constraint"`
+	NameConstraints     *NameConstraints `json:"name_constraints"`
+	OCSPNoCheck         bool             `json:"ocsp_no_check"`
+	ExpiryString        string           `json:"expiry"`
+	BackdateString      string           `json:"backdate"`
+	RenewalWindow       float64          `json:"renewal_window"`
+	AuthKeyName         string           `json:"auth_key"`
+	RemoteName          string           `json:"remote"`
+	NotBefore           time.Time        `json:"not_before"`
+	NotAfter            time.Time        `json:"not_after"`
+	NameWhitelistString string           `json:"name_whitelist"`
+	AuthRemote          AuthRemote       `json:"auth_remote"`
+	CTLogServers        []string         `json:"ct_log_servers"`
+	AllowedExtensions   []OID            `json:"allowed_extensions"`
+	CertStore           string           `json:"cert_store"`
 
 	Policies                    []CertificatePolicy
 	Expiry                      time.Duration
@@ -187,6 +205,11 @@ func (p *SigningProfile) populate(cfg *Config) error {
 			p.Backdate = dur
 		}
 
+		if p.RenewalWindow < 0 || p.RenewalWindow >= 1 {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				errors.New("renewal window must be a fraction of the lifetime between 0 and 1"))
+		}
+
 		if !p.NotBefore.IsZero() && !p.NotAfter.IsZero() && p.NotAfter.Before(p.NotBefore) {
 			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
 		}
@@ -279,6 +302,23 @@ func (p *SigningProfile) populate(cfg *Config) error {
 		p.NameWhitelist = rule
 	}
 
+	if p.NameConstraints != nil {
+		if !p.CAConstraint.IsCA {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy,
+				errors.New("name constraints require a CA profile"))
+		}
+
+		nc := p.NameConstraints
+		nc.PermittedIPNets, err = parseIPRanges(nc.PermittedIPRanges)
+		if err != nil {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+		nc.ExcludedIPNets, err = parseIPRanges(nc.ExcludedIPRanges)
+		if err != nil {
+			return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+		}
+	}
+
 	p.ExtensionWhitelist = map[string]bool{}
 	for _, oid := range p.AllowedExtensions {
 		p.ExtensionWhitelist[asn1.ObjectIdentifier(oid).String()] = true
@@ -287,6 +327,18 @@ func (p *SigningProfile) populate(cfg *Config) error {
 	return nil
 }
 
+func parseIPRanges(ranges []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, r := range ranges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
 // updateRemote takes a signing profile and initializes the remote server object
 // to the hostname:port combination sent by remote.
 func (p *SigningProfile) updateRemote(remote string) error {
@@ -473,7 +525,9 @@ func (p *SigningProfile) hasLocalConfig() bool {
 		p.OCSP != "" ||
 		p.ExpiryString != "" ||
 		p.BackdateString != "" ||
+		p.RenewalWindow != 0 ||
 		p.CAConstraint.IsCA != false ||
+		p.NameConstraints != nil ||
 		!p.NotBefore.IsZero() ||
 		!p.NotAfter.IsZero() ||
 		p.NameWhitelistString != "" ||
@@ -486,7 +540,7 @@ func (p *SigningProfile) hasLocalConfig() bool {
 // warnSkippedSettings prints a log warning message about skipped settings
 // in a SigningProfile, usually due to remote signer.
 func (p *Signing) warnSkippedSettings() {
-	const warningMessage = `The configuration value by "usages", "issuer_urls", "ocsp_url", "crl_url", "ca_constraint", "expiry", "backdate", "not_before", "not_after", "cert_store" and "ct_log_servers" are skipped`
+	const warningMessage = `The configuration value by "usages", "issuer_urls", "ocsp_url", "crl_url", "ca_constraint", "name_constraints", "expiry", "backdate", "not_before", "not_after", "cert_store" and "ct_log_servers" are skipped`
 	if p == nil {
 		return
 	}
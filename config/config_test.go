@@ -535,3 +535,57 @@ func TestValidCAConstraint(t *testing.T) {
 		}
 	}
 }
+
+func TestNameConstraints(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{
+		"signing": {
+			"default": {
+				"usages": ["cert sign"],
+				"ca_constraint": { "is_ca": true },
+				"name_constraints": {
+					"permitted_dns_domains": ["example.com"],
+					"excluded_ip_ranges": ["10.0.0.0/8"]
+				},
+				"expiry": "8000h"
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc := cfg.Signing.Default.NameConstraints
+	if len(nc.ExcludedIPNets) != 1 || nc.ExcludedIPNets[0].String() != "10.0.0.0/8" {
+		t.Fatal("excluded IP ranges were not parsed")
+	}
+
+	invalid := []string{
+		// Not a CA profile.
+		`{"signing": {"default": {"expiry": "8000h",
+			"name_constraints": {"permitted_dns_domains": ["example.com"]}}}}`,
+		// Not a CIDR range.
+		`{"signing": {"default": {"expiry": "8000h", "ca_constraint": {"is_ca": true},
+			"name_constraints": {"permitted_ip_ranges": ["10.0.0.1"]}}}}`,
+	}
+	for _, config := range invalid {
+		if _, err = LoadConfig([]byte(config)); err == nil {
+			t.Fatal("expected invalid name constraints to be rejected")
+		}
+	}
+}
+
+func TestRenewalWindow(t *testing.T) {
+	cfg, err := LoadConfig([]byte(`{"signing": {"default": {"expiry": "8000h", "renewal_window": 0.66}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Signing.Default.RenewalWindow != 0.66 {
+		t.Fatalf("expected a renewal window of 0.66, have %v", cfg.Signing.Default.RenewalWindow)
+	}
+
+	for _, window := range []string{"-0.1", "1", "1.5"} {
+		config := `{"signing": {"default": {"expiry": "8000h", "renewal_window": ` + window + `}}}`
+		if _, err = LoadConfig([]byte(config)); err == nil {
+			t.Fatalf("expected renewal window %s to be rejected", window)
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package crl
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
 	"crypto/x509"
@@ -95,6 +96,34 @@ func NewCRLFromDB(certs []certdb.CertificateRecord, issuerCert *x509.Certificate
 	return CreateGenericCRL(revokedCerts, key, issuerCert, newExpiryTime)
 }
 
+// FilterByIssuer returns the records in certs that IssuedBy attributes to
+// issuer. After a CA rollover, it keeps the CRL of each CA to the
+// certificates that CA issued.
+func FilterByIssuer(certs []certdb.CertificateRecord, issuer *x509.Certificate) []certdb.CertificateRecord {
+	var filtered []certdb.CertificateRecord
+	for _, certRecord := range certs {
+		if IssuedBy(certRecord, issuer) {
+			filtered = append(filtered, certRecord)
+		}
+	}
+	return filtered
+}
+
+// IssuedBy reports whether the certificate in the record names issuer's
+// subject key as its authority key. Records without an authority key
+// identifier, a parseable certificate or key identifiers, as written by
+// older certdbs, are assumed to belong to issuer.
+func IssuedBy(certRecord certdb.CertificateRecord, issuer *x509.Certificate) bool {
+	if certRecord.AKI == "" {
+		return true
+	}
+	cert, err := helpers.ParseCertificatePEM([]byte(certRecord.PEM))
+	if err != nil || len(cert.AuthorityKeyId) == 0 || len(issuer.SubjectKeyId) == 0 {
+		return true
+	}
+	return bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId)
+}
+
 // CreateGenericCRL is a helper function that takes in all of the information above, and then calls the createCRL
 // function. This outputs the bytes of the created CRL.
 func CreateGenericCRL(certList []pkix.RevokedCertificate, key crypto.Signer, issuingCert *x509.Certificate, expiryTime time.Time) ([]byte, error) {
@@ -2,8 +2,12 @@ package crl
 
 import (
 	"crypto/x509"
+	"encoding/hex"
 	"io/ioutil"
 	"testing"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/helpers"
 )
 
 const (
@@ -75,3 +79,46 @@ func TestNewCRLFromFileWithoutRevocations(t *testing.T) {
 		t.Fatal("Wrong number of expired certificates")
 	}
 }
+
+func TestIssuedBy(t *testing.T) {
+	issuerBytes, err := ioutil.ReadFile(tryTwoCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := helpers.ParseCertificatePEM(issuerBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherBytes, err := ioutil.ReadFile("testdata/cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := helpers.ParseCertificatePEM(otherBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherAKI := hex.EncodeToString(other.AuthorityKeyId)
+
+	if !IssuedBy(certdb.CertificateRecord{AKI: "aki", PEM: string(issuerBytes)}, issuer) {
+		t.Fatal("self-signed CA not recognised as issued by itself")
+	}
+	if IssuedBy(certdb.CertificateRecord{AKI: otherAKI, PEM: string(otherBytes)}, issuer) {
+		t.Fatal("certificate from another authority key recognised as issued by the CA")
+	}
+	if !IssuedBy(certdb.CertificateRecord{AKI: "aki", PEM: "revoked cert"}, issuer) {
+		t.Fatal("record without a certificate should be kept")
+	}
+	if !IssuedBy(certdb.CertificateRecord{PEM: string(otherBytes)}, issuer) {
+		t.Fatal("record without an authority key identifier should be kept")
+	}
+
+	certs := []certdb.CertificateRecord{
+		{Serial: "1", AKI: otherAKI, PEM: string(otherBytes)},
+		{Serial: "2", PEM: string(otherBytes)},
+	}
+	if filtered := FilterByIssuer(certs, issuer); len(filtered) != 1 || filtered[0].Serial != "2" {
+		t.Fatalf("unexpected filtered records %v", filtered)
+	}
+}
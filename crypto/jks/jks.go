@@ -0,0 +1,190 @@
+// Package jks writes Java KeyStore (JKS) files, the keystore format
+// read by Java's keytool and KeyStore.getInstance("JKS").
+//
+// A keystore holding a private key stores it as a single key entry
+// with its certificate chain; the key is protected with the store
+// password using Sun's key protection algorithm. Without a key, each
+// certificate is stored as a trusted certificate entry. The store is
+// authenticated with the password-keyed SHA-1 digest that keytool
+// verifies on load.
+package jks
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+)
+
+const (
+	magic   = 0xfeedfeed
+	version = 2
+
+	privateKeyTag  = 1
+	trustedCertTag = 2
+)
+
+// oidKeyProtector identifies Sun's proprietary key protection
+// algorithm.
+var oidKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// nullParameters is an ASN.1 NULL, the parameters of algorithms
+// that take none. Its tag is 5.
+var nullParameters = asn1.RawValue{Tag: 5}
+
+var (
+	errNoCertificates = errors.New("jks: no certificates to encode")
+	errEmptyPassword  = errors.New("jks: a password is required")
+	errNoAlias        = errors.New("jks: an alias is required")
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// Encode returns a keystore protected by password. If key isn't nil,
+// the keystore holds it under alias, with certs as its chain, leaf
+// first. Otherwise, each certificate is a trusted entry named alias,
+// alias-1, alias-2 and so on.
+func Encode(key crypto.PrivateKey, certs []*x509.Certificate, alias, password string) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, errNoCertificates)
+	}
+	if password == "" {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, errEmptyPassword)
+	}
+	if alias == "" {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, errNoAlias)
+	}
+	pass := passwordBytes(password)
+	now := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	var buf bytes.Buffer
+	writeUint32(&buf, magic)
+	writeUint32(&buf, version)
+
+	if key != nil {
+		protected, err := protectKey(key, pass)
+		if err != nil {
+			return nil, err
+		}
+
+		writeUint32(&buf, 1)
+		writeUint32(&buf, privateKeyTag)
+		writeUTF(&buf, alias)
+		writeUint64(&buf, now)
+		writeBytes(&buf, protected)
+		writeUint32(&buf, uint32(len(certs)))
+		for _, cert := range certs {
+			writeCertificate(&buf, cert)
+		}
+	} else {
+		writeUint32(&buf, uint32(len(certs)))
+		for i, cert := range certs {
+			name := alias
+			if i > 0 {
+				name = fmt.Sprintf("%s-%d", alias, i)
+			}
+			writeUint32(&buf, trustedCertTag)
+			writeUTF(&buf, name)
+			writeUint64(&buf, now)
+			writeCertificate(&buf, cert)
+		}
+	}
+
+	h := sha1.New()
+	h.Write(pass)
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes(), nil
+}
+
+// protectKey encrypts key as sun.security.provider.KeyProtector does:
+// the PKCS #8 encoding is XORed with a SHA-1 keystream seeded by a
+// random salt, followed by a SHA-1 check of the plaintext.
+func protectKey(key crypto.PrivateKey, pass []byte) ([]byte, error) {
+	plain, err := ctx509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+
+	salt := make([]byte, sha1.Size)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+
+	protected := append([]byte(nil), salt...)
+	digest := salt
+	for i := 0; i < len(plain); i += sha1.Size {
+		h := sha1.New()
+		h.Write(pass)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < len(digest) && i+j < len(plain); j++ {
+			protected = append(protected, plain[i+j]^digest[j])
+		}
+	}
+
+	h := sha1.New()
+	h.Write(pass)
+	h.Write(plain)
+	protected = h.Sum(protected)
+
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidKeyProtector, Parameters: nullParameters},
+		EncryptedData: protected,
+	})
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	return info, nil
+}
+
+// passwordBytes returns password as big-endian UTF-16, as Java's
+// char arrays are hashed.
+func passwordBytes(password string) []byte {
+	var b []byte
+	for _, r := range utf16.Encode([]rune(password)) {
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return b
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	binary.Write(buf, binary.BigEndian, v)
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	binary.Write(buf, binary.BigEndian, v)
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeUint32(buf, uint32(len(b)))
+	buf.Write(b)
+}
+
+// writeUTF writes s as Java's DataOutput.writeUTF does. Aliases and
+// certificate types are ASCII in practice, for which modified UTF-8
+// and UTF-8 agree.
+func writeUTF(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func writeCertificate(buf *bytes.Buffer, cert *x509.Certificate) {
+	writeUTF(buf, "X.509")
+	writeBytes(buf, cert.Raw)
+}
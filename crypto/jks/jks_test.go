@@ -0,0 +1,210 @@
+package jks
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+)
+
+// keystore is the part of a parsed keystore the tests look at.
+type keystore struct {
+	aliases []string
+	key     []byte
+	certs   [][]byte
+}
+
+type reader struct {
+	t *testing.T
+	r *bytes.Reader
+}
+
+func (r reader) uint32() uint32 {
+	var v uint32
+	if err := binary.Read(r.r, binary.BigEndian, &v); err != nil {
+		r.t.Fatal(err)
+	}
+	return v
+}
+
+func (r reader) bytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := r.r.Read(b); err != nil {
+		r.t.Fatal(err)
+	}
+	return b
+}
+
+func (r reader) utf() string {
+	var n uint16
+	if err := binary.Read(r.r, binary.BigEndian, &n); err != nil {
+		r.t.Fatal(err)
+	}
+	return string(r.bytes(int(n)))
+}
+
+func (r reader) cert() []byte {
+	if typ := r.utf(); typ != "X.509" {
+		r.t.Fatalf("unexpected certificate type %s", typ)
+	}
+	return r.bytes(int(r.uint32()))
+}
+
+// load parses a keystore, checking its digest and recovering the
+// private key the way keytool does.
+func load(t *testing.T, data []byte, password string) *keystore {
+	pass := passwordBytes(password)
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	h := sha1.New()
+	h.Write(pass)
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		t.Fatal("keystore digest doesn't match")
+	}
+
+	r := reader{t, bytes.NewReader(body)}
+	if r.uint32() != magic || r.uint32() != version {
+		t.Fatal("bad keystore header")
+	}
+
+	ks := &keystore{}
+	for n := r.uint32(); n > 0; n-- {
+		tag := r.uint32()
+		ks.aliases = append(ks.aliases, r.utf())
+		r.bytes(8)
+
+		switch tag {
+		case privateKeyTag:
+			var info encryptedPrivateKeyInfo
+			if _, err := asn1.Unmarshal(r.bytes(int(r.uint32())), &info); err != nil {
+				t.Fatal(err)
+			}
+			if !info.Algorithm.Algorithm.Equal(oidKeyProtector) {
+				t.Fatalf("unexpected key protection %v", info.Algorithm.Algorithm)
+			}
+
+			protected := info.EncryptedData
+			salt := protected[:sha1.Size]
+			encrypted := protected[sha1.Size : len(protected)-sha1.Size]
+			check := protected[len(protected)-sha1.Size:]
+
+			digest := salt
+			for i := 0; i < len(encrypted); i += sha1.Size {
+				h := sha1.New()
+				h.Write(pass)
+				h.Write(digest)
+				digest = h.Sum(nil)
+				for j := 0; j < len(digest) && i+j < len(encrypted); j++ {
+					ks.key = append(ks.key, encrypted[i+j]^digest[j])
+				}
+			}
+
+			h := sha1.New()
+			h.Write(pass)
+			h.Write(ks.key)
+			if !bytes.Equal(h.Sum(nil), check) {
+				t.Fatal("key check doesn't match")
+			}
+
+			for c := r.uint32(); c > 0; c-- {
+				ks.certs = append(ks.certs, r.cert())
+			}
+		case trustedCertTag:
+			ks.certs = append(ks.certs, r.cert())
+		default:
+			t.Fatalf("unexpected entry tag %d", tag)
+		}
+	}
+	if r.r.Len() != 0 {
+		t.Fatal("trailing data in keystore")
+	}
+	return ks
+}
+
+func loadChain(t *testing.T) ([]*x509.Certificate, interface{}) {
+	var certs []*x509.Certificate
+	for _, file := range []string{"../../testdata/server.crt", "../../testdata/gd_bundle.crt"} {
+		certPEM, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	keyPEM, err := ioutil.ReadFile("../../testdata/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certs, key
+}
+
+func TestEncodeKeyEntry(t *testing.T) {
+	certs, key := loadChain(t)
+
+	data, err := Encode(key, certs, "server", "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := load(t, data, "changeit")
+
+	if len(ks.aliases) != 1 || ks.aliases[0] != "server" {
+		t.Fatalf("expected a single server entry, have %v", ks.aliases)
+	}
+	if _, err = x509.ParsePKCS8PrivateKey(ks.key); err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.certs) != len(certs) {
+		t.Fatalf("expected a chain of %d, have %d", len(certs), len(ks.certs))
+	}
+	for i := range certs {
+		if !bytes.Equal(ks.certs[i], certs[i].Raw) {
+			t.Fatalf("certificate %d doesn't match", i)
+		}
+	}
+}
+
+func TestEncodeTrustedEntries(t *testing.T) {
+	certs, _ := loadChain(t)
+
+	data, err := Encode(nil, certs, "chain", "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := load(t, data, "changeit")
+
+	expected := []string{"chain", "chain-1", "chain-2", "chain-3"}
+	if len(ks.aliases) != len(expected) {
+		t.Fatalf("expected aliases %v, have %v", expected, ks.aliases)
+	}
+	for i := range expected {
+		if ks.aliases[i] != expected[i] {
+			t.Fatalf("expected aliases %v, have %v", expected, ks.aliases)
+		}
+	}
+	if ks.key != nil {
+		t.Fatal("expected no key")
+	}
+
+	if _, err = Encode(nil, certs, "chain", ""); err == nil {
+		t.Fatal("expected an empty password to be refused")
+	}
+	if _, err = Encode(nil, nil, "chain", "changeit"); err == nil {
+		t.Fatal("expected an empty chain to be refused")
+	}
+}
@@ -0,0 +1,372 @@
+// Package pkcs12 writes password-protected PKCS #12 files holding a
+// certificate chain and, optionally, its private key, for use with
+// tools such as Windows' certificate store and Java's keytool.
+//
+// Certificates are stored in an encrypted SafeContents and the key in
+// a shrouded key bag, both encrypted with pbeWithSHAAnd3-KeyTripleDES-CBC,
+// and the file is protected by a SHA-1 HMAC as described in RFC 7292.
+// This is the combination openssl and the Go pkcs12 decoder read.
+package pkcs12
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"unicode/utf16"
+
+	cferr "github.com/cloudflare/cfssl/errors"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+)
+
+// Iterations is the number of key derivation rounds used for the
+// encryption and MAC keys.
+var Iterations = 2048
+
+var (
+	oidData               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidShroudedKeyBag     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidLocalKeyID         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBEWithSHA3KeyTDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidSHA1               = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+// nullParameters is an ASN.1 NULL, the parameters of algorithms
+// that take none. Its tag is 5.
+var nullParameters = asn1.RawValue{Tag: 5}
+
+// Purposes of the derived key material, from RFC 7292 appendix B.3.
+const (
+	keyDerivationID byte = 1
+	ivDerivationID  byte = 2
+	macDerivationID byte = 3
+)
+
+var (
+	errNoCertificates = errors.New("pkcs12: no certificates to encode")
+	errEmptyPassword  = errors.New("pkcs12: a password is required")
+)
+
+// Fields holding [0] EXPLICIT values are built with explicit, as
+// encoding/asn1 doesn't tag raw values.
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedPrivateKeyInfo struct {
+	AlgorithmIdentifier pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []attribute `asn1:"set,optional"`
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData `asn1:"optional"`
+}
+
+// Encode returns the DER encoding of a PKCS #12 file holding certs,
+// the first of which is the leaf, and key if it isn't nil. The
+// contents are encrypted and authenticated with password, which may
+// not be empty.
+func Encode(key crypto.PrivateKey, certs []*x509.Certificate, password string) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, errNoCertificates)
+	}
+	if password == "" {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, errEmptyPassword)
+	}
+	pass := bmpString(password)
+
+	// The key and the leaf certificate share a local key ID so
+	// that readers can pair them up.
+	leafID := sha1.Sum(certs[0].Raw)
+	localKeyID, err := localKeyIDAttribute(leafID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []safeBag
+	for i, cert := range certs {
+		bag, err := asn1.Marshal(certBag{ID: oidCertTypeX509, Data: cert.Raw})
+		if err != nil {
+			return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+		}
+		sb := safeBag{ID: oidCertBag, Value: explicit(bag)}
+		if i == 0 && key != nil {
+			sb.Attributes = []attribute{localKeyID}
+		}
+		certBags = append(certBags, sb)
+	}
+
+	certContents, err := asn1.Marshal(certBags)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	algo, encrypted, err := encrypt(certContents, pass)
+	if err != nil {
+		return nil, err
+	}
+	certsInfo, err := asn1.Marshal(encryptedData{
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: algo,
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+
+	authSafe := []contentInfo{{ContentType: oidEncryptedData, Content: explicit(certsInfo)}}
+
+	// The key goes in a second, unencrypted SafeContents. It is
+	// written even without a key, as the Go pkcs12 decoder used by
+	// helpers expects exactly two.
+	var keyBags []safeBag
+	if key != nil {
+		keyInfo, err := shroudKey(key, pass)
+		if err != nil {
+			return nil, err
+		}
+		keyBags = append(keyBags, safeBag{
+			ID:         oidShroudedKeyBag,
+			Value:      explicit(keyInfo),
+			Attributes: []attribute{localKeyID},
+		})
+	}
+	keyContents, err := asn1.Marshal(keyBags)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	keyData, err := asn1.Marshal(keyContents)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	authSafe = append(authSafe, contentInfo{ContentType: oidData, Content: explicit(keyData)})
+
+	safe, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	mac, err := macOver(safe, pass)
+	if err != nil {
+		return nil, err
+	}
+	data, err := asn1.Marshal(safe)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+
+	pfx, err := asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: contentInfo{ContentType: oidData, Content: explicit(data)},
+		MacData:  mac,
+	})
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	return pfx, nil
+}
+
+// explicit wraps the DER encoding der in a [0] EXPLICIT tag.
+func explicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+func localKeyIDAttribute(id []byte) (attribute, error) {
+	value, err := asn1.Marshal(id)
+	if err != nil {
+		return attribute{}, cferr.Wrap(cferr.CertificateError, cferr.Unknown, err)
+	}
+	return attribute{ID: oidLocalKeyID, Value: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value}}, nil
+}
+
+// shroudKey returns the DER encoding of key as an
+// EncryptedPrivateKeyInfo.
+func shroudKey(key crypto.PrivateKey, pass []byte) ([]byte, error) {
+	pkcs8, err := ctx509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	algo, encrypted, err := encrypt(pkcs8, pass)
+	if err != nil {
+		return nil, err
+	}
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{AlgorithmIdentifier: algo, EncryptedData: encrypted})
+	if err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	return info, nil
+}
+
+// encrypt encrypts data with a fresh salt using
+// pbeWithSHAAnd3-KeyTripleDES-CBC.
+func encrypt(data, pass []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	params, err := asn1.Marshal(pbeParams{Salt: salt, Iterations: Iterations})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+
+	key := pbkdf(pass, salt, keyDerivationID, Iterations, 24)
+	iv := pbkdf(pass, salt, ivDerivationID, Iterations, des.BlockSize)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+
+	padding := des.BlockSize - len(data)%des.BlockSize
+	padded := make([]byte, len(data)+padding)
+	copy(padded, data)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+
+	algo := pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHA3KeyTDES, Parameters: asn1.RawValue{FullBytes: params}}
+	return algo, padded, nil
+}
+
+// macOver returns the HMAC-SHA1 MacData of the authenticated safe.
+func macOver(data, pass []byte) (macData, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return macData{}, err
+	}
+
+	h := hmac.New(sha1.New, pbkdf(pass, salt, macDerivationID, Iterations, sha1.Size))
+	h.Write(data)
+	return macData{
+		Mac: digestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: nullParameters},
+			Digest:    h.Sum(nil),
+		},
+		MacSalt:    salt,
+		Iterations: Iterations,
+	}, nil
+}
+
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, cferr.Wrap(cferr.PrivateKeyError, cferr.Unknown, err)
+	}
+	return salt, nil
+}
+
+// bmpString returns password as a null-terminated big-endian UTF-16
+// string, as PKCS #12 key derivation expects.
+func bmpString(password string) []byte {
+	var s []byte
+	for _, r := range utf16.Encode([]rune(password)) {
+		s = append(s, byte(r>>8), byte(r))
+	}
+	return append(s, 0, 0)
+}
+
+// pbkdf derives size bytes from pass and salt with SHA-1, as described
+// in RFC 7292 appendix B.2.
+func pbkdf(pass, salt []byte, id byte, iterations, size int) []byte {
+	v := sha1.BlockSize
+
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+
+	D := make([]byte, v)
+	for i := range D {
+		D[i] = id
+	}
+	I := append(fill(salt), fill(pass)...)
+
+	var out []byte
+	for len(out) < size {
+		h := sha1.New()
+		h.Write(D)
+		h.Write(I)
+		A := h.Sum(nil)
+		for j := 1; j < iterations; j++ {
+			sum := sha1.Sum(A)
+			A = sum[:]
+		}
+		out = append(out, A...)
+
+		B := make([]byte, v)
+		for i := range B {
+			B[i] = A[i%len(A)]
+		}
+		for j := 0; j < len(I); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(I[j+k]) + int(B[k]) + carry
+				I[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
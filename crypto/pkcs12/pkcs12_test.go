@@ -0,0 +1,101 @@
+package pkcs12
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"golang.org/x/crypto/pkcs12"
+)
+
+func loadChain(t *testing.T) ([]*x509.Certificate, interface{}) {
+	certPEM, err := ioutil.ReadFile("../../testdata/server.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePEM, err := ioutil.ReadFile("../../testdata/gd_bundle.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := helpers.ParseCertificatesPEM(append(certPEM, bundlePEM...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPEM, err := ioutil.ReadFile("../../testdata/server.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certs, key
+}
+
+func TestEncode(t *testing.T) {
+	certs, key := loadChain(t)
+
+	pfx, err := Encode(key, certs, "sésame")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pkcs12.ToPEM(pfx, "wrong"); err == nil {
+		t.Fatal("expected the wrong password to be refused")
+	}
+	blocks, err := pkcs12.ToPEM(pfx, "sésame")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var certBlocks, keyBlocks []*pem.Block
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			certBlocks = append(certBlocks, block)
+		} else {
+			keyBlocks = append(keyBlocks, block)
+		}
+	}
+	if len(certBlocks) != len(certs) || len(keyBlocks) != 1 {
+		t.Fatalf("expected %d certificates and a key, have %d and %d", len(certs), len(certBlocks), len(keyBlocks))
+	}
+	for i := range certs {
+		if !bytes.Equal(certBlocks[i].Bytes, certs[i].Raw) {
+			t.Fatalf("certificate %d doesn't match", i)
+		}
+	}
+
+	if _, err = helpers.ParsePrivateKeyPEM(pem.EncodeToMemory(keyBlocks[0])); err != nil {
+		t.Fatal(err)
+	}
+	if keyBlocks[0].Headers["localKeyId"] != certBlocks[0].Headers["localKeyId"] {
+		t.Fatal("expected the key to be paired with the leaf certificate")
+	}
+}
+
+func TestEncodeCertificatesOnly(t *testing.T) {
+	certs, _ := loadChain(t)
+
+	pfx, err := Encode(nil, certs, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := pkcs12.ToPEM(pfx, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != len(certs) {
+		t.Fatalf("expected %d certificates, have %d blocks", len(certs), len(blocks))
+	}
+
+	if _, err = Encode(nil, certs, ""); err == nil {
+		t.Fatal("expected an empty password to be refused")
+	}
+	if _, err = Encode(nil, nil, "password"); err == nil {
+		t.Fatal("expected an empty chain to be refused")
+	}
+}
@@ -0,0 +1,56 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMarshalCertificates(t *testing.T) {
+	certPEM, err := ioutil.ReadFile("../../testdata/gd_bundle.crt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs = append(certs, cert)
+	}
+
+	der, err := MarshalCertificates(certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := ParsePKCS7(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ContentInfo != "SignedData" {
+		t.Fatalf("expected SignedData, have %s", msg.ContentInfo)
+	}
+	parsed := msg.Content.SignedData.Certificates
+	if len(parsed) != len(certs) {
+		t.Fatalf("expected %d certificates, have %d", len(certs), len(parsed))
+	}
+	for i := range certs {
+		if !bytes.Equal(parsed[i].Raw, certs[i].Raw) {
+			t.Fatalf("certificate %d doesn't match", i)
+		}
+	}
+
+	if der, err = MarshalCertificates(nil); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = ParsePKCS7(der); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Content.SignedData.Certificates) != 0 {
+		t.Fatal("expected no certificates")
+	}
+}
@@ -0,0 +1,199 @@
+// Package expiring finds certificates in the certdb that are nearing
+// expiry and reports them grouped by CA label and profile.
+package expiring
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// A Certificate describes one certificate nearing expiry.
+type Certificate struct {
+	Serial     string    `json:"serial_number"`
+	AKI        string    `json:"authority_key_id"`
+	CommonName string    `json:"common_name"`
+	Hosts      []string  `json:"hosts,omitempty"`
+	Expiry     time.Time `json:"expiry"`
+}
+
+// A Group collects the expiring certificates issued under one CA label
+// and profile.
+type Group struct {
+	CALabel      string        `json:"ca_label"`
+	Profile      string        `json:"profile"`
+	Certificates []Certificate `json:"certificates"`
+}
+
+// A Notifier sends reminders about certificates nearing expiry.
+type Notifier interface {
+	Notify(groups []Group) error
+}
+
+// ParseDuration parses a duration as time.ParseDuration does, and also
+// accepts a whole number of days such as "30d".
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err == nil {
+			return time.Duration(days) * helpers.OneDay, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// Find returns the good, not yet renewed certificates in the certdb that
+// expire within the given duration from now.
+func Find(dbAccessor certdb.Accessor, within time.Duration) ([]Group, error) {
+	recs, err := dbAccessor.GetUnexpiredCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(within)
+	byKey := map[[2]string]*Group{}
+	var groups []*Group
+	for _, rec := range recs {
+		if rec.Status == "revoked" || rec.SupersededBy != "" {
+			continue
+		}
+		if rec.Expiry.After(deadline) {
+			continue
+		}
+
+		key := [2]string{rec.CALabel, rec.Profile}
+		g, ok := byKey[key]
+		if !ok {
+			g = &Group{CALabel: rec.CALabel, Profile: rec.Profile}
+			byKey[key] = g
+			groups = append(groups, g)
+		}
+		g.Certificates = append(g.Certificates, certificate(rec))
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].CALabel != groups[j].CALabel {
+			return groups[i].CALabel < groups[j].CALabel
+		}
+		return groups[i].Profile < groups[j].Profile
+	})
+
+	result := make([]Group, 0, len(groups))
+	for _, g := range groups {
+		sort.Slice(g.Certificates, func(i, j int) bool {
+			return g.Certificates[i].Expiry.Before(g.Certificates[j].Expiry)
+		})
+		result = append(result, *g)
+	}
+	return result, nil
+}
+
+func certificate(rec certdb.CertificateRecord) Certificate {
+	c := Certificate{
+		Serial: rec.Serial,
+		AKI:    rec.AKI,
+		Expiry: rec.Expiry.UTC(),
+	}
+
+	cert, err := helpers.ParseCertificatePEM([]byte(rec.PEM))
+	if err != nil {
+		log.Debugf("failed to parse certificate %s: %v", rec.Serial, err)
+		return c
+	}
+	c.CommonName = cert.Subject.CommonName
+	c.Hosts = append(c.Hosts, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		c.Hosts = append(c.Hosts, ip.String())
+	}
+	c.Hosts = append(c.Hosts, cert.EmailAddresses...)
+	return c
+}
+
+// Notify finds the certificates expiring within the given duration and,
+// if there are any, passes them to n.
+func Notify(dbAccessor certdb.Accessor, within time.Duration, n Notifier) error {
+	groups, err := Find(dbAccessor, within)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	return n.Notify(groups)
+}
+
+// csvHeader names the columns written by WriteCSV.
+var csvHeader = []string{"ca_label", "profile", "serial_number", "authority_key_id", "common_name", "hosts", "expiry"}
+
+// WriteCSV writes groups to w as CSV, one certificate per row.
+func WriteCSV(w io.Writer, groups []Group) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, g := range groups {
+		for _, c := range g.Certificates {
+			err := cw.Write([]string{
+				g.CALabel,
+				g.Profile,
+				c.Serial,
+				c.AKI,
+				c.CommonName,
+				strings.Join(c.Hosts, " "),
+				c.Expiry.Format(time.RFC3339),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// LogNotifier is a Notifier that writes a warning to the log for every
+// expiring certificate.
+type LogNotifier struct{}
+
+// Notify logs each certificate in groups.
+func (LogNotifier) Notify(groups []Group) error {
+	for _, g := range groups {
+		for _, c := range g.Certificates {
+			log.Warningf("certificate %s (%s) issued by label %q with profile %q expires at %s",
+				c.Serial, c.CommonName, g.CALabel, g.Profile, c.Expiry.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// CommandNotifier is a Notifier that runs a shell command with the
+// expiring certificates' groups on its standard input, as JSON.
+type CommandNotifier struct {
+	Command string
+}
+
+// Notify runs the command, failing if it exits with an error.
+func (n CommandNotifier) Notify(groups []Group) error {
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sh", "-c", n.Command)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.New("expiring: notify command failed: " + err.Error() + ": " + strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package expiring
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+func prepDB(t *testing.T) certdb.Accessor {
+	db := testdb.SQLiteDB("../certdb/testdb/certstore_development.db")
+	dbAccessor := sql.NewAccessor(db)
+
+	now := time.Now()
+	recs := []certdb.CertificateRecord{
+		{Serial: "1", AKI: "aki", CALabel: "a", Profile: "server", Status: "good", Expiry: now.Add(10 * helpers.OneDay)},
+		{Serial: "2", AKI: "aki", CALabel: "a", Profile: "server", Status: "good", Expiry: now.Add(2 * helpers.OneDay)},
+		{Serial: "3", AKI: "aki", CALabel: "a", Profile: "client", Status: "good", Expiry: now.Add(5 * helpers.OneDay)},
+		{Serial: "4", AKI: "aki", CALabel: "b", Profile: "", Status: "good", Expiry: now.Add(20 * helpers.OneDay)},
+		// Too far out, revoked, renewed or already expired.
+		{Serial: "5", AKI: "aki", CALabel: "a", Profile: "server", Status: "good", Expiry: now.Add(90 * helpers.OneDay)},
+		{Serial: "6", AKI: "aki", CALabel: "a", Profile: "server", Status: "revoked", Expiry: now.Add(helpers.OneDay)},
+		{Serial: "7", AKI: "aki", CALabel: "a", Profile: "server", Status: "good", SupersededBy: "8", Expiry: now.Add(helpers.OneDay)},
+		{Serial: "9", AKI: "aki", CALabel: "a", Profile: "server", Status: "good", Expiry: now.Add(-helpers.OneDay)},
+	}
+	for _, rec := range recs {
+		rec.PEM = "fake cert data"
+		if err := dbAccessor.InsertCertificate(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dbAccessor
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"30d": 30 * helpers.OneDay,
+		"72h": 72 * time.Hour,
+		"0d":  0,
+	} {
+		d, err := ParseDuration(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if d != want {
+			t.Fatalf("%s: got %v, want %v", s, d, want)
+		}
+	}
+
+	if _, err := ParseDuration("thirty days"); err == nil {
+		t.Fatal("expected an invalid duration to fail")
+	}
+}
+
+func TestFind(t *testing.T) {
+	dbAccessor := prepDB(t)
+
+	groups, err := Find(dbAccessor, 30*helpers.OneDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %+v", groups)
+	}
+
+	want := []struct {
+		label, profile string
+		serials        []string
+	}{
+		{"a", "client", []string{"3"}},
+		{"a", "server", []string{"2", "1"}},
+		{"b", "", []string{"4"}},
+	}
+	for i, w := range want {
+		g := groups[i]
+		if g.CALabel != w.label || g.Profile != w.profile {
+			t.Fatalf("group %d is %s/%s, want %s/%s", i, g.CALabel, g.Profile, w.label, w.profile)
+		}
+		if len(g.Certificates) != len(w.serials) {
+			t.Fatalf("group %d has %d certificates, want %d", i, len(g.Certificates), len(w.serials))
+		}
+		for j, serial := range w.serials {
+			if g.Certificates[j].Serial != serial {
+				t.Fatalf("group %d certificate %d is %s, want %s", i, j, g.Certificates[j].Serial, serial)
+			}
+		}
+	}
+
+	groups, err = Find(dbAccessor, 3*helpers.OneDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || len(groups[0].Certificates) != 1 || groups[0].Certificates[0].Serial != "2" {
+		t.Fatalf("expected only certificate 2 within 3 days, got %+v", groups)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	dbAccessor := prepDB(t)
+
+	groups, err := Find(dbAccessor, 30*helpers.OneDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = WriteCSV(&buf, groups); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("expected a header and 4 rows, got %d rows", len(rows))
+	}
+	if rows[1][0] != "a" || rows[1][1] != "client" || rows[1][2] != "3" {
+		t.Fatalf("unexpected first row %v", rows[1])
+	}
+}
+
+type recordingNotifier struct {
+	groups []Group
+}
+
+func (n *recordingNotifier) Notify(groups []Group) error {
+	n.groups = groups
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	dbAccessor := prepDB(t)
+
+	n := &recordingNotifier{}
+	if err := Notify(dbAccessor, helpers.OneDay, n); err != nil {
+		t.Fatal(err)
+	}
+	if n.groups != nil {
+		t.Fatal("notifier should not be called without expiring certificates")
+	}
+
+	if err := Notify(dbAccessor, 30*helpers.OneDay, n); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(n.groups))
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cfssl-expiring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "groups.json")
+	groups := []Group{{CALabel: "label", Profile: "server", Certificates: []Certificate{{Serial: "1"}}}}
+	if err = (CommandNotifier{Command: "cat > " + out}).Notify(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notified []Group
+	if err = json.Unmarshal(data, &notified); err != nil {
+		t.Fatal(err)
+	}
+	if len(notified) != 1 || notified[0].Certificates[0].Serial != "1" {
+		t.Fatalf("unexpected groups %s", data)
+	}
+
+	if err = (CommandNotifier{Command: "echo failed; exit 1"}).Notify(groups); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected the command's failure, have %v", err)
+	}
+}
@@ -12,4 +12,9 @@ type Resp struct {
 	Certificate  string   `json:"certificate"`
 	Usage        []string `json:"usages"`
 	ExpiryString string   `json:"expiry"`
+
+	// RenewalWindow is the fraction of a certificate's lifetime
+	// after which the CA suggests renewing it, or 0 if it has no
+	// preference.
+	RenewalWindow float64 `json:"renewal_window,omitempty"`
 }
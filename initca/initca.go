@@ -10,6 +10,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"math/big"
 	"time"
 
 	"github.com/cloudflare/cfssl/config"
@@ -247,3 +248,40 @@ func Update(ca *x509.Certificate, priv crypto.Signer) (cert []byte, err error) {
 	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
 	return
 }
+
+// CrossSign issues a certificate for the subject and public key of the
+// CA certificate ca, signed by issuer's key. The result chains ca's
+// subordinates up to issuer, which lets relying parties that only trust
+// issuer accept certificates from ca (and vice versa when the roles are
+// swapped). The validity is capped at issuer's expiry.
+func CrossSign(ca, issuer *x509.Certificate, priv crypto.Signer) (cert []byte, err error) {
+	if !ca.IsCA || !issuer.IsCA {
+		return nil, errors.New("cross-signing requires two CA certificates")
+	}
+
+	tmpl, err := x509.ParseCertificate(ca.Raw)
+	if err != nil {
+		return
+	}
+
+	tmpl.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return
+	}
+	tmpl.SignatureAlgorithm = signer.DefaultSigAlgo(priv)
+	// Set explicitly: a rollover keeps the subject name, and then
+	// x509.CreateCertificate would keep the self-signed AKI.
+	tmpl.AuthorityKeyId = issuer.SubjectKeyId
+	tmpl.NotBefore = time.Now().Round(time.Minute).Add(-5 * time.Minute)
+	if tmpl.NotAfter.After(issuer.NotAfter) {
+		tmpl.NotAfter = issuer.NotAfter
+	}
+
+	cert, err = x509.CreateCertificate(rand.Reader, tmpl, issuer, ca.PublicKey, priv)
+	if err != nil {
+		return
+	}
+
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+	return
+}
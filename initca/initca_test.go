@@ -2,8 +2,10 @@ package initca
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/x509"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -383,3 +385,55 @@ func TestRenew(t *testing.T) {
 		t.Fatal("Update returned a certificate with different issuer info")
 	}
 }
+
+func TestCrossSign(t *testing.T) {
+	var cas []*x509.Certificate
+	var keys []crypto.Signer
+	for i := 0; i < 2; i++ {
+		req := &csr.CertificateRequest{
+			CN:         "Cross Sign Test CA",
+			KeyRequest: &csr.BasicKeyRequest{A: "ecdsa", S: 256},
+			CA:         &csr.CAConfig{Expiry: "8760h"},
+		}
+		certPEM, _, keyPEM, err := New(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := helpers.ParsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cas = append(cas, cert)
+		keys = append(keys, key)
+	}
+
+	crossPEM, err := CrossSign(cas[1], cas[0], keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := helpers.ParseCertificatePEM(crossPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cross.CheckSignatureFrom(cas[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cross.RawSubjectPublicKeyInfo, cas[1].RawSubjectPublicKeyInfo) {
+		t.Fatal("cross certificate carries the wrong key")
+	}
+	if !bytes.Equal(cross.AuthorityKeyId, cas[0].SubjectKeyId) {
+		t.Fatal("cross certificate names the wrong authority key")
+	}
+	if !cross.IsCA || cross.NotAfter.After(cas[0].NotAfter) {
+		t.Fatal("cross certificate is not a CA within the issuer's validity")
+	}
+
+	if _, err = CrossSign(cas[1], &x509.Certificate{}, keys[0]); err == nil {
+		t.Fatal("expected cross-signing with a non-CA issuer to fail")
+	}
+}
@@ -0,0 +1,277 @@
+// Package renew implements certificate renewal: re-issuing a certificate
+// recorded in the certdb with the same subject, SANs and profile and a
+// fresh validity period.
+package renew
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/csr"
+	cferr "github.com/cloudflare/cfssl/errors"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/signer"
+	"golang.org/x/crypto/ocsp"
+)
+
+// A Request identifies the certificate to renew and proves that the
+// requester holds its private key.
+//
+// The certificate is named either by Certificate or by Serial and AKI.
+// Request is a PEM-encoded CSR for the renewed certificate. If the CSR
+// carries the same public key as the certificate being renewed, its own
+// signature is the proof of possession. If the CSR carries a new key,
+// Signature must hold a signature over the DER-encoded CSR made with the
+// old key (SHA-256 digest; PKCS #1 v1.5 for RSA, ASN.1 DER for ECDSA).
+type Request struct {
+	Certificate *x509.Certificate
+	Serial      string
+	AKI         string
+	Request     []byte
+	Signature   []byte
+	// Revoke marks the renewed certificate as revoked with reason
+	// "superseded" once its successor has been issued.
+	Revoke bool
+}
+
+// Renew re-issues the certificate described by req through s, which must
+// have a certdb accessor. The new certificate keeps the subject, SANs,
+// CA label and profile of the old one. The old record is linked to the
+// new one in the certdb and, if requested, revoked.
+func Renew(s signer.Signer, req Request) ([]byte, error) {
+	dbAccessor := s.GetDBAccessor()
+	if dbAccessor == nil {
+		return nil, cferr.Wrap(cferr.CertStoreError, cferr.Unknown,
+			errors.New("renewal requires a certificate database"))
+	}
+
+	serial, aki := req.Serial, req.AKI
+	if req.Certificate != nil {
+		serial = req.Certificate.SerialNumber.String()
+		aki = hex.EncodeToString(req.Certificate.AuthorityKeyId)
+	}
+	if serial == "" {
+		return nil, cferr.New(cferr.CertificateError, cferr.MissingSerial)
+	}
+
+	rec, old, err := lookup(dbAccessor, serial, aki)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Certificate != nil && !bytes.Equal(req.Certificate.Raw, old.Raw) {
+		return nil, cferr.Wrap(cferr.CertificateError, cferr.BadRequest,
+			errors.New("certificate does not match the certificate database"))
+	}
+
+	block, _ := pem.Decode(req.Request)
+	if block == nil {
+		return nil, cferr.New(cferr.CSRError, cferr.DecodeFailed)
+	}
+	csrv, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, cferr.Wrap(cferr.CSRError, cferr.ParseFailed, err)
+	}
+	if err = csrv.CheckSignature(); err != nil {
+		return nil, cferr.Wrap(cferr.CSRError, cferr.KeyMismatch, err)
+	}
+
+	if err = checkSubject(old, csrv); err != nil {
+		return nil, err
+	}
+
+	if err = checkKeyContinuity(old, csrv, req.Signature); err != nil {
+		return nil, err
+	}
+
+	signReq := signer.SignRequest{
+		Hosts:   Hosts(old),
+		Request: string(req.Request),
+		Subject: Subject(old),
+		Profile: rec.Profile,
+		Label:   rec.CALabel,
+	}
+
+	cert, err := s.Sign(signReq)
+	if err != nil {
+		return nil, err
+	}
+
+	renewed, err := helpers.ParseCertificatePEM(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	// The update only succeeds while the old record is not yet
+	// superseded, so of two concurrent renewals only one wins. The
+	// loser's certificate is revoked rather than left valid.
+	err = dbAccessor.SupersedeCertificate(rec.Serial, rec.AKI, renewed.SerialNumber.String())
+	if err != nil {
+		rerr := dbAccessor.RevokeCertificate(renewed.SerialNumber.String(), rec.AKI, ocsp.Superseded)
+		if rerr != nil {
+			log.Errorf("failed to revoke unrecorded renewal %s: %v", renewed.SerialNumber, rerr)
+		}
+		return nil, err
+	}
+	log.Infof("certificate %s renewed as %s", rec.Serial, renewed.SerialNumber)
+
+	if req.Revoke {
+		err = dbAccessor.RevokeCertificate(rec.Serial, rec.AKI, ocsp.Superseded)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("certificate %s revoked as superseded", rec.Serial)
+	}
+
+	return cert, nil
+}
+
+// lookup finds the unique, still-valid certificate record for serial and
+// aki and parses its certificate.
+func lookup(dbAccessor certdb.Accessor, serial, aki string) (*certdb.CertificateRecord, *x509.Certificate, error) {
+	recs, err := dbAccessor.GetCertificate(serial, aki)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(recs) != 1 {
+		return nil, nil, cferr.Wrap(cferr.CertStoreError, cferr.RecordNotFound,
+			errors.New("no unique certificate found"))
+	}
+	rec := recs[0]
+
+	if rec.Status == "revoked" {
+		return nil, nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+			errors.New("a revoked certificate cannot be renewed"))
+	}
+	if rec.SupersededBy != "" {
+		return nil, nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+			errors.New("certificate has already been renewed as "+rec.SupersededBy))
+	}
+
+	old, err := helpers.ParseCertificatePEM([]byte(rec.PEM))
+	if err != nil {
+		return nil, nil, err
+	}
+	if time.Now().After(old.NotAfter) {
+		return nil, nil, cferr.Wrap(cferr.PolicyError, cferr.InvalidRequest,
+			errors.New("an expired certificate cannot be renewed"))
+	}
+
+	return &rec, old, nil
+}
+
+// checkSubject rejects a CSR whose subject carries an attribute that old
+// does not have. The signer fills attributes missing from the subject
+// override from the CSR, so such a CSR would change the renewed subject.
+func checkSubject(old *x509.Certificate, csrv *x509.CertificateRequest) error {
+	have, want := csrv.Subject, old.Subject
+	if (have.CommonName != "" && want.CommonName == "") ||
+		(have.SerialNumber != "" && want.SerialNumber == "") ||
+		(len(have.Country) != 0 && len(want.Country) == 0) ||
+		(len(have.Province) != 0 && len(want.Province) == 0) ||
+		(len(have.Locality) != 0 && len(want.Locality) == 0) ||
+		(len(have.Organization) != 0 && len(want.Organization) == 0) ||
+		(len(have.OrganizationalUnit) != 0 && len(want.OrganizationalUnit) == 0) {
+		return cferr.Wrap(cferr.CSRError, cferr.BadRequest,
+			errors.New("renewal CSR subject adds attributes to the certificate subject"))
+	}
+	return nil
+}
+
+// checkKeyContinuity verifies that whoever submitted csrv also holds the
+// private key of old.
+func checkKeyContinuity(old *x509.Certificate, csrv *x509.CertificateRequest, sig []byte) error {
+	oldKey, err := x509.MarshalPKIXPublicKey(old.PublicKey)
+	if err != nil {
+		return cferr.Wrap(cferr.CertificateError, cferr.ParseFailed, err)
+	}
+	newKey, err := x509.MarshalPKIXPublicKey(csrv.PublicKey)
+	if err != nil {
+		return cferr.Wrap(cferr.CSRError, cferr.ParseFailed, err)
+	}
+
+	// The CSR signature already proves possession of its own key.
+	if bytes.Equal(oldKey, newKey) {
+		return nil
+	}
+
+	if len(sig) == 0 {
+		return cferr.Wrap(cferr.PrivateKeyError, cferr.KeyMismatch,
+			errors.New("a new key requires a signature by the renewed certificate's key"))
+	}
+
+	var algo x509.SignatureAlgorithm
+	switch old.PublicKey.(type) {
+	case *rsa.PublicKey:
+		algo = x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		algo = x509.ECDSAWithSHA256
+	default:
+		return cferr.New(cferr.PrivateKeyError, cferr.NotRSAOrECC)
+	}
+
+	if err = old.CheckSignature(algo, csrv.Raw, sig); err != nil {
+		return cferr.Wrap(cferr.PrivateKeyError, cferr.KeyMismatch, err)
+	}
+	return nil
+}
+
+// Subject returns the subject of cert in a form that overrides the
+// subject of a CSR when signing.
+func Subject(cert *x509.Certificate) *signer.Subject {
+	name := cert.Subject
+	sub := &signer.Subject{
+		CN:           name.CommonName,
+		SerialNumber: name.SerialNumber,
+	}
+
+	n := maxLen(len(name.Country), len(name.Province), len(name.Locality),
+		len(name.Organization), len(name.OrganizationalUnit))
+	for i := 0; i < n; i++ {
+		sub.Names = append(sub.Names, csr.Name{
+			C:  index(name.Country, i),
+			ST: index(name.Province, i),
+			L:  index(name.Locality, i),
+			O:  index(name.Organization, i),
+			OU: index(name.OrganizationalUnit, i),
+		})
+	}
+	return sub
+}
+
+// Hosts returns the DNS names, IP addresses and email addresses of cert
+// as a signer.SignRequest host list.
+func Hosts(cert *x509.Certificate) []string {
+	hosts := []string{}
+	hosts = append(hosts, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	hosts = append(hosts, cert.EmailAddresses...)
+	return hosts
+}
+
+func index(s []string, i int) string {
+	if i < len(s) {
+		return s[i]
+	}
+	return ""
+}
+
+func maxLen(n ...int) int {
+	var m int
+	for _, v := range n {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,235 @@
+package renew
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/certdb/sql"
+	"github.com/cloudflare/cfssl/certdb/testdb"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	testCaFile    = "../api/testdata/ca.pem"
+	testCaKeyFile = "../api/testdata/ca_key.pem"
+)
+
+func newSigner(t *testing.T) (*local.Signer, certdb.Accessor) {
+	db := testdb.SQLiteDB("../certdb/testdb/certstore_development.db")
+	dbAccessor := sql.NewAccessor(db)
+
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetDBAccessor(dbAccessor)
+	return s, dbAccessor
+}
+
+func newKey(t *testing.T) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newCSR(t *testing.T, key crypto.Signer, cn string, hosts ...string) []byte {
+	tpl := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn, Organization: []string{"CFSSL"}},
+		DNSNames: hosts,
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tpl, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func issue(t *testing.T, s signer.Signer, key crypto.Signer) *x509.Certificate {
+	certPEM, err := s.Sign(signer.SignRequest{
+		Hosts:   []string{"example.com", "www.example.com"},
+		Request: string(newCSR(t, key, "example.com")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func record(t *testing.T, dbAccessor certdb.Accessor, cert *x509.Certificate) certdb.CertificateRecord {
+	recs, err := dbAccessor.GetCertificate(cert.SerialNumber.String(), hex.EncodeToString(cert.AuthorityKeyId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 {
+		t.Fatalf("expected one record, got %d", len(recs))
+	}
+	return recs[0]
+}
+
+func TestRenewSameKey(t *testing.T) {
+	s, dbAccessor := newSigner(t)
+	key := newKey(t)
+	old := issue(t, s, key)
+
+	// The CSR asks for other names; the renewal must keep the old ones.
+	certPEM, err := Renew(s, Request{
+		Certificate: old,
+		Request:     newCSR(t, key, "other.example.com", "other.example.com"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if renewed.Subject.CommonName != old.Subject.CommonName {
+		t.Fatalf("renewed CN %s, want %s", renewed.Subject.CommonName, old.Subject.CommonName)
+	}
+	if len(renewed.DNSNames) != 2 || renewed.DNSNames[0] != "example.com" || renewed.DNSNames[1] != "www.example.com" {
+		t.Fatalf("renewed certificate has SANs %v", renewed.DNSNames)
+	}
+	if renewed.SerialNumber.Cmp(old.SerialNumber) == 0 {
+		t.Fatal("renewed certificate reuses the old serial number")
+	}
+
+	rec := record(t, dbAccessor, old)
+	if rec.SupersededBy != renewed.SerialNumber.String() {
+		t.Fatalf("old record superseded by %q, want %s", rec.SupersededBy, renewed.SerialNumber)
+	}
+	if rec.Status != "good" {
+		t.Fatalf("old record has status %s", rec.Status)
+	}
+
+	// A certificate can only be renewed once.
+	_, err = Renew(s, Request{
+		Certificate: old,
+		Request:     newCSR(t, key, "example.com"),
+	})
+	if err == nil {
+		t.Fatal("expected renewing a superseded certificate to fail")
+	}
+}
+
+func TestRenewNewKey(t *testing.T) {
+	s, dbAccessor := newSigner(t)
+	oldKey := newKey(t)
+	old := issue(t, s, oldKey)
+
+	nextKey := newKey(t)
+	csrPEM := newCSR(t, nextKey, "example.com")
+
+	req := Request{
+		Serial:  old.SerialNumber.String(),
+		AKI:     hex.EncodeToString(old.AuthorityKeyId),
+		Request: csrPEM,
+		Revoke:  true,
+	}
+	if _, err := Renew(s, req); err == nil {
+		t.Fatal("expected a new key without a signature to be rejected")
+	}
+
+	// A signature by an unrelated key is not proof of possession.
+	block, _ := pem.Decode(csrPEM)
+	digest := sha256.Sum256(block.Bytes)
+	req.Signature, _ = nextKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if _, err := Renew(s, req); err == nil {
+		t.Fatal("expected a signature by the wrong key to be rejected")
+	}
+
+	req.Signature, _ = oldKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	certPEM, err := Renew(s, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := helpers.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := x509.MarshalPKIXPublicKey(renewed.PublicKey)
+	want, _ := x509.MarshalPKIXPublicKey(nextKey.Public())
+	if !bytes.Equal(got, want) {
+		t.Fatal("renewed certificate does not carry the new key")
+	}
+
+	rec := record(t, dbAccessor, old)
+	if rec.Status != "revoked" || rec.Reason != ocsp.Superseded {
+		t.Fatalf("old record has status %s, reason %d", rec.Status, rec.Reason)
+	}
+	if rec.SupersededBy != renewed.SerialNumber.String() {
+		t.Fatalf("old record superseded by %q, want %s", rec.SupersededBy, renewed.SerialNumber)
+	}
+}
+
+func TestRenewUnknownCertificate(t *testing.T) {
+	s, _ := newSigner(t)
+	key := newKey(t)
+
+	_, err := Renew(s, Request{
+		Serial:  "1",
+		AKI:     "unknown",
+		Request: newCSR(t, key, "example.com"),
+	})
+	if err == nil {
+		t.Fatal("expected renewing an unknown certificate to fail")
+	}
+}
+
+func TestRenewWithoutDB(t *testing.T) {
+	s, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := newKey(t)
+
+	_, err = Renew(s, Request{Serial: "1", Request: newCSR(t, key, "example.com")})
+	if err == nil {
+		t.Fatal("expected renewal without a certificate database to fail")
+	}
+}
+
+func TestRenewRejectsSubjectAdditions(t *testing.T) {
+	s, _ := newSigner(t)
+	key := newKey(t)
+	old := issue(t, s, key)
+
+	tpl := &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:         "example.com",
+			Organization:       []string{"CFSSL"},
+			OrganizationalUnit: []string{"Added"},
+		},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tpl, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Renew(s, Request{
+		Certificate: old,
+		Request:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+	})
+	if err == nil {
+		t.Fatal("expected a CSR adding an OU to be rejected")
+	}
+}
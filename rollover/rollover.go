@@ -0,0 +1,295 @@
+// Package rollover replaces a CA key in stages: it generates a new CA
+// with the subject of the old one, cross-signs the two, publishes a
+// bundle with both, and finally installs the new CA in place of the old
+// one. Progress is kept in a state file so an interrupted rollover
+// resumes where it stopped.
+package rollover
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/initca"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// The stages of a rollover, in order. Each names the last step that
+// completed.
+const (
+	StageStarted     = "started"
+	StageGenerated   = "generated"
+	StageCrossSigned = "cross-signed"
+	StagePublished   = "published"
+	StageSwitched    = "switched"
+)
+
+// State records the files involved in a rollover and how far it got.
+type State struct {
+	Stage string `json:"stage"`
+
+	// OldCA and OldKey are the certificate and key being replaced.
+	OldCA  string `json:"old_ca"`
+	OldKey string `json:"old_ca_key"`
+
+	// NewCA and NewKey are the self-signed replacement.
+	NewCA  string `json:"new_ca"`
+	NewKey string `json:"new_ca_key"`
+
+	// NewCross is the new CA signed by the old key, OldCross the old
+	// CA signed by the new key.
+	NewCross string `json:"new_ca_cross"`
+	OldCross string `json:"old_ca_cross"`
+
+	// Bundle holds both CAs and both cross certificates.
+	Bundle string `json:"bundle"`
+
+	// RetiredCA and RetiredKey keep the old certificate and key once
+	// the new ones have been installed at OldCA and OldKey.
+	RetiredCA  string `json:"retired_ca"`
+	RetiredKey string `json:"retired_ca_key"`
+}
+
+// NewState starts a rollover of the CA in caFile and keyFile, writing
+// the new files to dir.
+func NewState(caFile, keyFile, dir string) *State {
+	return &State{
+		Stage:    StageStarted,
+		OldCA:    caFile,
+		OldKey:   keyFile,
+		NewCA:    filepath.Join(dir, "new-ca.pem"),
+		NewKey:   filepath.Join(dir, "new-ca-key.pem"),
+		NewCross: filepath.Join(dir, "new-ca-cross.pem"),
+		OldCross: filepath.Join(dir, "old-ca-cross.pem"),
+		Bundle:   filepath.Join(dir, "ca-bundle.pem"),
+
+		RetiredCA:  filepath.Join(dir, "old-ca.pem"),
+		RetiredKey: filepath.Join(dir, "old-ca-key.pem"),
+	}
+}
+
+// LoadState reads a state file written by Save.
+func LoadState(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(State)
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes the state to path. The file is replaced atomically so a
+// crash never leaves a truncated state behind.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, data, 0644)
+}
+
+// writeFile replaces path with data atomically, so that a crash or a
+// reader watching the file never sees it half written.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Run performs the remaining stages of the rollover, saving the state
+// to path after each one. Calling Run on a switched rollover does
+// nothing.
+func Run(path string, s *State) error {
+	for s.Stage != StageSwitched {
+		var step func() error
+		var next string
+		switch s.Stage {
+		case StageStarted:
+			step, next = s.generate, StageGenerated
+		case StageGenerated:
+			step, next = s.crossSign, StageCrossSigned
+		case StageCrossSigned:
+			step, next = s.publish, StagePublished
+		case StagePublished:
+			step, next = s.switchCA, StageSwitched
+		default:
+			return errors.New("unknown rollover stage " + s.Stage)
+		}
+		if err := step(); err != nil {
+			return err
+		}
+
+		log.Infof("rollover stage %s complete", next)
+		s.Stage = next
+		if err := s.Save(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generate creates the new CA key and a self-signed certificate with the
+// old CA's subject and a key of the same type and size.
+func (s *State) generate() error {
+	old, _, err := loadCA(s.OldCA, s.OldKey)
+	if err != nil {
+		return err
+	}
+
+	req := csr.ExtractCertificateRequest(old)
+	req.KeyRequest, err = keyRequest(old.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	cert, _, key, err := initca.New(req)
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(s.NewKey, key, 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.NewCA, cert, 0644)
+}
+
+// crossSign signs each CA with the other's key.
+func (s *State) crossSign() error {
+	old, oldKey, err := loadCA(s.OldCA, s.OldKey)
+	if err != nil {
+		return err
+	}
+
+	ca, key, err := loadCA(s.NewCA, s.NewKey)
+	if err != nil {
+		return err
+	}
+
+	newCross, err := initca.CrossSign(ca, old, oldKey)
+	if err != nil {
+		return err
+	}
+
+	oldCross, err := initca.CrossSign(old, ca, key)
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(s.NewCross, newCross, 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.OldCross, oldCross, 0644)
+}
+
+// publish writes the bundle of both CAs and their cross certificates.
+func (s *State) publish() error {
+	var bundle bytes.Buffer
+	for _, file := range []string{s.NewCA, s.NewCross, s.OldCA, s.OldCross} {
+		data, err := helpers.ReadBytes(file)
+		if err != nil {
+			return err
+		}
+		bundle.Write(bytes.TrimSpace(data))
+		bundle.WriteByte('\n')
+	}
+	return ioutil.WriteFile(s.Bundle, bundle.Bytes(), 0644)
+}
+
+// switchCA copies the old CA and key to RetiredCA and RetiredKey and
+// installs the new ones at OldCA and OldKey, so that a signer loading
+// those files, such as cfssl serve on reload, issues from the new key.
+func (s *State) switchCA() error {
+	if s.RetiredCA == "" || s.RetiredKey == "" {
+		return errors.New("rollover state has no location for the retired CA")
+	}
+
+	// The retired certificate is written last, so its presence means
+	// both old files are saved and OldCA and OldKey may be replaced.
+	if _, err := os.Stat(s.RetiredCA); os.IsNotExist(err) {
+		oldKey, err := ioutil.ReadFile(s.OldKey)
+		if err != nil {
+			return err
+		}
+		oldCA, err := ioutil.ReadFile(s.OldCA)
+		if err != nil {
+			return err
+		}
+		if err = writeFile(s.RetiredKey, oldKey, 0600); err != nil {
+			return err
+		}
+		if err = writeFile(s.RetiredCA, oldCA, 0644); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	key, err := ioutil.ReadFile(s.NewKey)
+	if err != nil {
+		return err
+	}
+	ca, err := ioutil.ReadFile(s.NewCA)
+	if err != nil {
+		return err
+	}
+	if err = writeFile(s.OldKey, key, 0600); err != nil {
+		return err
+	}
+	return writeFile(s.OldCA, ca, 0644)
+}
+
+func loadCA(caFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	caBytes, err := helpers.ReadBytes(caFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ca, err := helpers.ParseCertificatePEM(caBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBytes, err := helpers.ReadBytes(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	strPassword := os.Getenv("CFSSL_CA_PK_PASSWORD")
+	password := []byte(strPassword)
+	if strPassword == "" {
+		password = nil
+	}
+
+	key, err := helpers.ParsePrivateKeyPEMWithPassword(keyBytes, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+func keyRequest(pub crypto.PublicKey) (*csr.BasicKeyRequest, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return &csr.BasicKeyRequest{A: "rsa", S: pub.N.BitLen()}, nil
+	case *ecdsa.PublicKey:
+		return &csr.BasicKeyRequest{A: "ecdsa", S: pub.Curve.Params().BitSize}, nil
+	default:
+		return nil, errors.New("unsupported CA key type")
+	}
+}
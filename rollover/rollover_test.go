@@ -0,0 +1,185 @@
+package rollover
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/initca"
+)
+
+func newCA(t *testing.T, dir string) (caFile, keyFile string) {
+	req := &csr.CertificateRequest{
+		CN:         "Rollover Test CA",
+		KeyRequest: &csr.BasicKeyRequest{A: "ecdsa", S: 256},
+		CA:         &csr.CAConfig{Expiry: "8760h"},
+	}
+	cert, _, key, err := initca.New(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile = filepath.Join(dir, "ca.pem")
+	keyFile = filepath.Join(dir, "ca-key.pem")
+	if err = ioutil.WriteFile(caFile, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func readCert(t *testing.T, file string) *x509.Certificate {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := helpers.ParseCertificatePEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRollover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile, keyFile := newCA(t, dir)
+	old := readCert(t, caFile)
+	oldKey, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statePath := filepath.Join(dir, "state.json")
+	if err = Run(statePath, NewState(caFile, keyFile, dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Stage != StageSwitched {
+		t.Fatalf("rollover ended in stage %s", state.Stage)
+	}
+
+	ca := readCert(t, state.NewCA)
+	if !bytes.Equal(ca.RawSubject, old.RawSubject) {
+		t.Fatal("new CA has a different subject")
+	}
+	if bytes.Equal(ca.SubjectKeyId, old.SubjectKeyId) {
+		t.Fatal("new CA reuses the old key")
+	}
+
+	newCross := readCert(t, state.NewCross)
+	if err = newCross.CheckSignatureFrom(old); err != nil {
+		t.Fatalf("new CA cross certificate not signed by the old CA: %v", err)
+	}
+	if !bytes.Equal(newCross.AuthorityKeyId, old.SubjectKeyId) {
+		t.Fatal("new CA cross certificate names the wrong authority key")
+	}
+	if !bytes.Equal(newCross.RawSubjectPublicKeyInfo, ca.RawSubjectPublicKeyInfo) {
+		t.Fatal("new CA cross certificate carries the wrong key")
+	}
+
+	oldCross := readCert(t, state.OldCross)
+	if err = oldCross.CheckSignatureFrom(ca); err != nil {
+		t.Fatalf("old CA cross certificate not signed by the new CA: %v", err)
+	}
+
+	bundle, err := ioutil.ReadFile(state.Bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := helpers.ParseCertificatesPEM(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 4 {
+		t.Fatalf("bundle has %d certificates, want 4", len(certs))
+	}
+
+	// The new CA is installed in place of the old one, which is kept.
+	if !bytes.Equal(readCert(t, caFile).Raw, ca.Raw) {
+		t.Fatal("new CA not installed at the CA path")
+	}
+	newKey, err := ioutil.ReadFile(state.NewKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := ioutil.ReadFile(keyFile); !bytes.Equal(key, newKey) {
+		t.Fatal("new CA key not installed at the CA key path")
+	}
+	if !bytes.Equal(readCert(t, state.RetiredCA).Raw, old.Raw) {
+		t.Fatal("old CA not retired")
+	}
+	if key, _ := ioutil.ReadFile(state.RetiredKey); !bytes.Equal(key, oldKey) {
+		t.Fatal("old CA key not retired")
+	}
+}
+
+func TestRolloverResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rollover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile, keyFile := newCA(t, dir)
+	statePath := filepath.Join(dir, "state.json")
+	state := NewState(caFile, keyFile, dir)
+	if err = state.generate(); err != nil {
+		t.Fatal(err)
+	}
+	state.Stage = StageGenerated
+	if err = state.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+	generated := readCert(t, state.NewCA)
+
+	// Resuming must reuse the key generated before the interruption.
+	state, err = LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Run(statePath, state); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readCert(t, state.NewCA).Raw, generated.Raw) {
+		t.Fatal("resumed rollover regenerated the new CA")
+	}
+	if err = readCert(t, state.OldCross).CheckSignatureFrom(generated); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resuming an interrupted switch must keep the retired CA.
+	state.Stage = StagePublished
+	if err = Run(statePath, state); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(readCert(t, state.RetiredCA).Raw, generated.Raw) {
+		t.Fatal("resumed switch overwrote the retired CA")
+	}
+
+	// A switched rollover has nothing left to do.
+	if err = Run(statePath, state); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunUnknownStage(t *testing.T) {
+	if err := Run("", &State{Stage: "bogus"}); err == nil {
+		t.Fatal("expected an unknown stage to fail")
+	}
+}
@@ -74,11 +74,18 @@ func intermediateCAScan(addr, hostname string) (grade Grade, output Output, err
 		}()
 	}
 	for ip := ipnet.IP.To16(); ipnet.Contains(ip); incrementBytes(ip) {
+		// Stop sweeping the range once the scan is cancelled.
+		if running.cancelled(hostname) {
+			err = errCancelled
+			break
+		}
 		addrs <- net.JoinHostPort(ip.String(), port)
 	}
 	close(addrs)
 	wg.Wait()
 	close(chains)
-	grade = Good
+	if err == nil {
+		grade = Good
+	}
 	return
 }
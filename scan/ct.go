@@ -0,0 +1,352 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+	ct "github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+	"golang.org/x/crypto/ocsp"
+)
+
+// CT contains scanners for the host's Certificate Transparency compliance.
+var CT = &Family{
+	Description: "Scans for Signed Certificate Timestamps of the host's certificate",
+	Scanners: map[string]*Scanner{
+		"SCTs": {
+			"Host's SCTs are signed by known logs",
+			sctsScan,
+		},
+		"Policy": {
+			"Host's valid SCTs come from enough distinct logs and log operators",
+			ctPolicyScan,
+		},
+	},
+}
+
+// CTLog is a Certificate Transparency log that SCTs are verified against.
+type CTLog struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Operator    string `json:"operator"`
+	verifier    *ct.SignatureVerifier
+}
+
+// CTPolicy is the number of distinct logs and log operators a host's
+// valid SCTs must come from.
+type CTPolicy struct {
+	MinLogs      int
+	MinOperators int
+}
+
+// CTConfig is the known logs that SCTs are verified against, by log ID,
+// and the policy graded by the CT Policy scanner.
+type CTConfig struct {
+	Logs   map[[sha256.Size]byte]*CTLog
+	Policy CTPolicy
+}
+
+var (
+	ctConfigLock sync.RWMutex
+	ctConfig     = &CTConfig{Policy: CTPolicy{MinLogs: 2, MinOperators: 2}}
+)
+
+// SetCTConfig sets the configuration of the CT scans started afterwards.
+// Scans already running keep the configuration they started with, so c
+// and its logs mustn't be modified once set.
+func SetCTConfig(c *CTConfig) {
+	ctConfigLock.Lock()
+	defer ctConfigLock.Unlock()
+	ctConfig = c
+}
+
+// currentCTConfig returns the configuration a CT scan uses throughout.
+func currentCTConfig() *CTConfig {
+	ctConfigLock.RLock()
+	defer ctConfigLock.RUnlock()
+	return ctConfig
+}
+
+// ctLogList is a log list in the format published for Chrome, at
+// https://www.gstatic.com/ct/log_list/v3/log_list.json.
+type ctLogList struct {
+	Operators []ctLogOperator `json:"operators"`
+}
+
+type ctLogOperator struct {
+	Name string         `json:"name"`
+	Logs []ctLogListLog `json:"logs"`
+}
+
+type ctLogListLog struct {
+	Description string `json:"description"`
+	Key         []byte `json:"key"`
+	URL         string `json:"url"`
+}
+
+// LoadCTLogList loads the logs that SCTs are verified against from a log
+// list file, by log ID. There are none without a file.
+func LoadCTLogList(logListFile string) (map[[sha256.Size]byte]*CTLog, error) {
+	if logListFile == "" {
+		return nil, nil
+	}
+	log.Debugf("Loading scan CT log list: %s", logListFile)
+
+	data, err := ioutil.ReadFile(logListFile)
+	if err != nil {
+		return nil, err
+	}
+	var list ctLogList
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse CT log list %s: %v", logListFile, err)
+	}
+
+	logs := make(map[[sha256.Size]byte]*CTLog)
+	for _, operator := range list.Operators {
+		for _, l := range operator.Logs {
+			key, err := x509.ParsePKIXPublicKey(l.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse key of CT log %s: %v", l.Description, err)
+			}
+			verifier, err := ct.NewSignatureVerifier(key)
+			if err != nil {
+				return nil, fmt.Errorf("unusable key for CT log %s: %v", l.Description, err)
+			}
+			logs[sha256.Sum256(l.Key)] = &CTLog{l.Description, l.URL, operator.Name, verifier}
+		}
+	}
+	return logs, nil
+}
+
+// Sources of SCTs.
+const (
+	sctFromCertificate = "certificate"
+	sctFromTLS         = "tls"
+	sctFromOCSP        = "ocsp"
+)
+
+// sctListOID is the certificate extension of embedded SCTs.
+var sctListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// sctResult describes an SCT served by the host.
+type sctResult struct {
+	Source    string    `json:"source"`
+	LogID     string    `json:"log_id"`
+	Log       *CTLog    `json:"log,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Valid     bool      `json:"valid"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// precertTBS returns cert's TBSCertificate without its SCT list extension,
+// which is what logs signed for the SCTs embedded in cert.
+func precertTBS(cert *x509.Certificate) ([]byte, error) {
+	var fields []asn1.RawValue
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &fields); err != nil {
+		return nil, err
+	}
+
+	for i, field := range fields {
+		// Extensions are the explicitly tagged [3] field.
+		if field.Class != asn1.ClassContextSpecific || field.Tag != 3 {
+			continue
+		}
+		var exts, kept []asn1.RawValue
+		if _, err := asn1.Unmarshal(field.Bytes, &exts); err != nil {
+			return nil, err
+		}
+		for _, raw := range exts {
+			var ext pkix.Extension
+			if _, err := asn1.Unmarshal(raw.FullBytes, &ext); err != nil {
+				return nil, err
+			}
+			if !ext.Id.Equal(sctListOID) {
+				kept = append(kept, raw)
+			}
+		}
+		b, err := asn1.Marshal(kept)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: b}
+	}
+	return asn1.Marshal(fields)
+}
+
+// verifySCT checks an SCT for the leaf of chain against logs.
+func verifySCT(logs map[[sha256.Size]byte]*CTLog, sct ct.SignedCertificateTimestamp, source string, chain []*x509.Certificate) sctResult {
+	result := sctResult{
+		Source:    source,
+		LogID:     hex.EncodeToString(sct.LogID.KeyID[:]),
+		Timestamp: time.Unix(0, int64(sct.Timestamp)*int64(time.Millisecond)).UTC(),
+		Log:       logs[sct.LogID.KeyID],
+	}
+	if result.Log == nil {
+		result.Error = "unknown log"
+		return result
+	}
+
+	leaf := ct.MerkleTreeLeaf{
+		Version:  ct.V1,
+		LeafType: ct.TimestampedEntryLeafType,
+		TimestampedEntry: &ct.TimestampedEntry{
+			Timestamp: sct.Timestamp,
+			EntryType: ct.X509LogEntryType,
+			X509Entry: &ct.ASN1Cert{Data: chain[0].Raw},
+		},
+	}
+	if source == sctFromCertificate {
+		// Embedded SCTs were issued for the precertificate.
+		if len(chain) < 2 {
+			result.Error = "issuer isn't in the chain"
+			return result
+		}
+		tbs, err := precertTBS(chain[0])
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		leaf.TimestampedEntry.EntryType = ct.PrecertLogEntryType
+		leaf.TimestampedEntry.X509Entry = nil
+		leaf.TimestampedEntry.PrecertEntry = &ct.PreCert{
+			IssuerKeyHash:  sha256.Sum256(chain[1].RawSubjectPublicKeyInfo),
+			TBSCertificate: tbs,
+		}
+	}
+
+	switch err := result.Log.verifier.VerifySCTSignature(sct, ct.LogEntry{Leaf: leaf}); {
+	case err != nil:
+		result.Error = err.Error()
+	case result.Timestamp.After(time.Now()):
+		result.Error = "timestamp is in the future"
+	default:
+		result.Valid = true
+	}
+	return result
+}
+
+// getSCTs collects the SCTs embedded in the host's certificate, sent in the
+// TLS extension and included in its stapled OCSP response, and verifies
+// them against logs.
+func getSCTs(logs map[[sha256.Size]byte]*CTLog, addr, hostname string) (results []sctResult, err error) {
+	state, err := getConnectionState(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+	chain := state.PeerCertificates
+
+	for _, ext := range chain[0].Extensions {
+		if !ext.Id.Equal(sctListOID) {
+			continue
+		}
+		var list []byte
+		if _, err = asn1.Unmarshal(ext.Value, &list); err != nil {
+			return
+		}
+		var scts []ct.SignedCertificateTimestamp
+		if scts, err = helpers.DeserializeSCTList(list); err != nil {
+			return
+		}
+		for _, sct := range scts {
+			results = append(results, verifySCT(logs, sct, sctFromCertificate, chain))
+		}
+	}
+
+	for _, serialized := range state.SignedCertificateTimestamps {
+		var sct ct.SignedCertificateTimestamp
+		if _, err = cttls.Unmarshal(serialized, &sct); err != nil {
+			return
+		}
+		results = append(results, verifySCT(logs, sct, sctFromTLS, chain))
+	}
+
+	if len(state.OCSPResponse) > 0 && len(chain) > 1 {
+		var resp *ocsp.Response
+		if resp, err = ocsp.ParseResponseForCert(state.OCSPResponse, chain[0], chain[1]); err != nil {
+			return
+		}
+		var scts []ct.SignedCertificateTimestamp
+		if scts, err = helpers.SCTListFromOCSPResponse(resp); err != nil {
+			return
+		}
+		for _, sct := range scts {
+			results = append(results, verifySCT(logs, sct, sctFromOCSP, chain))
+		}
+	}
+	return
+}
+
+// sctsScan lists the host's SCTs, grading whether they verify against the
+// known logs. Without known logs, they are listed ungraded.
+func sctsScan(addr, hostname string) (grade Grade, output Output, err error) {
+	logs := currentCTConfig().Logs
+	results, err := getSCTs(logs, addr, hostname)
+	if err != nil {
+		return
+	}
+	if len(results) == 0 {
+		return Warning, nil, nil
+	}
+
+	output = results
+	if len(logs) == 0 {
+		return Skipped, output, nil
+	}
+	grade = Good
+	for _, result := range results {
+		switch {
+		case result.Log == nil:
+			if grade == Good {
+				grade = Warning
+			}
+		case !result.Valid:
+			grade = Bad
+			err = fmt.Errorf("invalid SCT from %s: %s", result.Log.Description, result.Error)
+		}
+	}
+	return
+}
+
+// ctPolicyScan tests that the host's valid SCTs come from at least as many
+// distinct logs and log operators as the CT policy requires.
+func ctPolicyScan(addr, hostname string) (grade Grade, output Output, err error) {
+	c := currentCTConfig()
+	if len(c.Logs) == 0 {
+		// SCTs can't be verified without known logs.
+		return Skipped, nil, nil
+	}
+	results, err := getSCTs(c.Logs, addr, hostname)
+	if err != nil {
+		return
+	}
+
+	logs := make(map[string]bool)
+	operators := make(map[string]bool)
+	for _, result := range results {
+		if result.Valid {
+			logs[result.LogID] = true
+			operators[result.Log.Operator] = true
+		}
+	}
+	output = map[string]int{"logs": len(logs), "operators": len(operators)}
+
+	switch {
+	case len(logs) < c.Policy.MinLogs:
+		err = fmt.Errorf("host has valid SCTs from %d logs, %d are required", len(logs), c.Policy.MinLogs)
+	case len(operators) < c.Policy.MinOperators:
+		err = fmt.Errorf("host has valid SCTs from %d log operators, %d are required", len(operators), c.Policy.MinOperators)
+	default:
+		grade = Good
+	}
+	return
+}
@@ -0,0 +1,278 @@
+package scan
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/helpers"
+	ct "github.com/google/certificate-transparency-go"
+	cttls "github.com/google/certificate-transparency-go/tls"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testCTLog signs SCTs for a log run by operator.
+type testCTLog struct {
+	operator string
+	key      *ecdsa.PrivateKey
+	der      []byte
+}
+
+func newTestCTLog(t *testing.T, operator string) *testCTLog {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCTLog{operator, key, der}
+}
+
+func (l *testCTLog) sign(t *testing.T, entry ct.TimestampedEntry) ct.SignedCertificateTimestamp {
+	sct := ct.SignedCertificateTimestamp{
+		SCTVersion: ct.V1,
+		LogID:      ct.LogID{KeyID: sha256.Sum256(l.der)},
+		Timestamp:  uint64(time.Now().Add(-time.Minute).UnixNano() / int64(time.Millisecond)),
+	}
+	entry.Timestamp = sct.Timestamp
+	input, err := ct.SerializeSCTSignatureInput(sct, ct.LogEntry{Leaf: ct.MerkleTreeLeaf{TimestampedEntry: &entry}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := cttls.CreateSignature(*l.key, cttls.SHA256, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct.Signature = ct.DigitallySigned(sig)
+	return sct
+}
+
+// writeCTLogList writes a log list of logs and returns the logs loaded
+// from it.
+func writeCTLogList(t *testing.T, logs ...*testCTLog) map[[sha256.Size]byte]*CTLog {
+	var list ctLogList
+	operators := make(map[string]int)
+	for _, l := range logs {
+		i, ok := operators[l.operator]
+		if !ok {
+			i = len(list.Operators)
+			operators[l.operator] = i
+			list.Operators = append(list.Operators, ctLogOperator{Name: l.operator})
+		}
+		list.Operators[i].Logs = append(list.Operators[i].Logs, ctLogListLog{l.operator + " log", l.der, "https://ct.example.com/"})
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "ct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log_list.json")
+	if err = ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCTLogList(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func serializeSCTs(t *testing.T, scts ...ct.SignedCertificateTimestamp) []byte {
+	list, err := helpers.SerializeSCTList(scts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := asn1.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// serveSCTs starts a server whose certificate embeds an SCT from embedded,
+// which also sends an SCT from tlsLog and staples one from ocspLog.
+func serveSCTs(t *testing.T, embedded, tlsLog, ocspLog *testCTLog) net.Listener {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CT Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The TBSCertificate of a certificate issued without the SCT list
+	// stands in for the precertificate's.
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err = x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := embedded.sign(t, ct.TimestampedEntry{
+		EntryType: ct.PrecertLogEntryType,
+		PrecertEntry: &ct.PreCert{
+			IssuerKeyHash:  sha256.Sum256(ca.RawSubjectPublicKeyInfo),
+			TBSCertificate: precert.RawTBSCertificate,
+		},
+	})
+	template.ExtraExtensions = []pkix.Extension{{Id: sctListOID, Value: serializeSCTs(t, sct)}}
+	der, err = x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x509Entry := ct.TimestampedEntry{EntryType: ct.X509LogEntryType, X509Entry: &ct.ASN1Cert{Data: leaf.Raw}}
+	tlsSCT, err := cttls.Marshal(tlsLog.sign(t, x509Entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	staple, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Hour),
+		NextUpdate:   time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{
+			Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5},
+			Value: serializeSCTs(t, ocspLog.sign(t, x509Entry)),
+		}},
+	}, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := serveTLS(t, &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate:                 [][]byte{leaf.Raw, ca.Raw},
+			PrivateKey:                  ecdsaSigner{key},
+			OCSPStaple:                  staple,
+			SignedCertificateTimestamps: [][]byte{tlsSCT},
+		}},
+	})
+	return l
+}
+
+func TestCTScans(t *testing.T) {
+	defer SetCTConfig(currentCTConfig())
+	policy := CTPolicy{MinLogs: 2, MinOperators: 2}
+
+	a, b := newTestCTLog(t, "A"), newTestCTLog(t, "B")
+	l := serveSCTs(t, a, b, b)
+	defer l.Close()
+	addr := l.Addr().String()
+
+	// Without a log list, no SCT can be verified, so they are only
+	// listed.
+	SetCTConfig(&CTConfig{Policy: policy})
+	if output := expectGrade(t, "SCTs", sctsScan, addr, Skipped); len(output.([]sctResult)) != 3 {
+		t.Fatalf("expected the SCTs to be listed, have %+v", output)
+	}
+	expectGrade(t, "Policy", ctPolicyScan, addr, Skipped)
+
+	logs := writeCTLogList(t, a, b)
+	SetCTConfig(&CTConfig{Logs: logs, Policy: policy})
+	output := expectGrade(t, "SCTs", sctsScan, addr, Good)
+	results := output.([]sctResult)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 SCTs, have %+v", results)
+	}
+	for i, source := range []string{sctFromCertificate, sctFromTLS, sctFromOCSP} {
+		if results[i].Source != source || !results[i].Valid {
+			t.Fatalf("unexpected SCT %+v", results[i])
+		}
+	}
+	output = expectGrade(t, "Policy", ctPolicyScan, addr, Good)
+	if counts := output.(map[string]int); counts["logs"] != 2 || counts["operators"] != 2 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+
+	SetCTConfig(&CTConfig{Logs: logs, Policy: CTPolicy{MinLogs: 3, MinOperators: 2}})
+	expectGrade(t, "Policy", ctPolicyScan, addr, Bad)
+
+	// Two logs of one operator.
+	c := newTestCTLog(t, "A")
+	logs = writeCTLogList(t, a, c)
+	SetCTConfig(&CTConfig{Logs: logs, Policy: policy})
+	sameOperator := serveSCTs(t, a, c, c)
+	defer sameOperator.Close()
+	addr = sameOperator.Addr().String()
+	expectGrade(t, "Policy", ctPolicyScan, addr, Bad)
+	SetCTConfig(&CTConfig{Logs: logs, Policy: CTPolicy{MinLogs: 2, MinOperators: 1}})
+	expectGrade(t, "Policy", ctPolicyScan, addr, Good)
+
+	// An SCT from a log that isn't in the list.
+	unlisted := serveSCTs(t, a, b, c)
+	defer unlisted.Close()
+	addr = unlisted.Addr().String()
+	expectGrade(t, "SCTs", sctsScan, addr, Warning)
+}
+
+func TestCTScansInvalidSCT(t *testing.T) {
+	defer SetCTConfig(currentCTConfig())
+
+	a := newTestCTLog(t, "A")
+	SetCTConfig(&CTConfig{Logs: writeCTLogList(t, a), Policy: CTPolicy{MinLogs: 2, MinOperators: 2}})
+	// SCTs claiming to be from a, signed by another key.
+	forged := newTestCTLog(t, "A")
+	forged.der = a.der
+
+	l := serveSCTs(t, forged, forged, forged)
+	defer l.Close()
+	addr := l.Addr().String()
+	output := expectGrade(t, "SCTs", sctsScan, addr, Bad)
+	for _, result := range output.([]sctResult) {
+		if result.Valid || result.Error == "" {
+			t.Fatalf("expected an invalid SCT, have %+v", result)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// runFileFormat names run files by time so that they sort in order.
+const runFileFormat = "20060102T150405.000000000Z.json"
+
+// fileStore keeps each run in a JSON file, in a directory per host.
+type fileStore struct {
+	dir string
+}
+
+// NewFileStore returns a Store keeping runs in dir.
+func NewFileStore(dir string) Store {
+	return &fileStore{dir}
+}
+
+func (s *fileStore) hostDir(host string) string {
+	return filepath.Join(s.dir, url.QueryEscape(host))
+}
+
+func (s *fileStore) Put(run *Run) error {
+	dir := s.hostDir(run.Host)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, run.Time.UTC().Format(runFileFormat)), data, 0644)
+}
+
+func (s *fileStore) Last(host string, before time.Time) (*Run, error) {
+	dir := s.hostDir(host)
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	limit := before.UTC().Format(runFileFormat)
+	var names []string
+	for _, info := range infos {
+		if _, err := time.Parse(runFileFormat, info.Name()); err == nil && info.Name() < limit {
+			names = append(names, info.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, names[len(names)-1]))
+	if err != nil {
+		return nil, err
+	}
+	run := new(Run)
+	if err = json.Unmarshal(data, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
@@ -0,0 +1,189 @@
+// Package history stores scan results per host and run, and reports what
+// changed between runs.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan"
+)
+
+// A Run is the results of scanning a host at a point in time.
+type Run struct {
+	Host    string                       `json:"host"`
+	Time    time.Time                    `json:"time"`
+	Results map[string]scan.FamilyResult `json:"results"`
+}
+
+// A Store keeps the runs of each host.
+type Store interface {
+	// Put stores a run.
+	Put(run *Run) error
+	// Last returns the most recent run of host before t, or nil if
+	// there is none.
+	Last(host string, before time.Time) (*Run, error)
+}
+
+// A Change is a difference in the result of a scanner between two runs.
+// Grades and outputs are empty where the scanner didn't run.
+type Change struct {
+	Family    string      `json:"family"`
+	Scanner   string      `json:"scanner"`
+	OldGrade  string      `json:"old_grade,omitempty"`
+	NewGrade  string      `json:"new_grade,omitempty"`
+	OldOutput interface{} `json:"old_output,omitempty"`
+	NewOutput interface{} `json:"new_output,omitempty"`
+	OldError  string      `json:"old_error,omitempty"`
+	NewError  string      `json:"new_error,omitempty"`
+}
+
+// A Report lists the changes in a host's results since its previous run,
+// and summarizes those that are regressions.
+type Report struct {
+	Host        string     `json:"host"`
+	Previous    *time.Time `json:"previous,omitempty"`
+	Current     time.Time  `json:"current"`
+	Changes     []Change   `json:"changes"`
+	Regressions []string   `json:"regressions"`
+}
+
+// gradeRanks orders the grades that can regress; Skipped is unranked.
+var gradeRanks = map[string]int{
+	scan.Bad.String():     0,
+	scan.Warning.String(): 1,
+	scan.Good.String():    2,
+}
+
+// A regressionFunc summarizes the regressions between the old and new
+// outputs of a scanner.
+type regressionFunc func(old, new interface{}) []string
+
+// regressions are the output checks of scanners, by family and scanner.
+var regressions = map[string]regressionFunc{
+	"TLSHandshake/CipherSuite": newCipherSuites,
+	"PKI/Chain":                shorterChain,
+}
+
+// cipherSuites returns the names of the cipher suites in the output of the
+// CipherSuite scanner.
+func cipherSuites(output interface{}) map[string]bool {
+	suites := make(map[string]bool)
+	list, _ := output.([]interface{})
+	for _, entry := range list {
+		m, _ := entry.(map[string]interface{})
+		for suite := range m {
+			suites[suite] = true
+		}
+	}
+	return suites
+}
+
+func newCipherSuites(old, new interface{}) (summary []string) {
+	accepted := cipherSuites(old)
+	for suite := range cipherSuites(new) {
+		if !accepted[suite] {
+			summary = append(summary, fmt.Sprintf("cipher suite %s is newly accepted", suite))
+		}
+	}
+	sort.Strings(summary)
+	return
+}
+
+func shorterChain(old, new interface{}) []string {
+	oldChain, _ := old.([]interface{})
+	newChain, _ := new.([]interface{})
+	if len(newChain) < len(oldChain) {
+		return []string{fmt.Sprintf("chain got shorter, from %d to %d certificates", len(oldChain), len(newChain))}
+	}
+	return nil
+}
+
+// normalize returns run as it is after being stored, with outputs decoded
+// from JSON, so that results are compared the same way whether or not they
+// were stored.
+func normalize(run *Run) (*Run, error) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return nil, err
+	}
+	normalized := new(Run)
+	err = json.Unmarshal(data, normalized)
+	return normalized, err
+}
+
+// Diff reports the changes from the previous run, which may be nil, to the
+// current one.
+func Diff(previous, current *Run) (*Report, error) {
+	current, err := normalize(current)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		Host:        current.Host,
+		Current:     current.Time,
+		Changes:     []Change{},
+		Regressions: []string{},
+	}
+	if previous == nil {
+		return report, nil
+	}
+	if previous, err = normalize(previous); err != nil {
+		return nil, err
+	}
+	report.Previous = &previous.Time
+
+	names := make(map[[2]string]bool)
+	for _, run := range []*Run{previous, current} {
+		for family, results := range run.Results {
+			for scanner := range results {
+				names[[2]string{family, scanner}] = true
+			}
+		}
+	}
+	sorted := make([][2]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i][0] < sorted[j][0] || sorted[i][0] == sorted[j][0] && sorted[i][1] < sorted[j][1]
+	})
+
+	for _, name := range sorted {
+		family, scanner := name[0], name[1]
+		old, hadOld := previous.Results[family][scanner]
+		cur, hasCur := current.Results[family][scanner]
+		if hadOld == hasCur && reflect.DeepEqual(old, cur) {
+			continue
+		}
+		report.Changes = append(report.Changes, Change{
+			Family:    family,
+			Scanner:   scanner,
+			OldGrade:  old.Grade,
+			NewGrade:  cur.Grade,
+			OldOutput: old.Output,
+			NewOutput: cur.Output,
+			OldError:  old.Error,
+			NewError:  cur.Error,
+		})
+		if !hadOld || !hasCur {
+			continue
+		}
+
+		id := family + "/" + scanner
+		oldRank, oldRanked := gradeRanks[old.Grade]
+		newRank, newRanked := gradeRanks[cur.Grade]
+		if oldRanked && newRanked && newRank < oldRank {
+			report.Regressions = append(report.Regressions, fmt.Sprintf("%s: grade went from %s to %s", id, old.Grade, cur.Grade))
+		}
+		if regression, ok := regressions[id]; ok {
+			for _, summary := range regression(old.Output, cur.Output) {
+				report.Regressions = append(report.Regressions, id+": "+summary)
+			}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,167 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/scan"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3" // register sqlite3 driver
+)
+
+func newRun(host string, t time.Time, suites []string, chain []string, grade scan.Grade) *Run {
+	var suiteOutput []map[string]interface{}
+	for _, suite := range suites {
+		suiteOutput = append(suiteOutput, map[string]interface{}{suite: []string{"TLS 1.2"}})
+	}
+	return &Run{
+		Host: host,
+		Time: t,
+		Results: map[string]scan.FamilyResult{
+			"TLSHandshake": {
+				"CipherSuite": {Grade: scan.Good.String(), Output: suiteOutput},
+			},
+			"PKI": {
+				"Chain":           {Grade: scan.Good.String(), Output: chain},
+				"ChainValidation": {Grade: grade.String()},
+			},
+		},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	now := time.Now().UTC()
+	current := newRun("example.com", now, []string{"TLS_AES_128_GCM_SHA256", "TLS_RSA_WITH_RC4_128_SHA"}, []string{"leaf"}, scan.Warning)
+
+	report, err := Diff(nil, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 0 || len(report.Regressions) != 0 || report.Previous != nil {
+		t.Fatalf("expected no changes without a previous run, have %+v", report)
+	}
+
+	previous := newRun("example.com", now.Add(-time.Hour), []string{"TLS_AES_128_GCM_SHA256"}, []string{"leaf", "intermediate"}, scan.Good)
+	report, err = Diff(previous, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 3 {
+		t.Fatalf("expected 3 changes, have %+v", report.Changes)
+	}
+	expected := []string{
+		"PKI/Chain: chain got shorter, from 2 to 1 certificates",
+		"PKI/ChainValidation: grade went from Good to Warning",
+		"TLSHandshake/CipherSuite: cipher suite TLS_RSA_WITH_RC4_128_SHA is newly accepted",
+	}
+	if !reflect.DeepEqual(report.Regressions, expected) {
+		t.Fatalf("unexpected regressions %q", report.Regressions)
+	}
+
+	// Improvements and unchanged results aren't regressions.
+	report, err = Diff(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 3 || len(report.Regressions) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	report, err = Diff(current, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 0 {
+		t.Fatalf("unexpected changes %+v", report.Changes)
+	}
+
+	// A scanner that didn't run is a change, but not a regression.
+	delete(current.Results, "PKI")
+	report, err = Diff(previous, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Changes) != 3 || len(report.Regressions) != 1 || report.Changes[0].NewGrade != "" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	now := time.Now().UTC()
+	if run, err := store.Last("example.com:443", now); err != nil || run != nil {
+		t.Fatalf("expected no run, have %v %v", run, err)
+	}
+
+	first := newRun("example.com:443", now.Add(-2*time.Hour), []string{"TLS_AES_128_GCM_SHA256"}, []string{"leaf"}, scan.Good)
+	second := newRun("example.com:443", now.Add(-time.Hour), nil, []string{"leaf"}, scan.Bad)
+	other := newRun("example.org:443", now.Add(-time.Minute), nil, nil, scan.Good)
+	for _, run := range []*Run{first, second, other} {
+		if err := store.Put(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for before, expected := range map[time.Time]*Run{
+		now:                               second,
+		second.Time:                       first,
+		first.Time.Add(time.Millisecond):  first,
+		first.Time.Add(-time.Millisecond): nil,
+	} {
+		run, err := store.Last("example.com:443", before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected == nil {
+			if run != nil {
+				t.Fatalf("expected no run before %v, have %+v", before, run)
+			}
+			continue
+		}
+		if run == nil || !run.Time.Equal(expected.Time) || run.Host != expected.Host {
+			t.Fatalf("expected the run at %v before %v, have %+v", expected.Time, before, run)
+		}
+		// Stored results only differ in how outputs are decoded.
+		if report, err := Diff(expected, run); err != nil || len(report.Changes) != 0 {
+			t.Fatalf("stored run differs: %+v %v", report, err)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testStore(t, NewFileStore(dir))
+}
+
+func TestSQLStore(t *testing.T) {
+	data, err := ioutil.ReadFile("../../certdb/testdb/certstore_development.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "certstore.db")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("DELETE FROM scan_results;"); err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, NewSQLStore(db))
+}
@@ -0,0 +1,54 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	insertRunSQL = `
+INSERT INTO scan_results (host, scanned_at, results)
+	VALUES (?, ?, ?);`
+
+	selectLastRunSQL = `
+SELECT scanned_at, results FROM scan_results
+	WHERE host = ? AND scanned_at < ?
+	ORDER BY scanned_at DESC LIMIT 1;`
+)
+
+// sqlStore keeps runs in the scan_results table of a certdb database.
+type sqlStore struct {
+	db *sqlx.DB
+}
+
+// NewSQLStore returns a Store keeping runs in db.
+func NewSQLStore(db *sqlx.DB) Store {
+	return &sqlStore{db}
+}
+
+func (s *sqlStore) Put(run *Run) error {
+	results, err := json.Marshal(run.Results)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(s.db.Rebind(insertRunSQL), run.Host, run.Time.UTC(), results)
+	return err
+}
+
+func (s *sqlStore) Last(host string, before time.Time) (*Run, error) {
+	run := &Run{Host: host}
+	var results []byte
+	err := s.db.QueryRow(s.db.Rebind(selectLastRunSQL), host, before.UTC()).Scan(&run.Time, &results)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(results, &run.Results); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
@@ -0,0 +1,353 @@
+package scan
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP contains scanners for the security of the host's HTTP deployment.
+var HTTP = &Family{
+	Description: "Scans for the security of the host's HTTP headers, redirects and content",
+	Scanners: map[string]*Scanner{
+		"HSTS": {
+			"Host sends a strict HTTP Strict-Transport-Security policy",
+			hstsScan,
+		},
+		"HTTPSRedirect": {
+			"Host redirects plain HTTP requests to HTTPS",
+			httpsRedirectScan,
+		},
+		"MixedContent": {
+			"Host's landing page loads no resources over plain HTTP",
+			mixedContentScan,
+		},
+		"RedirectCertificate": {
+			"Hosts the host redirects to have certificates matching their names",
+			redirectCertificateScan,
+		},
+	},
+}
+
+const (
+	// hstsMinMaxAge is the max-age, a year, that HSTS policies should have,
+	// and the least the HSTS preload list accepts.
+	hstsMinMaxAge = 365 * 24 * 60 * 60
+	// maxRedirects bounds the redirects followed from the host.
+	maxRedirects = 10
+	// maxLandingPage bounds the size of the landing page read for mixed
+	// content.
+	maxLandingPage = 1 << 20
+)
+
+// httpPort is the port plain HTTP requests are sent to.
+var httpPort = "80"
+
+// httpClient returns a client for requests to hostname that connects to
+// addr's host instead, and that doesn't follow redirects. Certificates aren't
+// verified, so that requests to hosts with bad certificates can be scanned.
+func httpClient(addr, hostname string) *http.Client {
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip = addr
+	}
+	dial := func(network, a string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(a); err == nil && strings.EqualFold(host, hostname) {
+			a = net.JoinHostPort(ip, port)
+		}
+		return Dialer.Dial(network, a)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Dial: dial,
+			DialTLS: func(network, a string) (net.Conn, error) {
+				host, _, err := net.SplitHostPort(a)
+				if err != nil {
+					return nil, err
+				}
+				conn, err := dial(network, a)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, defaultTLSConfig(host))
+				if err = tlsConn.Handshake(); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: 10 * time.Second,
+	}
+}
+
+// hostURL returns the URL of the host's landing page over scheme, on port
+// unless it is the scheme's default.
+func hostURL(scheme, hostname, port string) string {
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		return scheme + "://" + hostname + "/"
+	}
+	return scheme + "://" + net.JoinHostPort(hostname, port) + "/"
+}
+
+// landingURL returns the URL of the landing page addr serves for hostname.
+func landingURL(addr, hostname string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		port = "443"
+	}
+	return hostURL("https", hostname, port)
+}
+
+// A redirect is a response redirecting a request to another URL.
+type redirect struct {
+	From   string `json:"from"`
+	Status int    `json:"status"`
+	To     string `json:"to"`
+}
+
+// follow requests url and the URLs it redirects to, returning the redirects
+// and the final response, whose body the caller must close.
+func follow(client *http.Client, url string) (redirects []redirect, resp *http.Response, err error) {
+	for len(redirects) <= maxRedirects {
+		resp, err = client.Get(url)
+		if err != nil {
+			return
+		}
+		location, locErr := resp.Location()
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || locErr != nil {
+			return
+		}
+		resp.Body.Close()
+		redirects = append(redirects, redirect{url, resp.StatusCode, location.String()})
+		url = location.String()
+	}
+	return redirects, nil, fmt.Errorf("more than %d redirects", maxRedirects)
+}
+
+// hstsPolicy is a parsed Strict-Transport-Security header.
+type hstsPolicy struct {
+	MaxAge            int64 `json:"max_age"`
+	IncludeSubDomains bool  `json:"include_subdomains"`
+	Preload           bool  `json:"preload"`
+}
+
+// parseHSTS parses the directives of a Strict-Transport-Security header.
+func parseHSTS(header string) (policy hstsPolicy, err error) {
+	var hasMaxAge bool
+	for _, directive := range strings.Split(header, ";") {
+		name, value := strings.TrimSpace(directive), ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+		}
+		switch strings.ToLower(name) {
+		case "max-age":
+			if policy.MaxAge, err = strconv.ParseInt(value, 10, 64); err != nil || policy.MaxAge < 0 {
+				return policy, fmt.Errorf("invalid max-age %q", value)
+			}
+			hasMaxAge = true
+		case "includesubdomains":
+			policy.IncludeSubDomains = true
+		case "preload":
+			policy.Preload = true
+		}
+	}
+	if !hasMaxAge {
+		err = errors.New("no max-age in Strict-Transport-Security header")
+	}
+	return
+}
+
+// hstsScan tests that the host's landing page sends an HSTS policy with a
+// max-age of at least a year that includes subdomains.
+func hstsScan(addr, hostname string) (grade Grade, output Output, err error) {
+	resp, err := httpClient(addr, hostname).Get(landingURL(addr, hostname))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+
+	header := resp.Header.Get("Strict-Transport-Security")
+	if header == "" {
+		err = errors.New("host sends no Strict-Transport-Security header")
+		return
+	}
+	policy, err := parseHSTS(header)
+	if err != nil {
+		return
+	}
+	output = policy
+
+	switch {
+	case policy.MaxAge == 0:
+		err = errors.New("HSTS policy has a max-age of 0, which disables it")
+	case policy.MaxAge < hstsMinMaxAge || !policy.IncludeSubDomains:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// httpsRedirectScan tests that the host redirects plain HTTP requests to
+// HTTPS, ideally in its first redirect.
+func httpsRedirectScan(addr, hostname string) (grade Grade, output Output, err error) {
+	redirects, resp, err := follow(httpClient(addr, hostname), hostURL("http", hostname, httpPort))
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if len(redirects) == 0 && err != nil {
+		// A host that doesn't serve plain HTTP at all can't be downgraded.
+		return Skipped, nil, nil
+	}
+	output = redirects
+	if err != nil {
+		return
+	}
+
+	switch {
+	case len(redirects) == 0:
+		err = errors.New("host serves its landing page over plain HTTP")
+	case !strings.HasPrefix(resp.Request.URL.String(), "https:"):
+		err = errors.New("host's redirects don't reach HTTPS")
+	case !strings.HasPrefix(redirects[0].To, "https:"):
+		// The first redirect isn't covered by the host's HSTS policy.
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// mixedContentRegexp matches the elements of a page that load resources, and
+// their plain HTTP URLs.
+var mixedContentRegexp = regexp.MustCompile(`(?is)<(script|iframe|frame|object|embed|link|img|audio|video|source)\b[^>]*?\s(?:src|href|data)\s*=\s*["']?(http://[^"'\s>]+)`)
+
+// passiveContent are the elements whose resources can't alter the rest of
+// the page, so that loading them over plain HTTP isn't as severe.
+var passiveContent = map[string]bool{
+	"img":    true,
+	"audio":  true,
+	"video":  true,
+	"source": true,
+}
+
+// mixedContent is a resource loaded over plain HTTP by an HTTPS page.
+type mixedContent struct {
+	Element string `json:"element"`
+	URL     string `json:"url"`
+}
+
+// mixedContentScan tests that the host's HTTPS landing page doesn't load
+// resources over plain HTTP. Scripts, frames and stylesheets loaded that way
+// are graded Bad, and images and media Warning.
+func mixedContentScan(addr, hostname string) (grade Grade, output Output, err error) {
+	_, resp, err := follow(httpClient(addr, hostname), landingURL(addr, hostname))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.Request.URL.Scheme != "https" || !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		grade = Skipped
+		return
+	}
+
+	page, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxLandingPage))
+	if err != nil {
+		return
+	}
+
+	grade = Good
+	found := []mixedContent{}
+	for _, match := range mixedContentRegexp.FindAllStringSubmatch(string(page), -1) {
+		element := strings.ToLower(match[1])
+		found = append(found, mixedContent{element, match[2]})
+		if !passiveContent[element] {
+			grade = Bad
+		} else if grade == Good {
+			grade = Warning
+		}
+	}
+	output = found
+	if grade == Bad {
+		err = errors.New("landing page loads active content over plain HTTP")
+	}
+	return
+}
+
+// redirectTarget is a host redirected to, and the problem with its
+// certificate, if any.
+type redirectTarget struct {
+	Host  string `json:"host"`
+	Error string `json:"error,omitempty"`
+}
+
+// redirectCertificateScan tests that the HTTPS hosts redirected to from the
+// host's plain HTTP and HTTPS landing pages have certificates valid for their
+// names. Redirects to the scanned host and port itself are left to the PKI
+// family.
+func redirectCertificateScan(addr, hostname string) (grade Grade, output Output, err error) {
+	client := httpClient(addr, hostname)
+	redirects, resp, err := follow(client, landingURL(addr, hostname))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	if plain, resp, err := follow(client, hostURL("http", hostname, httpPort)); err == nil {
+		resp.Body.Close()
+		redirects = append(redirects, plain...)
+	}
+
+	self, err := neturl.Parse(landingURL(addr, hostname))
+	if err != nil {
+		return
+	}
+	seen := map[string]bool{self.Host: true}
+	targets := []redirectTarget{}
+	for _, r := range redirects {
+		to, err := neturl.Parse(r.To)
+		if err != nil || to.Scheme != "https" || seen[to.Host] {
+			continue
+		}
+		seen[to.Host] = true
+
+		target := redirectTarget{Host: to.Host}
+		port := to.Port()
+		if port == "" {
+			port = "443"
+		}
+		chain, err := getChain(net.JoinHostPort(to.Hostname(), port), defaultTLSConfig(to.Hostname()))
+		if err == nil {
+			err = chain[0].VerifyHostname(to.Hostname())
+		}
+		if err != nil {
+			target.Error = err.Error()
+		}
+		targets = append(targets, target)
+	}
+	output = targets
+
+	grade = Good
+	for _, target := range targets {
+		if target.Error != "" {
+			grade = Bad
+			err = fmt.Errorf("certificate of redirect target %s is invalid: %s", target.Host, target.Error)
+			break
+		}
+	}
+	return
+}
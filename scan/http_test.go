@@ -0,0 +1,201 @@
+package scan
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serveHTTPS serves handler over TLS with a certificate for localhost.
+func serveHTTPS(t *testing.T, handler http.HandlerFunc) net.Listener {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: ecdsaSigner{key}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(l, handler)
+	return l
+}
+
+// servePlainHTTP serves handler over plain HTTP on the port HTTP scans use,
+// until stop is called.
+func servePlainHTTP(handler http.HandlerFunc) (stop func()) {
+	ts := httptest.NewServer(handler)
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	defaultPort := httpPort
+	httpPort = port
+	return func() {
+		ts.Close()
+		httpPort = defaultPort
+	}
+}
+
+func redirectTo(url string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, url, http.StatusMovedPermanently)
+	}
+}
+
+func TestParseHSTS(t *testing.T) {
+	for header, expected := range map[string]hstsPolicy{
+		"max-age=31536000":                              {MaxAge: 31536000},
+		`Max-Age="300"; includeSubDomains`:              {MaxAge: 300, IncludeSubDomains: true},
+		"max-age=63072000; includeSubDomains; preload;": {MaxAge: 63072000, IncludeSubDomains: true, Preload: true},
+	} {
+		policy, err := parseHSTS(header)
+		if err != nil || policy != expected {
+			t.Fatalf("%s: expected %+v, have %+v (%v)", header, expected, policy, err)
+		}
+	}
+	for _, header := range []string{"includeSubDomains", "max-age=-1", "max-age=forever"} {
+		if _, err := parseHSTS(header); err == nil {
+			t.Fatalf("%s: expected an error", header)
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	var header string
+	l := serveHTTPS(t, func(w http.ResponseWriter, r *http.Request) {
+		if header != "" {
+			w.Header().Set("Strict-Transport-Security", header)
+		}
+	})
+	defer l.Close()
+	addr := l.Addr().String()
+
+	for value, grade := range map[string]Grade{
+		"max-age=63072000; includeSubDomains; preload": Good,
+		"max-age=63072000":               Warning,
+		"max-age=300; includeSubDomains": Warning,
+		"max-age=0":                      Bad,
+		"":                               Bad,
+	} {
+		header = value
+		expectGrade(t, "HSTS "+value, hstsScan, addr, grade)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	var handler http.HandlerFunc
+	stop := servePlainHTTP(func(w http.ResponseWriter, r *http.Request) { handler(w, r) })
+	defer stop()
+	l := serveHTTPS(t, func(w http.ResponseWriter, r *http.Request) {})
+	defer l.Close()
+	addr := l.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	landing := "https://localhost:" + port + "/"
+
+	handler = redirectTo(landing)
+	output := expectGrade(t, "redirect to HTTPS", httpsRedirectScan, addr, Good)
+	if redirects := output.([]redirect); len(redirects) != 1 || redirects[0].To != landing {
+		t.Fatalf("unexpected redirects %+v", redirects)
+	}
+
+	// Redirecting to another plain HTTP page first.
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/www", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, landing, http.StatusFound)
+	}
+	expectGrade(t, "indirect redirect to HTTPS", httpsRedirectScan, addr, Warning)
+
+	handler = func(w http.ResponseWriter, r *http.Request) {}
+	expectGrade(t, "no redirect", httpsRedirectScan, addr, Bad)
+
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/www", http.StatusFound)
+		}
+	}
+	expectGrade(t, "redirect within HTTP", httpsRedirectScan, addr, Bad)
+
+	httpPort = "0"
+	expectGrade(t, "no HTTP", httpsRedirectScan, addr, Skipped)
+}
+
+func TestMixedContent(t *testing.T) {
+	var page string
+	l := serveHTTPS(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page)
+	})
+	defer l.Close()
+	addr := l.Addr().String()
+
+	for content, grade := range map[string]Grade{
+		`<a href="http://example.com/">link</a><img src="https://example.com/a.png">`: Good,
+		`<IMG alt="a" SRC='http://example.com/a.png'>`:                                Warning,
+		`<img src="http://example.com/a.png"><script src="http://example.com/a.js">`:  Bad,
+		"<link rel=stylesheet href=http://example.com/a.css>":                         Bad,
+	} {
+		page = "<html><body>" + content + "</body></html>"
+		expectGrade(t, content, mixedContentScan, addr, grade)
+	}
+
+	page = `<img src="http://example.com/a.png"><iframe src="http://example.com/">`
+	output := expectGrade(t, "output", mixedContentScan, addr, Bad)
+	expected := []mixedContent{{"img", "http://example.com/a.png"}, {"iframe", "http://example.com/"}}
+	if !reflect.DeepEqual(output, expected) {
+		t.Fatalf("expected %+v, have %+v", expected, output)
+	}
+}
+
+func TestRedirectCertificate(t *testing.T) {
+	target := serveHTTPS(t, func(w http.ResponseWriter, r *http.Request) {})
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Addr().String())
+	stop := servePlainHTTP(func(w http.ResponseWriter, r *http.Request) {})
+	defer stop()
+
+	var location string
+	l := serveHTTPS(t, func(w http.ResponseWriter, r *http.Request) {
+		if location != "" {
+			redirectTo(location)(w, r)
+		}
+	})
+	defer l.Close()
+	addr := l.Addr().String()
+
+	expectGrade(t, "no redirect", redirectCertificateScan, addr, Good)
+
+	location = "https://localhost:" + port + "/"
+	output := expectGrade(t, "matching certificate", redirectCertificateScan, addr, Good)
+	if targets := output.([]redirectTarget); len(targets) != 1 || targets[0].Host != "localhost:"+port {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+
+	// The target's certificate is only valid for localhost.
+	location = "https://127.0.0.1:" + port + "/"
+	expectGrade(t, "mismatched certificate", redirectCertificateScan, addr, Bad)
+}
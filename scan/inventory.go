@@ -0,0 +1,127 @@
+package scan
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/log"
+)
+
+// A Target is a host named by issued certificates, and the newest of them.
+type Target struct {
+	Host   string
+	Newest *x509.Certificate
+	// Issued are all the certificates issued for the host.
+	Issued []*x509.Certificate
+}
+
+// TargetsFromCertDB returns a target for each DNS name of the unexpired,
+// unrevoked certificates in the certdb, sorted by host. If label or profile
+// aren't empty, only certificates issued by that CA label or profile are
+// used. Wildcard names can't be scanned and are skipped.
+func TargetsFromCertDB(dbAccessor certdb.Accessor, label, profile string) ([]Target, error) {
+	recs, err := dbAccessor.GetUnexpiredCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	byHost := make(map[string]*Target)
+	for _, rec := range recs {
+		if rec.Status == "revoked" {
+			continue
+		}
+		if (label != "" && rec.CALabel != label) || (profile != "" && rec.Profile != profile) {
+			continue
+		}
+		cert, err := helpers.ParseCertificatePEM([]byte(rec.PEM))
+		if err != nil {
+			log.Warningf("failed to parse certificate %s: %v", rec.Serial, err)
+			continue
+		}
+
+		for _, name := range cert.DNSNames {
+			if strings.HasPrefix(name, "*.") {
+				continue
+			}
+			name = strings.ToLower(name)
+			target, ok := byHost[name]
+			if !ok {
+				target = &Target{Host: name}
+				byHost[name] = target
+			}
+			target.Issued = append(target.Issued, cert)
+			if target.Newest == nil || newer(cert, target.Newest) {
+				target.Newest = cert
+			}
+		}
+	}
+
+	targets := make([]Target, 0, len(byHost))
+	for _, target := range byHost {
+		targets = append(targets, *target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Host < targets[j].Host })
+	return targets, nil
+}
+
+// newer reports whether a was issued after b.
+func newer(a, b *x509.Certificate) bool {
+	if !a.NotBefore.Equal(b.NotBefore) {
+		return a.NotBefore.After(b.NotBefore)
+	}
+	return a.NotAfter.After(b.NotAfter)
+}
+
+// servedCertificate describes the certificate a target serves.
+type servedCertificate struct {
+	Serial string `json:"serial_number"`
+	Newest string `json:"newest_serial_number"`
+	Issued bool   `json:"issued"`
+}
+
+// Family returns a family checking that the host serves the newest
+// certificate issued for it, to catch missed deployments after a renewal.
+func (target Target) Family() *Family {
+	return &Family{
+		Description: "Scans for the certificates issued for the host",
+		Scanners: map[string]*Scanner{
+			"NewestCertificate": {
+				"Host serves the newest certificate issued for it",
+				target.newestCertificate,
+			},
+		},
+	}
+}
+
+func (target Target) newestCertificate(addr, hostname string) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	served := servedCertificate{
+		Serial: chain[0].SerialNumber.String(),
+		Newest: target.Newest.SerialNumber.String(),
+	}
+	for _, cert := range target.Issued {
+		if bytes.Equal(cert.Raw, chain[0].Raw) {
+			served.Issued = true
+		}
+	}
+	output = served
+
+	switch {
+	case chain[0].Equal(target.Newest):
+		grade = Good
+	case served.Issued:
+		err = errors.New("host serves an older certificate than the newest issued for it")
+	default:
+		err = errors.New("host serves a certificate that wasn't issued for it")
+	}
+	return
+}
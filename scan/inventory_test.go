@@ -0,0 +1,172 @@
+package scan
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/certdb"
+)
+
+// inventoryDB serves certificate records as the certdb's unexpired ones.
+type inventoryDB struct {
+	certdb.Accessor
+	recs []certdb.CertificateRecord
+}
+
+func (db *inventoryDB) GetUnexpiredCertificates() ([]certdb.CertificateRecord, error) {
+	return db.recs, nil
+}
+
+// inventoryCA issues certificates and records them.
+type inventoryCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	db     inventoryDB
+	serial int64
+}
+
+func newInventoryCA(t *testing.T) *inventoryCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Inventory Test CA"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &inventoryCA{cert: cert, key: key, serial: 1}
+}
+
+// issue returns a certificate for names issued age ago, and its key.
+func (ca *inventoryCA) issue(t *testing.T, age time.Duration, profile, status string, names ...string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-age),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.db.recs = append(ca.db.recs, certdb.CertificateRecord{
+		Serial:  cert.SerialNumber.String(),
+		CALabel: "inventory",
+		Status:  status,
+		Expiry:  cert.NotAfter,
+		PEM:     string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Profile: profile,
+	})
+	return cert, key
+}
+
+func targetHosts(targets []Target) (hosts []string) {
+	for _, target := range targets {
+		hosts = append(hosts, target.Host)
+	}
+	return
+}
+
+func TestTargetsFromCertDB(t *testing.T) {
+	ca := newInventoryCA(t)
+	older, _ := ca.issue(t, 2*time.Hour, "www", "good", "a.example.com", "B.example.com")
+	newer, _ := ca.issue(t, time.Hour, "www", "good", "a.example.com")
+	ca.issue(t, time.Hour, "api", "good", "*.wild.example.com", "c.example.com")
+	ca.issue(t, time.Hour, "www", "revoked", "d.example.com")
+
+	targets, err := TargetsFromCertDB(&ca.db, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := targetHosts(targets); !reflect.DeepEqual(hosts, []string{"a.example.com", "b.example.com", "c.example.com"}) {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	if !targets[0].Newest.Equal(newer) || len(targets[0].Issued) != 2 || !targets[1].Newest.Equal(older) {
+		t.Fatalf("unexpected newest certificates %+v", targets)
+	}
+
+	targets, err = TargetsFromCertDB(&ca.db, "inventory", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts := targetHosts(targets); !reflect.DeepEqual(hosts, []string{"c.example.com"}) {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	if targets, err = TargetsFromCertDB(&ca.db, "other", ""); err != nil || len(targets) != 0 {
+		t.Fatalf("expected no targets, have %v %v", targets, err)
+	}
+}
+
+func TestNewestCertificate(t *testing.T) {
+	ca := newInventoryCA(t)
+	older, key := ca.issue(t, 2*time.Hour, "www", "good", "a.example.com", "b.example.com")
+	ca.issue(t, time.Hour, "www", "good", "a.example.com")
+	targets, err := TargetsFromCertDB(&ca.db, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(cert *x509.Certificate, key *ecdsa.PrivateKey) net.Listener {
+		return serveTLS(t, &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: ecdsaSigner{key}}},
+		})
+	}
+	l := serve(older, key)
+	defer l.Close()
+	addr := l.Addr().String()
+
+	// b.example.com's newest certificate is served, a.example.com's isn't.
+	output := expectGrade(t, "b.example.com", targets[1].newestCertificate, addr, Good)
+	if served := output.(servedCertificate); !served.Issued || served.Serial != served.Newest {
+		t.Fatalf("unexpected output %+v", served)
+	}
+	output = expectGrade(t, "a.example.com", targets[0].newestCertificate, addr, Bad)
+	if served := output.(servedCertificate); !served.Issued || served.Serial == served.Newest {
+		t.Fatalf("unexpected output %+v", served)
+	}
+
+	// A certificate from elsewhere.
+	other, key := newInventoryCA(t).issue(t, time.Hour, "", "good", "b.example.com")
+	elsewhere := serve(other, key)
+	defer elsewhere.Close()
+	output = expectGrade(t, "b.example.com", targets[1].newestCertificate, elsewhere.Addr().String(), Bad)
+	if served := output.(servedCertificate); served.Issued {
+		t.Fatalf("unexpected output %+v", served)
+	}
+
+	if _, ok := targets[0].Family().Scanners["NewestCertificate"]; !ok {
+		t.Fatal("missing NewestCertificate scanner")
+	}
+}
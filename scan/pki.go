@@ -15,6 +15,10 @@ import (
 var PKI = &Family{
 	Description: "Scans for the Public Key Infrastructure",
 	Scanners: map[string]*Scanner{
+		"Chain": {
+			"Lists the subjects of the certificates in host's chain",
+			chainSubjects,
+		},
 		"ChainExpiration": {
 			"Host's chain hasn't expired and won't expire in the next 30 days",
 			chainExpiration,
@@ -27,11 +31,28 @@ var PKI = &Family{
 			"Host serves same certificate chain across all IPs",
 			multipleCerts,
 		},
+		"OCSPStapling": {
+			"Host staples an OCSP response for its certificate",
+			ocspStapling,
+		},
+		"OCSPStapleValidity": {
+			"Host's stapled OCSP response is fresh, valid and good for its certificate",
+			ocspStapleValidity,
+		},
+		"Revocation": {
+			"Host's certificate hasn't been revoked",
+			leafRevocation,
+		},
+		"RevocationEndpoints": {
+			"OCSP responders and CRLs of host's chain are reachable",
+			revocationEndpoints,
+		},
 	},
 }
 
-// getChain is a helper function that retreives the host's certificate chain.
-func getChain(addr string, config *tls.Config) (chain []*x509.Certificate, err error) {
+// getConnectionState is a helper function that retreives the state of a
+// connection to the host, which includes at least one certificate.
+func getConnectionState(addr string, config *tls.Config) (state tls.ConnectionState, err error) {
 	var conn *tls.Conn
 	conn, err = tls.DialWithDialer(Dialer, Network, addr, config)
 	if err != nil {
@@ -43,13 +64,38 @@ func getChain(addr string, config *tls.Config) (chain []*x509.Certificate, err e
 		return
 	}
 
-	chain = conn.ConnectionState().PeerCertificates
-	if len(chain) == 0 {
+	state = conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
 		err = fmt.Errorf("%s returned empty certificate chain", addr)
 	}
 	return
 }
 
+// getChain is a helper function that retreives the host's certificate chain.
+func getChain(addr string, config *tls.Config) (chain []*x509.Certificate, err error) {
+	state, err := getConnectionState(addr, config)
+	if err != nil {
+		return
+	}
+	chain = state.PeerCertificates
+	return
+}
+
+// chainSubjects outputs the common names of the certificates in the host's
+// chain, from its certificate up.
+func chainSubjects(addr, hostname string) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	subjects := make([]string, len(chain))
+	for i, cert := range chain {
+		subjects[i] = cert.Subject.CommonName
+	}
+	return Good, subjects, nil
+}
+
 type expiration time.Time
 
 func (e expiration) String() string {
@@ -0,0 +1,148 @@
+package scan
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ProtocolVersions contains scanners testing the SSL/TLS versions accepted
+// by the host and its handling of version negotiation
+var ProtocolVersions = &Family{
+	Description: "Scans for host's accepted SSL/TLS versions and version negotiation",
+	Scanners: map[string]*Scanner{
+		"SSL30": versionScanner(tls.VersionSSL30, Bad, Good),
+		"TLS10": versionScanner(tls.VersionTLS10, Warning, Good),
+		"TLS11": versionScanner(tls.VersionTLS11, Warning, Good),
+		"TLS12": versionScanner(tls.VersionTLS12, Good, Warning),
+		"TLS13": versionScanner(tls.VersionTLS13, Good, Warning),
+		"FallbackSCSV": {
+			"Host refuses version fallback signaled by TLS_FALLBACK_SCSV",
+			fallbackSCSVScan,
+		},
+		"VersionIntolerance": {
+			"Host negotiates down from versions newer than it supports",
+			versionIntoleranceScan,
+		},
+	},
+}
+
+// intoleranceVersions are the Client Hello versions newer than TLS 1.2 that
+// a host must negotiate down from. TLS 1.3 is only offered by its extension,
+// so version intolerance blocks hosts from being offered it.
+var intoleranceVersions = []uint16{tls.VersionTLS13, 0x03FF, 0x0400}
+
+// versionScanner returns a scanner that grades a host by whether it accepts
+// vers.
+func versionScanner(vers uint16, accepted, refused Grade) *Scanner {
+	return &Scanner{
+		fmt.Sprintf("Determines whether host accepts %s", tls.Versions[vers]),
+		func(addr, hostname string) (grade Grade, output Output, err error) {
+			if acceptsVersion(addr, hostname, vers) {
+				return accepted, true, nil
+			}
+			return refused, false, nil
+		},
+	}
+}
+
+func versionName(vers uint16) string {
+	if name, ok := tls.Versions[vers]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", vers)
+}
+
+// sayHelloVersion sends a Client Hello offering vers as the highest version,
+// and returns the version negotiated by the host. If fallback is true, the
+// hello carries TLS_FALLBACK_SCSV. Unlike sayHello, the host's error is
+// returned as is.
+func sayHelloVersion(addr, hostname string, vers uint16, fallback bool) (serverVersion uint16, err error) {
+	if running.cancelled(hostname) {
+		err = errCancelled
+		return
+	}
+	tcpConn, err := net.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	config := defaultTLSConfig(hostname)
+	config.MaxVersion = vers
+	config.CipherSuites = allCiphersIDs()
+	if fallback {
+		config.CipherSuites = append(config.CipherSuites, tls.TLS_FALLBACK_SCSV)
+	}
+
+	conn := tls.Client(tcpConn, config)
+	_, _, _, serverVersion, _, err = conn.SayHello(tls.AllSignatureAndHashAlgorithms)
+	conn.Close()
+	return
+}
+
+// fallbackSCSVScan tests that the host refuses a hello below its highest
+// version that signals a fallback, which protects clients that retry
+// with lower versions from downgrade attacks.
+func fallbackSCSVScan(addr, hostname string) (grade Grade, output Output, err error) {
+	versions := supportedVersions(addr, hostname)
+	if len(versions) < 2 {
+		// There is no version to fall back to.
+		return Skipped, nil, nil
+	}
+
+	fallback := versions[1]
+	output = versionName(fallback)
+	_, e := sayHelloVersion(addr, hostname, fallback, true)
+	switch {
+	case e == errCancelled:
+		err = e
+	case e == nil:
+		grade = Bad
+		err = fmt.Errorf("host accepted fallback to %s", versionName(fallback))
+	case tls.IsInappropriateFallback(e):
+		grade = Good
+	default:
+		grade = Warning
+		err = fmt.Errorf("host refused fallback to %s without an inappropriate_fallback alert: %v", versionName(fallback), e)
+	}
+	return
+}
+
+// versionIntoleranceScan tests that the host negotiates its highest version
+// up to TLS 1.2 when offered newer versions in the Client Hello.
+func versionIntoleranceScan(addr, hostname string) (grade Grade, output Output, err error) {
+	var maxVers uint16
+	for vers := uint16(tls.VersionTLS12); vers >= tls.VersionSSL30; vers-- {
+		if acceptsVersion(addr, hostname, vers) {
+			maxVers = vers
+			break
+		}
+	}
+	if maxVers == 0 {
+		// Hosts that only accept TLS 1.3 negotiate it by extension.
+		return Skipped, nil, nil
+	}
+
+	grade = Good
+	negotiated := make(map[string]string)
+	for _, vers := range intoleranceVersions {
+		serverVersion, e := sayHelloVersion(addr, hostname, vers, false)
+		switch {
+		case e == errCancelled:
+			return Bad, nil, e
+		case e != nil:
+			negotiated[versionName(vers)] = "failed"
+			grade = Bad
+		case serverVersion != maxVers:
+			negotiated[versionName(vers)] = versionName(serverVersion)
+			grade = Bad
+		default:
+			negotiated[versionName(vers)] = versionName(serverVersion)
+		}
+	}
+	if grade == Bad {
+		err = errors.New("host is intolerant of newer protocol versions")
+	}
+	output = negotiated
+	return
+}
@@ -0,0 +1,132 @@
+package scan
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ecdsaSigner adapts an ECDSA key to the crypto.Signer of the TLS stack
+// used by scans, which predates the standard library's.
+type ecdsaSigner struct {
+	*ecdsa.PrivateKey
+}
+
+func (s ecdsaSigner) Public() crypto.PublicKey {
+	return &s.PublicKey
+}
+
+func (s ecdsaSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.PrivateKey.Sign(rand, digest, nil)
+}
+
+// newTLSServer starts a server that completes handshakes for versions
+// between minVersion and maxVersion.
+func newTLSServer(t *testing.T, minVersion, maxVersion uint16) net.Listener {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return serveTLS(t, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: ecdsaSigner{key}}},
+		MinVersion:   minVersion,
+		MaxVersion:   maxVersion,
+	})
+}
+
+// serveTLS starts a server that completes handshakes with config.
+func serveTLS(t *testing.T, config *tls.Config) net.Listener {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return l
+}
+
+func TestProtocolVersions(t *testing.T) {
+	l := newTLSServer(t, tls.VersionTLS11, tls.VersionTLS12)
+	defer l.Close()
+	addr := l.Addr().String()
+
+	expected := map[string]Grade{
+		"SSL30":              Good,
+		"TLS10":              Good,
+		"TLS11":              Warning,
+		"TLS12":              Good,
+		"TLS13":              Warning,
+		"FallbackSCSV":       Good,
+		"VersionIntolerance": Good,
+	}
+	for name, scanner := range ProtocolVersions.Scanners {
+		grade, _, err := scanner.Scan(addr, "localhost")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if grade != expected[name] {
+			t.Fatalf("%s: expected %s, have %s", name, expected[name], grade)
+		}
+	}
+
+	_, output, _ := fallbackSCSVScan(addr, "localhost")
+	if output != "TLS 1.1" {
+		t.Fatalf("expected a fallback to TLS 1.1, have %v", output)
+	}
+
+	_, output, _ = versionIntoleranceScan(addr, "localhost")
+	negotiated := map[string]string{"TLS 1.3": "TLS 1.2", "0x03ff": "TLS 1.2", "0x0400": "TLS 1.2"}
+	if !reflect.DeepEqual(output, negotiated) {
+		t.Fatalf("unexpected negotiated versions %v", output)
+	}
+}
+
+func TestProtocolVersionsSingleVersion(t *testing.T) {
+	l := newTLSServer(t, tls.VersionTLS12, tls.VersionTLS12)
+	defer l.Close()
+
+	grade, _, err := fallbackSCSVScan(l.Addr().String(), "localhost")
+	if err != nil || grade != Skipped {
+		t.Fatalf("FallbackSCSV: %v %v", grade, err)
+	}
+
+	s := newTLS13Server(t, []uint16{0x1301}, []uint16{29}, []uint16{0x0403})
+	defer s.Close()
+
+	grade, _, err = versionIntoleranceScan(s.Addr().String(), "localhost")
+	if err != nil || grade != Skipped {
+		t.Fatalf("VersionIntolerance: %v %v", grade, err)
+	}
+}
@@ -0,0 +1,220 @@
+package scan
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"time"
+
+	"github.com/cloudflare/cfssl/revoke"
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxRevocationResponse bounds the size of a CRL or OCSP response read
+// while checking revocation endpoints.
+const maxRevocationResponse = 10 << 20
+
+// ocspStatus is the status of an OCSP response.
+type ocspStatus int
+
+func (s ocspStatus) String() string {
+	switch s {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+func (s ocspStatus) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%s"`, s)), nil
+}
+
+// ocspStaple describes a stapled OCSP response.
+type ocspStaple struct {
+	Status     ocspStatus `json:"status"`
+	ThisUpdate time.Time  `json:"this_update"`
+	NextUpdate time.Time  `json:"next_update"`
+}
+
+// ocspStapling tests that the host staples an OCSP response for its
+// certificate, if the certificate names an OCSP responder.
+func ocspStapling(addr, hostname string) (grade Grade, output Output, err error) {
+	state, err := getConnectionState(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	output = len(state.OCSPResponse) > 0
+	switch {
+	case len(state.OCSPResponse) > 0:
+		grade = Good
+	case len(state.PeerCertificates[0].OCSPServer) == 0:
+		// There is no responder to staple a response from.
+		grade = Skipped
+	default:
+		grade = Warning
+	}
+	return
+}
+
+// ocspStapleValidity tests that the host's stapled OCSP response is signed
+// by the certificate's issuer, is current and reports the certificate as
+// good.
+func ocspStapleValidity(addr, hostname string) (grade Grade, output Output, err error) {
+	state, err := getConnectionState(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+	if len(state.OCSPResponse) == 0 {
+		return Skipped, nil, nil
+	}
+
+	chain := state.PeerCertificates
+	if len(chain) < 2 {
+		err = errors.New("host's chain doesn't include the issuer of its certificate")
+		return
+	}
+	resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, chain[0], chain[1])
+	if err != nil {
+		return
+	}
+	output = ocspStaple{ocspStatus(resp.Status), resp.ThisUpdate, resp.NextUpdate}
+
+	now := time.Now()
+	switch {
+	case resp.Status == ocsp.Revoked:
+		err = fmt.Errorf("%s is revoked", chain[0].Subject.CommonName)
+	case resp.Status != ocsp.Good:
+		err = fmt.Errorf("stapled OCSP response doesn't know %s", chain[0].Subject.CommonName)
+	case now.Before(resp.ThisUpdate):
+		err = errors.New("stapled OCSP response isn't valid yet")
+	case !resp.NextUpdate.IsZero() && now.After(resp.NextUpdate):
+		err = errors.New("stapled OCSP response has expired")
+	case resp.NextUpdate.IsZero():
+		// Without a next update, clients can't tell that the
+		// response is stale.
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
+
+// leafRevocation checks the revocation status of the host's certificate
+// with its CRLs and OCSP responders.
+func leafRevocation(addr, hostname string) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	revoked, ok := revoke.VerifyCertificate(chain[0])
+	switch {
+	case revoked:
+		err = fmt.Errorf("%s is revoked", chain[0].Subject.CommonName)
+	case !ok:
+		grade = Warning
+		output = fmt.Sprintf("couldn't check if %s is revoked", chain[0].Subject.CommonName)
+	default:
+		grade = Good
+	}
+	return
+}
+
+// checkRevocationEndpoint fetches a CRL, or posts an OCSP request if req
+// isn't nil, and checks that a response is returned.
+func checkRevocationEndpoint(url string, req []byte) error {
+	var resp *http.Response
+	var err error
+	if req == nil {
+		resp, err = Client.Get(url)
+	} else {
+		resp, err = Client.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRevocationResponse))
+	if err != nil {
+		return err
+	}
+
+	if req == nil {
+		_, err = x509.ParseCRL(body)
+	} else {
+		_, err = ocsp.ParseResponse(body, nil)
+	}
+	return err
+}
+
+// revocationEndpoints tests that the CRLs and OCSP responders named by each
+// certificate in the host's chain respond.
+func revocationEndpoints(addr, hostname string) (grade Grade, output Output, err error) {
+	chain, err := getChain(addr, defaultTLSConfig(hostname))
+	if err != nil {
+		return
+	}
+
+	endpoints := make(map[string]string)
+	var failed int
+	check := func(url string, req []byte) {
+		if _, ok := endpoints[url]; ok {
+			return
+		}
+		if e := checkRevocationEndpoint(url, req); e != nil {
+			endpoints[url] = e.Error()
+			failed++
+		} else {
+			endpoints[url] = "ok"
+		}
+	}
+
+	for i, cert := range chain {
+		for _, url := range cert.CRLDistributionPoints {
+			// LDAP CRLs can't be fetched.
+			if u, e := neturl.Parse(url); e == nil && u.Scheme == "ldap" {
+				continue
+			}
+			check(url, nil)
+		}
+
+		if i+1 == len(chain) || len(cert.OCSPServer) == 0 {
+			continue
+		}
+		req, e := ocsp.CreateRequest(cert, chain[i+1], nil)
+		if e != nil {
+			err = e
+			return
+		}
+		for _, url := range cert.OCSPServer {
+			check(url, req)
+		}
+	}
+
+	output = endpoints
+	switch {
+	case len(endpoints) == 0:
+		grade = Skipped
+	case failed == len(endpoints):
+		grade = Bad
+		err = errors.New("none of the chain's revocation endpoints are reachable")
+	case failed > 0:
+		grade = Warning
+	default:
+		grade = Good
+	}
+	return
+}
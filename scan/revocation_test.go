@@ -0,0 +1,208 @@
+package scan
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationTest is a CA with local OCSP and CRL responders, and a TLS
+// server for a certificate it issued.
+type revocationTest struct {
+	ca, leaf       *x509.Certificate
+	caKey, leafKey *ecdsa.PrivateKey
+	responders     *httptest.Server
+	revoked        bool
+	crlStatus      int
+}
+
+func newRevocationTest(t *testing.T) *revocationTest {
+	rt := &revocationTest{crlStatus: http.StatusOK}
+	rt.responders = httptest.NewServer(http.HandlerFunc(rt.serveHTTP))
+
+	var err error
+	if rt.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if rt.leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Revocation Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &rt.caKey.PublicKey, rt.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		OCSPServer:            []string{rt.responders.URL + "/ocsp"},
+		CRLDistributionPoints: []string{rt.responders.URL + "/ca.crl"},
+		IssuingCertificateURL: []string{rt.responders.URL + "/ca.crt"},
+	}, rt.ca, &rt.leafKey.PublicKey, rt.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+// ocspResponse returns a response for the leaf that is current at now.
+func (rt *revocationTest) ocspResponse(now time.Time) ([]byte, error) {
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: rt.leaf.SerialNumber,
+		ThisUpdate:   now.Add(-time.Hour),
+		NextUpdate:   now.Add(time.Hour),
+	}
+	if rt.revoked {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = now.Add(-time.Hour)
+	}
+	return ocsp.CreateResponse(rt.ca, rt.ca, template, rt.caKey)
+}
+
+func (rt *revocationTest) staple(t *testing.T, now time.Time) []byte {
+	resp, err := rt.ocspResponse(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func (rt *revocationTest) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/ca.crt":
+		w.Write(rt.ca.Raw)
+	case r.URL.Path == "/ca.crl":
+		var revoked []pkix.RevokedCertificate
+		if rt.revoked {
+			revoked = append(revoked, pkix.RevokedCertificate{
+				SerialNumber:   rt.leaf.SerialNumber,
+				RevocationTime: time.Now().Add(-time.Hour),
+			})
+		}
+		crl, err := rt.ca.CreateCRL(rand.Reader, rt.caKey, revoked, time.Now(), time.Now().Add(time.Hour))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(rt.crlStatus)
+		w.Write(crl)
+	case strings.HasPrefix(r.URL.Path, "/ocsp"):
+		resp, err := rt.ocspResponse(time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serve starts a TLS server for the leaf, stapling staple.
+func (rt *revocationTest) serve(t *testing.T, staple []byte) net.Listener {
+	l := serveTLS(t, &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{rt.leaf.Raw, rt.ca.Raw},
+			PrivateKey:  ecdsaSigner{rt.leafKey},
+			OCSPStaple:  staple,
+		}},
+	})
+	return l
+}
+
+func expectGrade(t *testing.T, name string, scan func(string, string) (Grade, Output, error), addr string, expected Grade) Output {
+	grade, output, err := scan(addr, "localhost")
+	if grade != expected {
+		t.Fatalf("%s: expected %s, have %s (%v)", name, expected, grade, err)
+	}
+	if (grade == Bad) != (err != nil) {
+		t.Fatalf("%s: unexpected error %v", name, err)
+	}
+	return output
+}
+
+func TestRevocationScans(t *testing.T) {
+	rt := newRevocationTest(t)
+	defer rt.responders.Close()
+	l := rt.serve(t, rt.staple(t, time.Now()))
+	defer l.Close()
+	addr := l.Addr().String()
+
+	expectGrade(t, "OCSPStapling", ocspStapling, addr, Good)
+	output := expectGrade(t, "OCSPStapleValidity", ocspStapleValidity, addr, Good)
+	if staple := output.(ocspStaple); staple.Status != ocsp.Good || staple.Status.String() != "good" {
+		t.Fatalf("unexpected staple %+v", staple)
+	}
+	expectGrade(t, "Revocation", leafRevocation, addr, Good)
+	output = expectGrade(t, "RevocationEndpoints", revocationEndpoints, addr, Good)
+	if endpoints := output.(map[string]string); len(endpoints) != 2 {
+		t.Fatalf("expected the CRL and OCSP responder, have %v", endpoints)
+	}
+
+	// An expired staple.
+	expired := rt.serve(t, rt.staple(t, time.Now().Add(-3*time.Hour)))
+	defer expired.Close()
+	addr = expired.Addr().String()
+	expectGrade(t, "OCSPStapling", ocspStapling, addr, Good)
+	expectGrade(t, "OCSPStapleValidity", ocspStapleValidity, addr, Bad)
+
+	// No staple.
+	unstapled := rt.serve(t, nil)
+	defer unstapled.Close()
+	addr = unstapled.Addr().String()
+	expectGrade(t, "OCSPStapling", ocspStapling, addr, Warning)
+	expectGrade(t, "OCSPStapleValidity", ocspStapleValidity, addr, Skipped)
+
+	// An unreachable CRL.
+	rt.crlStatus = http.StatusNotFound
+	expectGrade(t, "RevocationEndpoints", revocationEndpoints, addr, Warning)
+}
+
+func TestRevocationScansRevoked(t *testing.T) {
+	rt := newRevocationTest(t)
+	defer rt.responders.Close()
+	rt.revoked = true
+	l := rt.serve(t, rt.staple(t, time.Now()))
+	defer l.Close()
+	addr := l.Addr().String()
+
+	output := expectGrade(t, "OCSPStapleValidity", ocspStapleValidity, addr, Bad)
+	if staple := output.(ocspStaple); staple.Status != ocsp.Revoked {
+		t.Fatalf("unexpected staple %+v", staple)
+	}
+	expectGrade(t, "Revocation", leafRevocation, addr, Bad)
+}
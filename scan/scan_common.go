@@ -3,6 +3,7 @@ package scan
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"net"
 	"net/http"
 	"regexp"
@@ -22,6 +23,9 @@ var (
 	Client = &http.Client{Transport: &http.Transport{Dial: Dialer.Dial}}
 	// RootCAs defines the default root certificate authorities to be used for scan.
 	RootCAs *x509.CertPool
+	// rootCAsLock guards RootCAs, which LoadRootCAs replaces while scans
+	// may be running.
+	rootCAsLock sync.RWMutex
 )
 
 // Grade gives a subjective rating of the host's success in a scan.
@@ -57,6 +61,65 @@ func (g Grade) String() string {
 // Output is the result of a scan, to be stored for potential use by later Scanners.
 type Output interface{}
 
+// errCancelled is returned by handshakes with a host whose scans have all
+// been cancelled.
+var errCancelled = errors.New("scan cancelled")
+
+// runningScans holds the done channels of the scans running for each
+// hostname, so that scanners which make many connections can stop once
+// nobody wants their results.
+type runningScans struct {
+	sync.Mutex
+	dones map[string][]<-chan struct{}
+}
+
+var running = &runningScans{dones: make(map[string][]<-chan struct{})}
+
+// hold adds a scan of hostname, cancelled by closing done, until release is
+// called.
+func (rs *runningScans) hold(hostname string, done <-chan struct{}) (release func()) {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.dones[hostname] = append(rs.dones[hostname], done)
+
+	return func() {
+		rs.Lock()
+		defer rs.Unlock()
+		dones := rs.dones[hostname]
+		for i, d := range dones {
+			if d == done {
+				dones = append(dones[:i], dones[i+1:]...)
+				break
+			}
+		}
+		if len(dones) == 0 {
+			delete(rs.dones, hostname)
+		} else {
+			rs.dones[hostname] = dones
+		}
+	}
+}
+
+// cancelled reports whether every scan of hostname has been cancelled. It
+// is false for hosts that aren't being scanned by StreamScans, such as in
+// direct calls to a Scanner.
+func (rs *runningScans) cancelled(hostname string) bool {
+	rs.Lock()
+	defer rs.Unlock()
+	dones := rs.dones[hostname]
+	if len(dones) == 0 {
+		return false
+	}
+	for _, done := range dones {
+		select {
+		case <-done:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // multiscan scans all DNS addresses returned for the host, returning the lowest grade
 // and the concatenation of all the output.
 func multiscan(host string, scan func(string) (Grade, Output, error)) (grade Grade, output Output, err error) {
@@ -121,11 +184,14 @@ type FamilySet map[string]*Family
 
 // Default contains each scan Family that is defined
 var Default = FamilySet{
-	"Connectivity": Connectivity,
-	"TLSHandshake": TLSHandshake,
-	"TLSSession":   TLSSession,
-	"PKI":          PKI,
-	"Broad":        Broad,
+	"Connectivity":     Connectivity,
+	"TLSHandshake":     TLSHandshake,
+	"ProtocolVersions": ProtocolVersions,
+	"TLSSession":       TLSSession,
+	"PKI":              PKI,
+	"CT":               CT,
+	"HTTP":             HTTP,
+	"Broad":            Broad,
 }
 
 // ScannerResult contains the result for a single scan.
@@ -140,7 +206,8 @@ type FamilyResult map[string]ScannerResult
 
 // A Result contains a ScannerResult along with it's scanner and family names.
 type Result struct {
-	Family, Scanner string
+	Family  string `json:"family"`
+	Scanner string `json:"scanner"`
 	ScannerResult
 }
 
@@ -149,20 +216,29 @@ type context struct {
 	addr, hostname              string
 	familyRegexp, scannerRegexp *regexp.Regexp
 	resultChan                  chan *Result
+	// done is closed when the results are no longer wanted, so that
+	// scanners that haven't started yet are skipped and running ones stop
+	// connecting to the host.
+	done <-chan struct{}
 }
 
-func newContext(addr, hostname string, familyRegexp, scannerRegexp *regexp.Regexp, numFamilies int) *context {
+func newContext(addr, hostname string, familyRegexp, scannerRegexp *regexp.Regexp, numFamilies int, done <-chan struct{}) *context {
 	ctx := &context{
 		addr:          addr,
 		hostname:      hostname,
 		familyRegexp:  familyRegexp,
 		scannerRegexp: scannerRegexp,
 		resultChan:    make(chan *Result),
+		done:          done,
 	}
 	ctx.Add(numFamilies)
 
+	releaseProbes := tls13Probes.hold(hostname)
+	releaseScan := running.hold(hostname, done)
 	go func() {
 		ctx.Wait()
+		releaseScan()
+		releaseProbes()
 		close(ctx.resultChan)
 	}()
 
@@ -186,15 +262,16 @@ func (ctx *context) newfamilyContext(numScanners int) *familyContext {
 	return familyCtx
 }
 
-func (ctx *context) copyResults(timeout time.Duration) map[string]FamilyResult {
+func copyResults(resultChan <-chan *Result, timeout time.Duration) map[string]FamilyResult {
 	results := make(map[string]FamilyResult)
+	deadline := time.After(timeout)
 	for {
 		var result *Result
 		select {
-		case <-time.After(timeout):
+		case <-deadline:
 			log.Warningf("Scan timed out after %v", timeout)
 			return results
-		case result = <-ctx.resultChan:
+		case result = <-resultChan:
 			if result == nil {
 				return results
 			}
@@ -208,6 +285,14 @@ func (ctx *context) copyResults(timeout time.Duration) map[string]FamilyResult {
 }
 
 func (familyCtx *familyContext) runScanner(familyName, scannerName string, scanner *Scanner) {
+	defer familyCtx.Done()
+
+	select {
+	case <-familyCtx.ctx.done:
+		return
+	default:
+	}
+
 	if familyCtx.ctx.familyRegexp.MatchString(familyName) && familyCtx.ctx.scannerRegexp.MatchString(scannerName) {
 		grade, output, err := scanner.Scan(familyCtx.ctx.addr, familyCtx.ctx.hostname)
 		result := &Result{
@@ -221,14 +306,37 @@ func (familyCtx *familyContext) runScanner(familyName, scannerName string, scann
 		if err != nil {
 			result.Error = err.Error()
 		}
-		familyCtx.ctx.resultChan <- result
+		select {
+		case <-familyCtx.ctx.done:
+			return
+		default:
+		}
+		select {
+		case familyCtx.ctx.resultChan <- result:
+		case <-familyCtx.ctx.done:
+		}
 	}
-	familyCtx.Done()
 }
 
 // RunScans iterates over AllScans, running each scan that matches the family
 // and scanner regular expressions concurrently.
 func (fs FamilySet) RunScans(host, ip, family, scanner string, timeout time.Duration) (map[string]FamilyResult, error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	resultChan, err := fs.StreamScans(done, host, ip, family, scanner)
+	if err != nil {
+		return nil, err
+	}
+	return copyResults(resultChan, timeout), nil
+}
+
+// StreamScans runs the scans RunScans does, sending each result as its
+// scanner completes. The channel is closed once all scanners have run.
+// Closing done cancels the scans: scanners that haven't started are
+// skipped, the results of running ones are dropped, and running scanners
+// stop making new handshakes and sweeping IP ranges.
+func (fs FamilySet) StreamScans(done <-chan struct{}, host, ip, family, scanner string) (<-chan *Result, error) {
 	hostname, port, err := net.SplitHostPort(host)
 	if err != nil {
 		hostname = host
@@ -252,7 +360,7 @@ func (fs FamilySet) RunScans(host, ip, family, scanner string, timeout time.Dura
 		return nil, err
 	}
 
-	ctx := newContext(addr, hostname, familyRegexp, scannerRegexp, len(fs))
+	ctx := newContext(addr, hostname, familyRegexp, scannerRegexp, len(fs), done)
 	for familyName, family := range fs {
 		familyCtx := ctx.newfamilyContext(len(family.Scanners))
 		for scannerName, scanner := range family.Scanners {
@@ -260,19 +368,27 @@ func (fs FamilySet) RunScans(host, ip, family, scanner string, timeout time.Dura
 		}
 	}
 
-	return ctx.copyResults(timeout), nil
+	return ctx.resultChan, nil
 }
 
 // LoadRootCAs loads the default root certificate authorities from file.
 func LoadRootCAs(caBundleFile string) (err error) {
 	if caBundleFile != "" {
 		log.Debugf("Loading scan RootCAs: %s", caBundleFile)
-		RootCAs, err = helpers.LoadPEMCertPool(caBundleFile)
+		var pool *x509.CertPool
+		if pool, err = helpers.LoadPEMCertPool(caBundleFile); err != nil {
+			return
+		}
+		rootCAsLock.Lock()
+		RootCAs = pool
+		rootCAsLock.Unlock()
 	}
 	return
 }
 
 func defaultTLSConfig(hostname string) *tls.Config {
+	rootCAsLock.RLock()
+	defer rootCAsLock.RUnlock()
 	return &tls.Config{
 		ServerName:         hostname,
 		RootCAs:            RootCAs,
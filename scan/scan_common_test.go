@@ -1,8 +1,11 @@
 package scan
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"testing"
+	"time"
 )
 
 var TestingScanner = &Scanner{
@@ -64,3 +67,94 @@ func TestCommon(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestStreamScans(t *testing.T) {
+	block := make(chan struct{})
+	fs := FamilySet{
+		"Testing": TestingFamily,
+		"Blocking": {
+			Description: "Blocks until released",
+			Scanners: map[string]*Scanner{
+				"BlockingScanner": {"Blocks until released", func(addr, hostname string) (Grade, Output, error) {
+					<-block
+					return Good, nil, nil
+				}},
+			},
+		},
+	}
+
+	done := make(chan struct{})
+	results, err := fs.StreamScans(done, "good.example.com", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := <-results
+	if result.Family != "Testing" || result.Scanner != "TestingScanner" || result.Grade != Good.String() {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	// Once cancelled, the blocked scanner's result is dropped and the
+	// stream ends.
+	close(done)
+	close(block)
+	select {
+	case result, ok := <-results:
+		if ok {
+			t.Fatalf("unexpected result after cancelling %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream didn't end after cancelling")
+	}
+
+	if _, err = fs.StreamScans(nil, "good.example.com", "", "(", ""); err == nil {
+		t.Fatal("expected an invalid family regexp to fail")
+	}
+}
+
+func TestStreamScansCancelsHandshakes(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	started, block := make(chan struct{}), make(chan struct{})
+	errs := make(chan error, 2)
+	fs := FamilySet{
+		"Blocking": {
+			Description: "Says hello once released",
+			Scanners: map[string]*Scanner{
+				"BlockingScanner": {"Says hello once released", func(addr, hostname string) (Grade, Output, error) {
+					close(started)
+					<-block
+					_, _, _, err := sayHello(l.Addr().String(), hostname, nil, nil, tls.VersionTLS12, nil)
+					errs <- err
+					_, err = sayHelloVersion(l.Addr().String(), hostname, tls.VersionTLS12, true)
+					errs <- err
+					return Good, nil, nil
+				}},
+			},
+		},
+	}
+
+	done := make(chan struct{})
+	results, err := fs.StreamScans(done, "cancelled.example.com", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once cancelled, running scanners stop connecting to the host.
+	<-started
+	close(done)
+	close(block)
+	for i := 0; i < 2; i++ {
+		if err = <-errs; err != errCancelled {
+			t.Fatalf("expected the handshake to be cancelled, have %v", err)
+		}
+	}
+	for range results {
+	}
+	if _, ok := running.dones["cancelled.example.com"]; ok {
+		t.Fatal("expected the scan to be released")
+	}
+}
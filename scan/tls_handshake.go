@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/cloudflare/cfssl/helpers"
 )
@@ -23,9 +25,13 @@ var TLSHandshake = &Family{
 			cipherSuiteScan,
 		},
 		"SigAlgs": {
-			"Determines host's accepted signature and hash algorithms",
+			"Determines host's accepted signature and hash algorithms for TLS 1.2",
 			sigAlgsScan,
 		},
+		"SigSchemes": {
+			"Determines host's accepted signature schemes for TLS 1.3",
+			sigSchemesScan,
+		},
 		"CertsBySigAlgs": {
 			"Determines host's certificate signature algorithm matching client's accepted signature and hash algorithms",
 			certSigAlgsScan,
@@ -38,6 +44,14 @@ var TLSHandshake = &Family{
 			"Determines the host's ec curve support for TLS 1.2",
 			ecCurveScan,
 		},
+		"KeyShareGroups": {
+			"Determines the host's supported groups and preferred order for TLS 1.3 key exchange",
+			keyShareGroupsScan,
+		},
+		"Versions": {
+			"Determines the SSL/TLS versions negotiated by each of the host's addresses",
+			versionsScan,
+		},
 	},
 }
 
@@ -66,6 +80,10 @@ func getCurveIndex(curves []tls.CurveID, serverCurve tls.CurveID) (curveIndex in
 }
 
 func sayHello(addr, hostname string, ciphers []uint16, curves []tls.CurveID, vers uint16, sigAlgs []tls.SignatureAndHash) (cipherIndex, curveIndex int, certs [][]byte, err error) {
+	if running.cancelled(hostname) {
+		err = errCancelled
+		return
+	}
 	tcpConn, err := net.Dial(Network, addr)
 	if err != nil {
 		return
@@ -117,11 +135,62 @@ func sayHello(addr, hostname string, ciphers []uint16, curves []tls.CurveID, ver
 	return
 }
 
+// sayHello13 is sayHello for TLS 1.3. Offering no key shares makes the
+// server name its preferred group in a HelloRetryRequest, which is
+// reported by retry. Signature schemes are only checked by the server
+// when it doesn't ask for a retry.
+func sayHello13(addr, hostname string, ciphers []uint16, groups, keyShares []tls.CurveID, sigSchemes []tls.SignatureScheme) (cipherIndex, groupIndex int, retry bool, err error) {
+	if running.cancelled(hostname) {
+		err = errCancelled
+		return
+	}
+	tcpConn, err := net.Dial(Network, addr)
+	if err != nil {
+		return
+	}
+	config := defaultTLSConfig(hostname)
+	if ciphers == nil {
+		ciphers = tls.TLS13CipherSuites
+	}
+	if groups == nil {
+		groups = allCurvesIDs()
+	}
+	if sigSchemes == nil {
+		sigSchemes = tls.AllSignatureSchemes
+	}
+
+	conn := tls.Client(tcpConn, config)
+	serverCipher, serverGroup, serverVersion, retry, err := conn.SayHello13(ciphers, groups, keyShares, sigSchemes)
+	conn.Close()
+	if err != nil || serverVersion != tls.VersionTLS13 {
+		err = errHelloFailed
+		return
+	}
+
+	cipherIndex, err = getCipherIndex(ciphers, serverCipher)
+	if err != nil {
+		return
+	}
+	groupIndex, err = getCurveIndex(groups, serverGroup)
+	return
+}
+
 func allCiphersIDs() []uint16 {
+	tls13 := make(map[uint16]bool)
+	for _, cipherID := range tls.TLS13CipherSuites {
+		tls13[cipherID] = true
+	}
+
 	ciphers := make([]uint16, 0, len(tls.CipherSuites))
 	for cipherID := range tls.CipherSuites {
-		ciphers = append(ciphers, cipherID)
+		// TLS 1.3 cipher suites are scanned by sayHello13.
+		if !tls13[cipherID] {
+			ciphers = append(ciphers, cipherID)
+		}
 	}
+	// Offer them in a stable order, so that hosts following the client's
+	// preference give the same results on every scan.
+	sort.Slice(ciphers, func(i, j int) bool { return ciphers[i] < ciphers[j] })
 	return ciphers
 }
 
@@ -189,6 +258,7 @@ func allCurvesIDs() []tls.CurveID {
 			curves = append(curves, curveID)
 		}
 	}
+	sort.Slice(curves, func(i, j int) bool { return curves[i] < curves[j] })
 	return curves
 }
 
@@ -266,10 +336,75 @@ func doCurveScan(addr, hostname string, vers, cipherID uint16, ciphers []uint16)
 	return
 }
 
+// doGroupScan13 returns the groups supported by the host for TLS 1.3 key
+// exchange, in the host's order of preference.
+func doGroupScan13(addr, hostname string, cipherID uint16) (supportedGroups []tls.CurveID, err error) {
+	groups := allCurvesIDs()
+	for len(groups) > 0 {
+		var groupIndex int
+		_, groupIndex, _, err = sayHello13(addr, hostname, []uint16{cipherID}, groups, nil, nil)
+		if err != nil {
+			// This case is expected, because eventually we ask only for groups the server doesn't support
+			if err == errHelloFailed {
+				err = nil
+				break
+			}
+			return
+		}
+		supportedGroups = append(supportedGroups, groups[groupIndex])
+		groups = append(groups[:groupIndex], groups[groupIndex+1:]...)
+	}
+	return
+}
+
+// keyShareGroup returns the host's preferred TLS 1.3 group among those
+// we can send key shares for.
+func keyShareGroup(addr, hostname string) (group tls.CurveID, err error) {
+	var groups []tls.CurveID
+	for _, curveID := range allCurvesIDs() {
+		if tls.CanKeyShare(curveID) {
+			groups = append(groups, curveID)
+		}
+	}
+
+	_, groupIndex, _, err := sayHello13(addr, hostname, nil, groups, nil, nil)
+	if err != nil {
+		return
+	}
+	group = groups[groupIndex]
+	return
+}
+
 // cipherSuiteScan returns, by TLS Version, the sort list of cipher suites
 // supported by the host
 func cipherSuiteScan(addr, hostname string) (grade Grade, output Output, err error) {
 	var cvList cipherVersionList
+
+	// TLS 1.3 cipher suites don't depend on the key exchange, so the
+	// supported groups are the same for each of them.
+	var groups []tls.CurveID
+	tls13Ciphers := make([]uint16, len(tls.TLS13CipherSuites))
+	copy(tls13Ciphers, tls.TLS13CipherSuites)
+	for len(tls13Ciphers) > 0 {
+		var cipherIndex int
+		cipherIndex, _, _, err = sayHello13(addr, hostname, tls13Ciphers, nil, nil, nil)
+		if err != nil {
+			if err == errHelloFailed {
+				err = nil
+				break
+			}
+			return
+		}
+		cipherID := tls13Ciphers[cipherIndex]
+		if groups == nil {
+			if groups, err = doGroupScan13(addr, hostname, cipherID); err != nil {
+				return
+			}
+		}
+		cvList = append(cvList, cipherVersions{cipherID, []cipherDatum{{tls.VersionTLS13, groups}}})
+		tls13Ciphers = append(tls13Ciphers[:cipherIndex], tls13Ciphers[cipherIndex+1:]...)
+	}
+
 	allCiphers := allCiphersIDs()
 
 	var vers uint16
@@ -337,12 +472,44 @@ func sigAlgsScan(addr, hostname string) (grade Grade, output Output, err error)
 	if len(supportedSigAlgs) > 0 {
 		grade = Good
 		output = supportedSigAlgs
+	} else if supportsTLS13(addr, hostname) {
+		// TLS 1.3-only hosts are covered by SigSchemes.
+		grade = Skipped
 	} else {
 		err = errors.New("no SigAlgs supported")
 	}
 	return
 }
 
+// sigSchemesScan returns the TLS 1.3 signature schemes accepted by the host
+func sigSchemesScan(addr, hostname string) (grade Grade, output Output, err error) {
+	group, err := keyShareGroup(addr, hostname)
+	if err != nil {
+		if err == errHelloFailed {
+			// The host doesn't support TLS 1.3.
+			return Skipped, nil, nil
+		}
+		return
+	}
+
+	var supportedSigSchemes []tls.SignatureScheme
+	for _, sigScheme := range tls.AllSignatureSchemes {
+		groups := []tls.CurveID{group}
+		_, _, retry, e := sayHello13(addr, hostname, nil, groups, groups, []tls.SignatureScheme{sigScheme})
+		if e == nil && !retry {
+			supportedSigSchemes = append(supportedSigSchemes, sigScheme)
+		}
+	}
+
+	if len(supportedSigSchemes) > 0 {
+		grade = Good
+		output = supportedSigSchemes
+	} else {
+		err = errors.New("no TLS 1.3 signature schemes supported")
+	}
+	return
+}
+
 // certSigAlgScan returns the server certificate with various sigature and hash algorithms in the ClientHello
 func certSigAlgsScan(addr, hostname string) (grade Grade, output Output, err error) {
 	var certSigAlgs = make(map[string]string)
@@ -365,6 +532,8 @@ func certSigAlgsScan(addr, hostname string) (grade Grade, output Output, err err
 	if len(certSigAlgs) > 0 {
 		grade = Good
 		output = certSigAlgs
+	} else if supportsTLS13(addr, hostname) {
+		grade = Skipped
 	} else {
 		err = errors.New("no SigAlgs supported")
 	}
@@ -394,6 +563,8 @@ func certSigAlgsScanByCipher(addr, hostname string) (grade Grade, output Output,
 	if len(certSigAlgs) > 0 {
 		grade = Good
 		output = certSigAlgs
+	} else if supportsTLS13(addr, hostname) {
+		grade = Skipped
 	} else {
 		err = errors.New("no cipher supported")
 	}
@@ -425,3 +596,144 @@ func ecCurveScan(addr, hostname string) (grade Grade, output Output, err error)
 	grade = Good
 	return
 }
+
+// keyShareGroupsScan returns the groups supported by the host for TLS 1.3
+// key exchange, in the host's order of preference.
+func keyShareGroupsScan(addr, hostname string) (grade Grade, output Output, err error) {
+	cipherIndex, _, _, err := sayHello13(addr, hostname, nil, nil, nil, nil)
+	if err != nil {
+		if err == errHelloFailed {
+			// The host doesn't support TLS 1.3.
+			return Skipped, nil, nil
+		}
+		return
+	}
+
+	groups, err := doGroupScan13(addr, hostname, tls.TLS13CipherSuites[cipherIndex])
+	if err != nil {
+		return
+	}
+	supportedGroups := make([]string, len(groups))
+	for i, group := range groups {
+		supportedGroups[i] = tls.Curves[group]
+	}
+	output = supportedGroups
+	grade = Good
+	return
+}
+
+// tls13Probe is the result of probing an address for TLS 1.3.
+type tls13Probe struct {
+	once sync.Once
+	ok   bool
+}
+
+// tls13ProbeCache shares the TLS 1.3 probes of each address between the
+// scanners of the scans holding its hostname.
+type tls13ProbeCache struct {
+	sync.Mutex
+	refs   map[string]int
+	probes map[string]map[string]*tls13Probe
+}
+
+var tls13Probes = &tls13ProbeCache{
+	refs:   make(map[string]int),
+	probes: make(map[string]map[string]*tls13Probe),
+}
+
+// hold caches the probes of hostname's addresses until release is called.
+func (c *tls13ProbeCache) hold(hostname string) (release func()) {
+	c.Lock()
+	defer c.Unlock()
+	if c.refs[hostname] == 0 {
+		c.probes[hostname] = make(map[string]*tls13Probe)
+	}
+	c.refs[hostname]++
+
+	return func() {
+		c.Lock()
+		defer c.Unlock()
+		c.refs[hostname]--
+		if c.refs[hostname] == 0 {
+			delete(c.refs, hostname)
+			delete(c.probes, hostname)
+		}
+	}
+}
+
+// probe returns the cached probe of addr, or nil if hostname isn't held.
+func (c *tls13ProbeCache) probe(addr, hostname string) *tls13Probe {
+	c.Lock()
+	defer c.Unlock()
+	probes := c.probes[hostname]
+	if probes == nil {
+		return nil
+	}
+	p := probes[addr]
+	if p == nil {
+		p = new(tls13Probe)
+		probes[addr] = p
+	}
+	return p
+}
+
+// supportsTLS13 reports whether the host negotiates TLS 1.3. Scanners of
+// TLS 1.2 features skip hosts that only support TLS 1.3. Within a scan,
+// each address is only probed once.
+func supportsTLS13(addr, hostname string) bool {
+	hello := func() bool {
+		_, _, _, err := sayHello13(addr, hostname, nil, nil, nil, nil)
+		return err == nil
+	}
+
+	p := tls13Probes.probe(addr, hostname)
+	if p == nil {
+		return hello()
+	}
+	p.once.Do(func() { p.ok = hello() })
+	return p.ok
+}
+
+// acceptsVersion reports whether the host negotiates vers.
+func acceptsVersion(addr, hostname string, vers uint16) bool {
+	if vers == tls.VersionTLS13 {
+		return supportsTLS13(addr, hostname)
+	}
+	_, _, _, err := sayHello(addr, hostname, nil, nil, vers, nil)
+	return err == nil
+}
+
+// supportedVersions returns the SSL/TLS versions negotiated by addr, newest
+// first.
+func supportedVersions(addr, hostname string) (versions []uint16) {
+	var vers uint16
+	for vers = tls.VersionTLS13; vers >= tls.VersionSSL30; vers-- {
+		if acceptsVersion(addr, hostname, vers) {
+			versions = append(versions, vers)
+		}
+	}
+	return
+}
+
+// versionsScan returns, for each of the host's addresses, the SSL/TLS
+// versions it negotiates.
+func versionsScan(addr, hostname string) (grade Grade, output Output, err error) {
+	return multiscan(addr, func(addrport string) (g Grade, o Output, e error) {
+		versions := supportedVersions(addrport, hostname)
+		if len(versions) == 0 {
+			e = errors.New("couldn't negotiate any protocol versions")
+			return
+		}
+
+		g = Good
+		versStrings := make([]string, len(versions))
+		for i, vers := range versions {
+			if vers == tls.VersionSSL30 {
+				g = Warning
+			}
+			versStrings[i] = tls.Versions[vers]
+		}
+		o = versStrings
+		return
+	})
+}
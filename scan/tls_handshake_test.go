@@ -0,0 +1,266 @@
+package scan
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// tls13Server answers ClientHellos like a TLS 1.3-only server, without
+// completing any handshake. Preferences are in the server's order.
+type tls13Server struct {
+	net.Listener
+	ciphers    []uint16
+	groups     []uint16
+	sigSchemes []uint16
+	// hellos counts the ClientHellos received.
+	hellos int32
+}
+
+type clientHello struct {
+	ciphers, groups, keyShares, sigSchemes, versions []uint16
+}
+
+func newTLS13Server(t *testing.T, ciphers, groups, sigSchemes []uint16) *tls13Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &tls13Server{Listener: l, ciphers: ciphers, groups: groups, sigSchemes: sigSchemes}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func uint16s(b []byte) []uint16 {
+	list := make([]uint16, len(b)/2)
+	for i := range list {
+		list[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return list
+}
+
+func first(prefs, offered []uint16) (uint16, bool) {
+	for _, p := range prefs {
+		for _, o := range offered {
+			if p == o {
+				return p, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func parseClientHello(msg []byte) *clientHello {
+	hello := &clientHello{}
+	// Skip the handshake header, version, random and session ID.
+	msg = msg[4+2+32:]
+	msg = msg[1+int(msg[0]):]
+	n := int(binary.BigEndian.Uint16(msg))
+	hello.ciphers = uint16s(msg[2 : 2+n])
+	msg = msg[2+n:]
+	msg = msg[1+int(msg[0])+2:]
+	for len(msg) >= 4 {
+		ext := binary.BigEndian.Uint16(msg)
+		n := int(binary.BigEndian.Uint16(msg[2:]))
+		body := msg[4 : 4+n]
+		msg = msg[4+n:]
+		switch ext {
+		case 10:
+			hello.groups = uint16s(body[2:])
+		case 13:
+			hello.sigSchemes = uint16s(body[2:])
+		case 43:
+			hello.versions = uint16s(body[1:])
+		case 51:
+			for body = body[2:]; len(body) >= 4; {
+				hello.keyShares = append(hello.keyShares, binary.BigEndian.Uint16(body))
+				n := int(binary.BigEndian.Uint16(body[2:]))
+				body = body[4+n:]
+			}
+		}
+	}
+	return hello
+}
+
+func (s *tls13Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return
+	}
+	if len(msg) < 4 || msg[0] != 1 {
+		return
+	}
+	atomic.AddInt32(&s.hellos, 1)
+	hello := parseClientHello(msg)
+
+	alert := func(desc byte) {
+		conn.Write([]byte{21, 3, 3, 0, 2, 2, desc})
+	}
+	if _, ok := first([]uint16{tls.VersionTLS13}, hello.versions); !ok {
+		alert(70) // protocol_version
+		return
+	}
+	cipher, ok := first(s.ciphers, hello.ciphers)
+	if !ok {
+		alert(40) // handshake_failure
+		return
+	}
+	group, ok := first(s.groups, hello.groups)
+	if !ok {
+		alert(40)
+		return
+	}
+
+	random := make([]byte, 32)
+	keyShare := []byte{byte(group >> 8), byte(group)}
+	if _, ok = first([]uint16{group}, hello.keyShares); !ok {
+		random = []byte{
+			0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11,
+			0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+			0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E,
+			0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+		}
+	} else if _, ok = first(s.sigSchemes, hello.sigSchemes); !ok {
+		alert(40)
+		return
+	} else {
+		keyShare = append(keyShare, 0, 32)
+		keyShare = append(keyShare, make([]byte, 32)...)
+	}
+
+	var ext bytes.Buffer
+	binary.Write(&ext, binary.BigEndian, []uint16{43, 2, tls.VersionTLS13, 51, uint16(len(keyShare))})
+	ext.Write(keyShare)
+
+	var body bytes.Buffer
+	binary.Write(&body, binary.BigEndian, uint16(tls.VersionTLS12))
+	body.Write(random)
+	body.WriteByte(0)
+	binary.Write(&body, binary.BigEndian, cipher)
+	body.WriteByte(0)
+	binary.Write(&body, binary.BigEndian, uint16(ext.Len()))
+	body.Write(ext.Bytes())
+
+	n := body.Len()
+	record := []byte{22, 3, 3, byte((n + 4) >> 8), byte(n + 4), 2, byte(n >> 16), byte(n >> 8), byte(n)}
+	conn.Write(append(record, body.Bytes()...))
+}
+
+func TestTLS13Scans(t *testing.T) {
+	s := newTLS13Server(t,
+		[]uint16{0x1302, 0x1301},
+		[]uint16{29, 23},
+		[]uint16{0x0804, 0x0403},
+	)
+	defer s.Close()
+	addr := s.Addr().String()
+
+	grade, output, err := cipherSuiteScan(addr, "localhost")
+	if err != nil || grade != Good {
+		t.Fatalf("CipherSuite: %v %v", grade, err)
+	}
+	out, err := json.Marshal(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"TLS_AES_256_GCM_SHA384":[{"TLS 1.3":["x25519","secp256r1"]}]},` +
+		`{"TLS_AES_128_GCM_SHA256":[{"TLS 1.3":["x25519","secp256r1"]}]}]`
+	if string(out) != expected {
+		t.Fatalf("CipherSuite: have %s", out)
+	}
+
+	_, output, err = keyShareGroupsScan(addr, "localhost")
+	if err != nil || !reflect.DeepEqual(output, []string{"x25519", "secp256r1"}) {
+		t.Fatalf("KeyShareGroups: %v %v", output, err)
+	}
+
+	_, output, err = sigSchemesScan(addr, "localhost")
+	if err != nil || !reflect.DeepEqual(output, []tls.SignatureScheme{0x0403, 0x0804}) {
+		t.Fatalf("SigSchemes: %v %v", output, err)
+	}
+
+	// The TLS 1.2 scanners have nothing to report for a TLS 1.3-only host.
+	if grade, _, err = sigAlgsScan(addr, "localhost"); err != nil || grade != Skipped {
+		t.Fatalf("SigAlgs: %v %v", grade, err)
+	}
+
+	grade, output, err = versionsScan(addr, "localhost")
+	if err != nil || grade != Good {
+		t.Fatalf("Versions: %v %v", grade, err)
+	}
+	expectedVersions := map[string]Output{"127.0.0.1": []string{"TLS 1.3"}}
+	if !reflect.DeepEqual(output, expectedVersions) {
+		t.Fatalf("Versions: have %v", output)
+	}
+}
+
+func TestTLS13ScansWithoutTLS13(t *testing.T) {
+	s := newTLS13Server(t, []uint16{0x1301}, []uint16{29}, []uint16{0x0403})
+	defer s.Close()
+	addr := s.Addr().String()
+
+	// Nothing is negotiated without TLS 1.3 cipher suites in common.
+	_, _, _, err := sayHello13(addr, "localhost", []uint16{0x1302}, nil, nil, nil)
+	if err != errHelloFailed {
+		t.Fatalf("expected the hello to fail, have %v", err)
+	}
+
+	s.Close()
+	s = newTLS13Server(t, nil, []uint16{29}, []uint16{0x0403})
+	defer s.Close()
+	addr = s.Addr().String()
+	if grade, _, err := sigSchemesScan(addr, "localhost"); err != nil || grade != Skipped {
+		t.Fatalf("SigSchemes: %v %v", grade, err)
+	}
+	if grade, _, err := keyShareGroupsScan(addr, "localhost"); err != nil || grade != Skipped {
+		t.Fatalf("KeyShareGroups: %v %v", grade, err)
+	}
+}
+
+func TestTLS13ProbeCached(t *testing.T) {
+	s := newTLS13Server(t, []uint16{0x1301}, []uint16{29}, []uint16{0x0403})
+	defer s.Close()
+	addr := s.Addr().String()
+
+	// Without a scan holding the hostname, every call probes the host.
+	supportsTLS13(addr, "localhost")
+	supportsTLS13(addr, "localhost")
+	if n := atomic.LoadInt32(&s.hellos); n != 2 {
+		t.Fatalf("expected 2 probes, have %d", n)
+	}
+
+	release := tls13Probes.hold("localhost")
+	for i := 0; i < 3; i++ {
+		if !supportsTLS13(addr, "localhost") {
+			t.Fatal("expected the host to support TLS 1.3")
+		}
+	}
+	if n := atomic.LoadInt32(&s.hellos); n != 3 {
+		t.Fatalf("expected 3 probes, have %d", n)
+	}
+
+	release()
+	if len(tls13Probes.probes) != 0 {
+		t.Fatal("expected the probes to be dropped once released")
+	}
+}
@@ -406,6 +406,7 @@ func (s *Signer) Sign(req signer.SignRequest) (cert []byte, err error) {
 			Status:  "good",
 			Expiry:  certTBS.NotAfter,
 			PEM:     string(signedCert),
+			Profile: req.Profile,
 		}
 
 		err = s.dbAccessor.InsertCertificate(certRecord)
@@ -515,6 +516,7 @@ func (s *Signer) Info(req info.Req) (resp *info.Resp, err error) {
 	}
 	resp.Usage = profile.Usage
 	resp.ExpiryString = profile.ExpiryString
+	resp.RenewalWindow = profile.RenewalWindow
 
 	return
 }
@@ -0,0 +1,22 @@
+// +build go1.10
+
+package signer
+
+import (
+	"crypto/x509"
+
+	"github.com/cloudflare/cfssl/config"
+)
+
+// setNameConstraints copies the name constraints of a profile to a CA
+// certificate template.
+func setNameConstraints(template *x509.Certificate, nc *config.NameConstraints) error {
+	template.PermittedDNSDomainsCritical = nc.Critical
+	template.PermittedDNSDomains = nc.PermittedDNSDomains
+	template.ExcludedDNSDomains = nc.ExcludedDNSDomains
+	template.PermittedIPRanges = nc.PermittedIPNets
+	template.ExcludedIPRanges = nc.ExcludedIPNets
+	template.PermittedEmailAddresses = nc.PermittedEmailAddresses
+	template.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
+	return nil
+}
@@ -0,0 +1,24 @@
+// +build !go1.10
+
+package signer
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/cloudflare/cfssl/config"
+)
+
+// setNameConstraints copies the name constraints of a profile to a CA
+// certificate template. Before Go 1.10, crypto/x509 can only encode
+// permitted DNS domains, so profiles using any other constraint are
+// refused rather than issuing a less constrained CA.
+func setNameConstraints(template *x509.Certificate, nc *config.NameConstraints) error {
+	if len(nc.ExcludedDNSDomains) > 0 || len(nc.PermittedIPNets) > 0 || len(nc.ExcludedIPNets) > 0 ||
+		len(nc.PermittedEmailAddresses) > 0 || len(nc.ExcludedEmailAddresses) > 0 {
+		return errors.New("name constraints other than permitted DNS domains need Go 1.10 or later")
+	}
+	template.PermittedDNSDomainsCritical = nc.Critical
+	template.PermittedDNSDomains = nc.PermittedDNSDomains
+	return nil
+}
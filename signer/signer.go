@@ -320,6 +320,11 @@ func FillTemplate(template *x509.Certificate, defaultProfile, profile *config.Si
 		}
 		template.DNSNames = nil
 		template.EmailAddresses = nil
+		if nc := profile.NameConstraints; nc != nil {
+			if err := setNameConstraints(template, nc); err != nil {
+				return cferr.Wrap(cferr.PolicyError, cferr.InvalidPolicy, err)
+			}
+		}
 	}
 	template.SubjectKeyId = ski
 
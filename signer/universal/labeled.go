@@ -0,0 +1,126 @@
+package universal
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/cloudflare/cfssl/certdb"
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/info"
+	"github.com/cloudflare/cfssl/signer"
+)
+
+// Labeled is a signer that sends sign and info requests to the signer
+// registered under the request's label. Requests for an empty or unknown
+// label, and every other call, go to the default signer. Signers may be
+// registered, and the default signer replaced, while the Labeled signer
+// is serving requests.
+type Labeled struct {
+	mu     sync.RWMutex
+	def    signer.Signer
+	labels map[string]signer.Signer
+}
+
+// NewLabeled returns a Labeled signer with s as the default signer.
+func NewLabeled(s signer.Signer) *Labeled {
+	return &Labeled{def: s, labels: map[string]signer.Signer{}}
+}
+
+// Register adds s under label. Labels can't be replaced once registered.
+func (l *Labeled) Register(label string, s signer.Signer) error {
+	if label == "" {
+		return errors.New("signer label must not be empty")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.labels[label]; ok {
+		return errors.New("signer label " + label + " is already registered")
+	}
+	l.labels[label] = s
+	return nil
+}
+
+// Registered reports whether a signer is registered under label.
+func (l *Labeled) Registered(label string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.labels[label]
+	return ok
+}
+
+// SetDefault replaces the default signer. Requests already in flight
+// finish with the signer they started with.
+func (l *Labeled) SetDefault(s signer.Signer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def = s
+}
+
+// Default returns the default signer.
+func (l *Labeled) Default() signer.Signer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.def
+}
+
+func (l *Labeled) lookup(label string) signer.Signer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if s, ok := l.labels[label]; ok {
+		return s
+	}
+	return l.def
+}
+
+// Sign signs the request with the signer registered under its label.
+func (l *Labeled) Sign(req signer.SignRequest) (cert []byte, err error) {
+	return l.lookup(req.Label).Sign(req)
+}
+
+// Info returns the info of the signer registered under the request's
+// label.
+func (l *Labeled) Info(req info.Req) (*info.Resp, error) {
+	return l.lookup(req.Label).Info(req)
+}
+
+// Policy returns the default signer's policy.
+func (l *Labeled) Policy() *config.Signing {
+	return l.Default().Policy()
+}
+
+// SetPolicy sets the default signer's policy.
+func (l *Labeled) SetPolicy(policy *config.Signing) {
+	l.Default().SetPolicy(policy)
+}
+
+// SetLabelPolicy sets the policy of every registered signer.
+func (l *Labeled) SetLabelPolicy(policy *config.Signing) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, s := range l.labels {
+		s.SetPolicy(policy)
+	}
+}
+
+// SetDBAccessor sets the default signer's cert db accessor.
+func (l *Labeled) SetDBAccessor(dba certdb.Accessor) {
+	l.Default().SetDBAccessor(dba)
+}
+
+// GetDBAccessor returns the default signer's cert db accessor.
+func (l *Labeled) GetDBAccessor() certdb.Accessor {
+	return l.Default().GetDBAccessor()
+}
+
+// SigAlgo returns the default signer's signature algorithm.
+func (l *Labeled) SigAlgo() x509.SignatureAlgorithm {
+	return l.Default().SigAlgo()
+}
+
+// SetReqModifier sets the default signer's HTTP request modifier.
+func (l *Labeled) SetReqModifier(mod func(*http.Request, []byte)) {
+	l.Default().SetReqModifier(mod)
+}
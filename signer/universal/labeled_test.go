@@ -0,0 +1,127 @@
+package universal
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/cloudflare/cfssl/config"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/info"
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/cloudflare/cfssl/signer/local"
+)
+
+func TestLabeled(t *testing.T) {
+	def, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, validLocalConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := local.NewSignerFromFile("../local/testdata/ecdsa256_ca.pem", "../local/testdata/ecdsa256_ca_key.pem", validLocalConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLabeled(def)
+	if err = l.Register("", other); err == nil {
+		t.Fatal("expected an empty label to be rejected")
+	}
+	if err = l.Register("other", other); err != nil {
+		t.Fatal(err)
+	}
+	if err = l.Register("other", def); err == nil {
+		t.Fatal("expected a registered label not to be replaced")
+	}
+	if !l.Registered("other") || l.Registered("missing") {
+		t.Fatal("Registered reports the wrong labels")
+	}
+
+	csrPEM, err := ioutil.ReadFile("../local/testdata/ecdsa256.csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for label, issuer := range map[string]string{"": testCaFile, "missing": testCaFile, "other": "../local/testdata/ecdsa256_ca.pem"} {
+		certPEM, err := l.Sign(signer.SignRequest{Hosts: []string{"example.com"}, Request: string(csrPEM), Label: label})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := helpers.ParseCertificatePEM(certPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		caPEM, err := ioutil.ReadFile(issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ca, err := helpers.ParseCertificatePEM(caPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cert.CheckSignatureFrom(ca); err != nil {
+			t.Fatalf("label %q signed by the wrong CA: %v", label, err)
+		}
+
+		resp, err := l.Info(info.Req{Label: label})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Certificate != strings.TrimSpace(string(helpers.EncodeCertificatePEM(ca))) {
+			t.Fatalf("label %q returned the info of the wrong CA", label)
+		}
+	}
+}
+
+func TestLabeledSetDefault(t *testing.T) {
+	def, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, validLocalConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := local.NewSignerFromFile("../local/testdata/ecdsa256_ca.pem", "../local/testdata/ecdsa256_ca_key.pem", validLocalConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLabeled(def)
+	if err = l.Register("kept", def); err != nil {
+		t.Fatal(err)
+	}
+	l.SetDefault(other)
+	if l.Default() != other {
+		t.Fatal("default signer was not replaced")
+	}
+	if !l.Registered("kept") {
+		t.Fatal("replacing the default signer dropped a registered label")
+	}
+	if l.SigAlgo() != other.SigAlgo() {
+		t.Fatal("calls are not sent to the new default signer")
+	}
+}
+
+func TestLabeledSetLabelPolicy(t *testing.T) {
+	def, err := local.NewSignerFromFile(testCaFile, testCaKeyFile, validLocalConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := local.NewSignerFromFile("../local/testdata/ecdsa256_ca.pem", "../local/testdata/ecdsa256_ca_key.pem", validLocalConfig.Signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLabeled(def)
+	if err = l.Register("other", other); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &config.Signing{
+		Profiles: map[string]*config.SigningProfile{},
+		Default:  config.DefaultConfig(),
+	}
+	l.SetLabelPolicy(policy)
+	if other.Policy() != policy {
+		t.Fatal("registered signer kept its policy")
+	}
+	if def.Policy() == policy {
+		t.Fatal("default signer's policy was replaced")
+	}
+}
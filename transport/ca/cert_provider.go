@@ -14,3 +14,12 @@ type CertificateAuthority interface {
 	// certificate.
 	CACertificate() (cert []byte, err error)
 }
+
+// A RenewalAdvisor is a CertificateAuthority that can suggest when
+// the certificates it issues should be renewed.
+type RenewalAdvisor interface {
+	// RenewalWindow returns the fraction of a certificate's
+	// lifetime after which it should be renewed, or 0 if the CA
+	// has no preference.
+	RenewalWindow() (float64, error)
+}
@@ -232,8 +232,7 @@ func (cap *CFSSL) SignCSR(csrPEM []byte) (cert []byte, err error) {
 	return cap.remote.Sign(out)
 }
 
-// CACertificate returns the certificate for a CFSSL CA.
-func (cap *CFSSL) CACertificate() ([]byte, error) {
+func (cap *CFSSL) info() (*info.Resp, error) {
 	req := &info.Req{
 		Label:   cap.Label,
 		Profile: cap.Profile,
@@ -243,7 +242,12 @@ func (cap *CFSSL) CACertificate() ([]byte, error) {
 		return nil, err
 	}
 
-	resp, err := cap.remote.Info(out)
+	return cap.remote.Info(out)
+}
+
+// CACertificate returns the certificate for a CFSSL CA.
+func (cap *CFSSL) CACertificate() ([]byte, error) {
+	resp, err := cap.info()
 	if err != nil {
 		return nil, err
 	}
@@ -251,6 +255,17 @@ func (cap *CFSSL) CACertificate() ([]byte, error) {
 	return []byte(resp.Certificate), nil
 }
 
+// RenewalWindow returns the renewal window advertised by the CFSSL
+// CA's profile.
+func (cap *CFSSL) RenewalWindow() (float64, error) {
+	resp, err := cap.info()
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.RenewalWindow, nil
+}
+
 // NewCFSSLProvider takes the configuration information from an
 // Identity (and an optional default remote), returning a CFSSL
 // instance. There should be a profile in id called "cfssl", which
@@ -62,6 +62,24 @@ func (lca *CA) CACertificate() ([]byte, error) {
 	return pem.EncodeToMemory(p), nil
 }
 
+// RenewalWindow returns the renewal window of the CA's signing
+// profile.
+func (lca *CA) RenewalWindow() (float64, error) {
+	if lca == nil || lca.s == nil {
+		return 0, errNotSetup
+	}
+
+	if lca.disabled {
+		return 0, errDisabled
+	}
+
+	profile, err := signer.Profile(lca.s, lca.Profile)
+	if err != nil {
+		return 0, err
+	}
+	return profile.RenewalWindow, nil
+}
+
 var errDisabled = errors.New("transport: local CA is deactivated")
 
 // SignCSR submits a PKCS #10 certificate signing request to a CA for
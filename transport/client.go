@@ -2,11 +2,12 @@ package transport
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/cloudflare/backoff"
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/errors"
 	"github.com/cloudflare/cfssl/log"
@@ -28,9 +29,7 @@ func envOrDefault(key, def string) string {
 var (
 	// NewKeyProvider is the function used to build key providers
 	// from some identity.
-	NewKeyProvider = func(id *core.Identity) (kp.KeyProvider, error) {
-		return kp.NewStandardProvider(id)
-	}
+	NewKeyProvider = kp.New
 
 	// NewCA is used to load a configuration for a certificate
 	// authority.
@@ -46,9 +45,19 @@ type Transport struct {
 	// transport should start attempting to refresh the
 	// certificate. For example, if this is 24h, then 24 hours
 	// before the certificate expires the Transport will start
-	// attempting to replace it.
+	// attempting to replace it. It is only used when there is no
+	// renewal window.
 	Before time.Duration
 
+	// RenewalWindow, if non-zero, is the fraction of the
+	// certificate's lifetime after which it is renewed. If it is
+	// zero, a window suggested by the CA is used instead.
+	RenewalWindow float64
+
+	// RenewalJitter is the largest fraction of the certificate's
+	// lifetime by which renewal is brought forward at random.
+	RenewalJitter float64
+
 	// Provider contains a key management provider.
 	Provider kp.KeyProvider
 
@@ -70,52 +79,163 @@ type Transport struct {
 	// Backoff is used to control the behaviour of a Transport
 	// when it is attempting to automatically update a certificate
 	// as part of AutoUpdate.
-	Backoff *backoff.Backoff
+	Backoff *core.Backoff
 
 	// RevokeSoftFail, if true, will cause a failure to check
 	// revocation (such that the revocation status of a
 	// certificate cannot be checked) to not be treated as an
 	// error.
 	RevokeSoftFail bool
+
+	// Pins, if not empty, requires peers to present a chain
+	// containing one of these keys.
+	Pins roots.Pins
+
+	// Peers, if not empty, lists the rules that a trusted peer's
+	// certificate must satisfy one of.
+	Peers []*core.PeerRule
+
+	// TLSProfile selects the TLS settings of every configuration
+	// the transport builds. If it is nil, the intermediate
+	// profile is used.
+	TLSProfile *core.TLSProfile
+
+	mu      sync.Mutex
+	errChan chan<- error
+
+	// The window suggested by the CA, and the renewal time of the
+	// certificate it was computed for.
+	caWindow   float64
+	caAsked    bool
+	renewCert  *x509.Certificate
+	renewAfter time.Time
 }
 
 // TLSClientAuthClientConfig returns a new client authentication TLS
 // configuration that can be used for a client using client auth
-// connecting to the named host.
+// connecting to the named host. The server is verified against the
+// trust store's roots at the time of each handshake, so the
+// configuration picks up refreshed roots.
 func (tr *Transport) TLSClientAuthClientConfig(host string) (*tls.Config, error) {
 	cert, err := tr.getCertificate()
 	if err != nil {
 		return nil, err
 	}
 
-	return &tls.Config{
+	config := &tls.Config{
 		Certificates: []tls.Certificate{cert},
-		RootCAs:      tr.TrustStore.Pool(),
 		ServerName:   host,
-		CipherSuites: core.CipherSuites,
-		MinVersion:   tls.VersionTLS12,
 		ClientAuth:   tls.RequireAndVerifyClientCert,
-	}, nil
+
+		// Verification is done by VerifyPeerCertificate
+		// against the current pool rather than a pool
+		// captured here.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, err := tr.verifyPeer(tr.TrustStore, rawCerts, host, x509.ExtKeyUsageServerAuth)
+			return err
+		},
+	}
+	if err = tr.applyTLSProfile(config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // TLSClientAuthServerConfig returns a new client authentication TLS
 // configuration for servers expecting mutually authenticated
-// clients. The clientAuth parameter should contain the root pool used
-// to authenticate clients.
+// clients. Clients are verified against the client trust store's
+// roots and pins at the time of each handshake, so the configuration
+// picks up refreshed roots.
 func (tr *Transport) TLSClientAuthServerConfig() (*tls.Config, error) {
 	cert, err := tr.getCertificate()
 	if err != nil {
 		return nil, err
 	}
 
-	return &tls.Config{
+	// ClientCAs is only advertised to clients; verification is
+	// done by VerifyPeerCertificate so that pins are honoured.
+	config := &tls.Config{
 		Certificates: []tls.Certificate{cert},
 		RootCAs:      tr.TrustStore.Pool(),
 		ClientCAs:    tr.ClientTrustStore.Pool(),
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		CipherSuites: core.CipherSuites,
-		MinVersion:   tls.VersionTLS12,
-	}, nil
+		ClientAuth:   tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, err := tr.verifyPeer(tr.ClientTrustStore, rawCerts, "", x509.ExtKeyUsageClientAuth)
+			return err
+		},
+	}
+	if err = tr.applyTLSProfile(config); err != nil {
+		return nil, err
+	}
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		current := config.Clone()
+		current.GetConfigForClient = nil
+		current.RootCAs = tr.TrustStore.Pool()
+		current.ClientCAs = tr.ClientTrustStore.Pool()
+		return current, nil
+	}
+	return config, nil
+}
+
+// verifyPeer parses the peer's certificates and verifies them against
+// store and the transport's pins, then authorizes it against the peer
+// rules, returning the verified chains. Pin mismatches are reported to
+// the AutoUpdate error channel.
+func (tr *Transport) verifyPeer(store *roots.TrustStore, rawCerts [][]byte, host string, usage x509.ExtKeyUsage) ([][]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, errors.New(errors.CertificateError, errors.ParseFailed)
+		}
+		certs[i] = cert
+	}
+
+	chains, err := store.Verify(certs, host, usage)
+	if err == nil && len(tr.Pins) > 0 {
+		err = roots.ErrPinMismatch
+		for _, chain := range chains {
+			if tr.Pins.Match(chain) {
+				err = nil
+				break
+			}
+		}
+	}
+
+	if err == roots.ErrPinMismatch {
+		log.Warning(err.Error())
+		tr.reportError(err)
+	}
+	if err == nil {
+		err = authorize(tr.Peers, certs[0])
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.CertificateError, errors.VerifyFailed, err)
+	}
+	return chains, nil
+}
+
+// reportError passes err to the channel given to AutoUpdate, if any,
+// without holding up the caller. A peer can cause errors at will, so
+// they are dropped unless the channel has room or a reader is waiting.
+func (tr *Transport) reportError(err error) {
+	tr.mu.Lock()
+	errChan := tr.errChan
+	tr.mu.Unlock()
+
+	if errChan != nil {
+		select {
+		case errChan <- err:
+		default:
+		}
+	}
+}
+
+func (tr *Transport) setErrChan(errChan chan<- error) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.errChan = errChan
 }
 
 // TLSServerConfig is a general server configuration that should be
@@ -126,11 +246,13 @@ func (tr *Transport) TLSServerConfig() (*tls.Config, error) {
 		return nil, err
 	}
 
-	return &tls.Config{
+	config := &tls.Config{
 		Certificates: []tls.Certificate{cert},
-		CipherSuites: core.CipherSuites,
-		MinVersion:   tls.VersionTLS12,
-	}, nil
+	}
+	if err = tr.applyTLSProfile(config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // New builds a new transport from an identity and a before time. The
@@ -142,7 +264,7 @@ func New(before time.Duration, identity *core.Identity) (*Transport, error) {
 	var tr = &Transport{
 		Before:   before,
 		Identity: identity,
-		Backoff:  &backoff.Backoff{},
+		Backoff:  &core.Backoff{},
 	}
 
 	store, err := roots.New(identity.Roots)
@@ -159,6 +281,31 @@ func New(before time.Duration, identity *core.Identity) (*Transport, error) {
 		tr.ClientTrustStore = store
 	}
 
+	if len(identity.Pins) > 0 {
+		tr.Pins, err = roots.ParsePins(identity.Pins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = checkPeerRules(identity.Peers); err != nil {
+		return nil, err
+	}
+	tr.Peers = identity.Peers
+
+	if identity.Renewal != nil {
+		if err = checkRenewal(identity.Renewal); err != nil {
+			return nil, err
+		}
+		tr.RenewalWindow = identity.Renewal.Window
+		tr.RenewalJitter = identity.Renewal.Jitter
+	}
+
+	if _, err = resolveTLSProfile(identity.TLS); err != nil {
+		return nil, err
+	}
+	tr.TLSProfile = identity.TLS
+
 	tr.Provider, err = NewKeyProvider(identity)
 	if err != nil {
 		return nil, err
@@ -173,8 +320,8 @@ func New(before time.Duration, identity *core.Identity) (*Transport, error) {
 }
 
 // Lifespan returns how much time is left before the transport's
-// certificate expires, or 0 if the certificate is not present or
-// expired.
+// certificate should be renewed, or 0 if the certificate is not
+// present, expired or due for renewal.
 func (tr *Transport) Lifespan() time.Duration {
 	cert := tr.Provider.Certificate()
 	if cert == nil {
@@ -186,8 +333,7 @@ func (tr *Transport) Lifespan() time.Duration {
 		return 0
 	}
 
-	now = now.Add(tr.Before)
-	ls := cert.NotAfter.Sub(now)
+	ls := tr.renewalTime(cert).Sub(now)
 	log.Debugf("   LIFESPAN:\t%s", ls)
 	if ls < 0 {
 		return 0
@@ -218,8 +364,10 @@ func (tr *Transport) RefreshKeys() (err error) {
 		}
 	}
 
+	tr.askCA(false)
+
 	lifespan := tr.Lifespan()
-	if lifespan < tr.Before {
+	if tr.renewalDue(lifespan) {
 		log.Debugf("transport's certificate is out of date (lifespan %s)", lifespan)
 		req, err := tr.Provider.CertificateRequest(tr.Identity.Request)
 		if err != nil {
@@ -249,6 +397,7 @@ func (tr *Transport) RefreshKeys() (err error) {
 			}
 			return err
 		}
+		tr.askCA(true)
 
 		if tr.Provider.Persistent() {
 			log.Debug("storing the certificate")
@@ -305,12 +454,21 @@ func Dial(address string, tr *Transport) (*tls.Conn, error) {
 		return nil, err
 	}
 
+	// The handshake verified the server against the trust
+	// store; verify again to recover the chains for the
+	// revocation check.
 	state := conn.ConnectionState()
-	if len(state.VerifiedChains) == 0 {
-		return nil, errors.New(errors.CertificateError, errors.VerifyFailed)
+	rawCerts := make([][]byte, len(state.PeerCertificates))
+	for i, cert := range state.PeerCertificates {
+		rawCerts[i] = cert.Raw
+	}
+	chains, err := tr.verifyPeer(tr.TrustStore, rawCerts, host, x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	for _, chain := range state.VerifiedChains {
+	for _, chain := range chains {
 		for _, cert := range chain {
 			revoked, ok := revoke.VerifyCertificate(cert)
 			if (!tr.RevokeSoftFail && !ok) || revoked {
@@ -325,8 +483,11 @@ func Dial(address string, tr *Transport) (*tls.Conn, error) {
 // AutoUpdate will automatically update the listener. If a non-nil
 // certUpdates chan is provided, it will receive timestamps for
 // reissued certificates. If errChan is non-nil, any errors that occur
-// in the updater will be passed along.
+// in the updater will be passed along, as will pin mismatches seen
+// during handshakes; those are dropped while nothing is ready to
+// receive them.
 func (tr *Transport) AutoUpdate(certUpdates chan<- time.Time, errChan chan<- error) {
+	tr.setErrChan(errChan)
 	defer func() {
 		if r := recover(); r != nil {
 			log.Criticalf("AutoUpdate panicked: %v", r)
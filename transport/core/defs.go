@@ -38,12 +38,95 @@ type Identity struct {
 	// certificates.
 	ClientRoots []*Root `json:"client_roots"`
 
+	// Pins, if present, lists SPKI hashes of the form
+	// "sha256/<base64>". A peer must, in addition to being
+	// trusted by the roots, present a chain containing one of the
+	// pinned keys.
+	Pins []string `json:"pins,omitempty"`
+
+	// Peers, if present, restricts which peers may connect: a
+	// peer's certificate must satisfy at least one of the rules.
+	Peers []*PeerRule `json:"peers,omitempty"`
+
+	// Renewal, if present, controls when in its lifetime the
+	// certificate is renewed.
+	Renewal *Renewal `json:"renewal,omitempty"`
+
+	// TLS, if present, selects the TLS versions, cipher suites,
+	// curves and other settings of every configuration the
+	// transport builds. The "intermediate" profile is used if it
+	// isn't present.
+	TLS *TLSProfile `json:"tls,omitempty"`
+
 	// Profiles contains a dictionary of names to dictionaries;
 	// this is intended to allow flexibility in supporting
 	// multiple configurations.
 	Profiles map[string]map[string]string `json:"profiles"`
 }
 
+// A PeerRule describes an authorized peer. Each field lists patterns,
+// in the syntax of path.Match, for one attribute of the peer's
+// certificate. A rule matches if, for every non-empty field, one of
+// the patterns matches the attribute (or, for SANs, one of the
+// certificate's names). An empty rule matches any peer.
+type PeerRule struct {
+	CommonName         []string `json:"common_name,omitempty"`
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizational_unit,omitempty"`
+	DNSNames           []string `json:"dns_names,omitempty"`
+	URIs               []string `json:"uris,omitempty"`
+
+	// Issuer matches the common name of the certificate's issuer.
+	Issuer []string `json:"issuer,omitempty"`
+}
+
+// Renewal describes when a certificate should be renewed, in
+// fractions of its lifetime.
+type Renewal struct {
+	// Window is the fraction of the lifetime after which the
+	// certificate is renewed; 0.7 renews once 70% of the lifetime
+	// has passed. If it is zero, the CA's suggestion is used.
+	Window float64 `json:"window,omitempty"`
+
+	// Jitter is the largest fraction of the lifetime by which
+	// renewal is brought forward at random, so that replicas
+	// holding certificates issued at the same time don't all
+	// renew at once.
+	Jitter float64 `json:"jitter,omitempty"`
+}
+
+// The named TLS profiles. "modern" only allows TLS 1.3;
+// "intermediate" allows TLS 1.2 and later with CipherSuites; "custom"
+// starts from "intermediate" and applies the profile's own settings.
+const (
+	TLSProfileModern       = "modern"
+	TLSProfileIntermediate = "intermediate"
+	TLSProfileCustom       = "custom"
+)
+
+// A TLSProfile describes the TLS settings of a transport. Versions
+// are written as "1.0" to "1.3" ("1.3", like the "modern" profile,
+// needs Go 1.12 or later), cipher suites by their names in
+// crypto/tls (e.g. "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256") and
+// curves as "X25519", "P-256", "P-384" or "P-521". Versions, cipher
+// suites and curves may only be set in a "custom" profile; the
+// application protocols and session tickets apply to any profile.
+type TLSProfile struct {
+	Name         string   `json:"name"`
+	MinVersion   string   `json:"min_version,omitempty"`
+	MaxVersion   string   `json:"max_version,omitempty"`
+	CipherSuites []string `json:"cipher_suites,omitempty"`
+	Curves       []string `json:"curves,omitempty"`
+
+	// ALPN lists the application protocols to negotiate, in
+	// order of preference.
+	ALPN []string `json:"alpn,omitempty"`
+
+	// DisableSessionTickets turns off TLS session resumption
+	// through tickets.
+	DisableSessionTickets bool `json:"disable_session_tickets,omitempty"`
+}
+
 // DefaultBefore is a sensible default; attempt to regenerate certificates the
 // day before they expire.
 var DefaultBefore = 24 * time.Hour
@@ -27,10 +27,11 @@
 // The New function will return a transport built using the
 // NewKeyProvider and NewCA functions. These functions may be changed
 // by other packages to provide common key provider and CA
-// configurations. Clients can then use RefreshKeys (or launch
-// AutoUpdate in a goroutine) to ensure the certificate and key are
-// loaded and correct. The Listen and Dial functions then provide the
-// necessary connection support.
+// configurations. By default, the key provider is chosen by the
+// identity's "key" profile, as described in kp.New. Clients can then
+// use RefreshKeys (or launch AutoUpdate in a goroutine) to ensure the
+// certificate and key are loaded and correct. The Listen and Dial
+// functions then provide the necessary connection support.
 //
 // The AutoUpdate function will handle automatic certificate
 // issuance. Servers and clients are not required to take any special
@@ -40,4 +41,15 @@
 // any existing connections. Clients should run AutoUpdate if they
 // plan on making multiple connections or will be reconnecting; for a
 // one-off connection, it isn't necessary.
+//
+// An identity may also carry peer rules, which are checked during the
+// handshake after the peer's chain has been verified. For example, a
+// server that only accepts clients from the billing team would use
+//
+//     Peers: []*core.PeerRule{
+//             {OrganizationalUnit: []string{"billing"}},
+//     },
+//
+// The Peer function returns the verified identity of the other end of
+// a connection.
 package transport
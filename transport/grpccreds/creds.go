@@ -0,0 +1,162 @@
+// Package grpccreds provides gRPC transport credentials backed by a
+// transport.Transport. Every handshake uses the transport's current
+// certificate and trust stores, so a gRPC client or server keeps
+// working across certificate renewals and root refreshes without a
+// restart. Peers are verified with the transport's pins and peer
+// rules, and the verified peer identity is available to handlers
+// through PeerFromContext.
+package grpccreds
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/cloudflare/cfssl/transport"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// gRPC runs over HTTP/2, which must be negotiated with ALPN.
+var alpnProtos = []string{"h2"}
+
+// AuthInfo is the authentication information of a connection. It
+// carries the TLS connection state and the verified identity of the
+// other end.
+type AuthInfo struct {
+	credentials.TLSInfo
+	Peer *transport.PeerIdentity
+}
+
+type creds struct {
+	tr         *transport.Transport
+	server     bool
+	serverName string
+}
+
+// NewClient returns credentials for a gRPC client using tr. The server
+// is verified against the transport's trust store.
+func NewClient(tr *transport.Transport) credentials.TransportCredentials {
+	return &creds{tr: tr}
+}
+
+// NewServer returns credentials for a gRPC server using tr. If the
+// transport has a client trust store, clients must present a
+// certificate it trusts.
+func NewServer(tr *transport.Transport) credentials.TransportCredentials {
+	return &creds{tr: tr, server: true}
+}
+
+// ClientHandshake performs the client side of the TLS handshake with
+// the transport's current certificate.
+func (c *creds) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	host := c.serverName
+	if host == "" {
+		host = authority
+		if i := strings.LastIndex(authority, ":"); i != -1 {
+			host = authority[:i]
+		}
+	}
+
+	config, err := c.tr.TLSClientAuthClientConfig(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	config.NextProtos = alpnProtos
+
+	conn := tls.Client(rawConn, config)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- conn.Handshake()
+	}()
+
+	select {
+	case err = <-errChan:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		rawConn.Close()
+		return nil, nil, err
+	}
+	return authenticated(conn)
+}
+
+// ServerHandshake performs the server side of the TLS handshake with
+// the transport's current certificate.
+func (c *creds) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	var config *tls.Config
+	var err error
+	if c.tr.ClientTrustStore != nil {
+		config, err = c.tr.TLSClientAuthServerConfig()
+	} else {
+		config, err = c.tr.TLSServerConfig()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	config.NextProtos = alpnProtos
+
+	conn := tls.Server(rawConn, config)
+	if err = conn.Handshake(); err != nil {
+		rawConn.Close()
+		return nil, nil, err
+	}
+	return authenticated(conn)
+}
+
+func authenticated(conn *tls.Conn) (net.Conn, credentials.AuthInfo, error) {
+	info := AuthInfo{TLSInfo: credentials.TLSInfo{State: conn.ConnectionState()}}
+	if len(info.State.PeerCertificates) > 0 {
+		id, err := transport.Peer(conn)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		info.Peer = id
+	}
+	return conn, info, nil
+}
+
+// Info returns the protocol information of the credentials. The TLS
+// version isn't set: the transport's TLS profile can allow several, and
+// the one negotiated is in each connection's AuthInfo.
+func (c *creds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{
+		SecurityProtocol: "tls",
+		ServerName:       c.serverName,
+	}
+}
+
+// Clone returns a copy of the credentials sharing the same transport.
+func (c *creds) Clone() credentials.TransportCredentials {
+	clone := *c
+	return &clone
+}
+
+// OverrideServerName sets the name used to verify the server's
+// certificate instead of the dialled authority.
+func (c *creds) OverrideServerName(name string) error {
+	if c.server {
+		return errors.New("grpccreds: server credentials don't verify a server name")
+	}
+	c.serverName = name
+	return nil
+}
+
+// PeerFromContext returns the verified identity of the peer of the RPC
+// whose context is ctx, if the connection used these credentials.
+func PeerFromContext(ctx context.Context) (*transport.PeerIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	info, ok := p.AuthInfo.(AuthInfo)
+	if !ok || info.Peer == nil {
+		return nil, false
+	}
+	return info.Peer, true
+}
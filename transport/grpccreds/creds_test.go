@@ -0,0 +1,191 @@
+package grpccreds
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/transport"
+	"github.com/cloudflare/cfssl/transport/ca/localca"
+	"github.com/cloudflare/cfssl/transport/core"
+	"github.com/cloudflare/cfssl/transport/kp"
+	"github.com/cloudflare/cfssl/transport/roots"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// rawCodec passes byte slices through unchanged, so the test service
+// doesn't need generated protobuf code.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) String() string {
+	return "raw"
+}
+
+// whoami replies with the common name of the verified caller.
+func whoami(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	var in []byte
+	if err := dec(&in); err != nil {
+		return nil, err
+	}
+
+	peer, ok := PeerFromContext(ctx)
+	if !ok {
+		return nil, errors.New("no verified peer")
+	}
+	out := []byte(peer.Subject.CommonName)
+	return &out, nil
+}
+
+var testService = grpc.ServiceDesc{
+	ServiceName: "test.Identity",
+	HandlerType: (*interface{})(nil),
+	Methods:     []grpc.MethodDesc{{MethodName: "WhoAmI", Handler: whoami}},
+}
+
+// localTransport returns a transport with a certificate for the given
+// organizational unit, issued by lca and trusting lca for both servers
+// and clients.
+func localTransport(t *testing.T, lca *localca.CA, dir, ou string, peers []*core.PeerRule) *transport.Transport {
+	caPEM, err := lca.CACertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	if err = ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	caRoots := []*core.Root{{Type: "file", Metadata: map[string]string{"source": caFile}}}
+	id := &core.Identity{
+		Request: &csr.CertificateRequest{
+			CN:         ou + " test certificate",
+			Names:      []csr.Name{{OU: ou}},
+			Hosts:      []string{"127.0.0.1"},
+			KeyRequest: csr.NewBasicKeyRequest(),
+		},
+		Roots:       caRoots,
+		ClientRoots: caRoots,
+		Profiles: map[string]map[string]string{
+			"paths": {
+				"private_key": filepath.Join(dir, ou+"-key.pem"),
+				"certificate": filepath.Join(dir, ou+".pem"),
+			},
+		},
+	}
+
+	provider, err := kp.NewStandardProvider(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := roots.New(caRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := &transport.Transport{
+		Before:           time.Minute,
+		Provider:         provider,
+		CA:               lca,
+		TrustStore:       store,
+		ClientTrustStore: store,
+		Identity:         id,
+		Backoff:          &core.Backoff{},
+		RevokeSoftFail:   true,
+		Peers:            peers,
+	}
+	if err = tr.RefreshKeys(); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func call(addr string, tr *transport.Transport) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cc, err := grpc.DialContext(ctx, addr,
+		grpc.WithTransportCredentials(NewClient(tr)),
+		grpc.WithCodec(rawCodec{}),
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer cc.Close()
+
+	in, out := []byte("ping"), []byte(nil)
+	if err = cc.Invoke(ctx, "/test.Identity/WhoAmI", &in, &out); err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func TestCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport-grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lca, err := localca.New(localca.ExampleRequest(), localca.ExampleSigningConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := localTransport(t, lca, dir, "server", []*core.PeerRule{
+		{OrganizationalUnit: []string{"billing"}},
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(NewServer(server)), grpc.CustomCodec(rawCodec{}))
+	srv.RegisterService(&testService, struct{}{})
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	billing := localTransport(t, lca, dir, "billing", nil)
+	name, err := call(l.Addr().String(), billing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "billing test certificate" {
+		t.Fatalf("expected the billing peer, have %q", name)
+	}
+
+	// A renewed certificate is used by the next connection without
+	// rebuilding the credentials.
+	serial := billing.Provider.Certificate().SerialNumber
+	billing.Before = 100 * 365 * 24 * time.Hour
+	if err = billing.RefreshKeys(); err != nil {
+		t.Fatal(err)
+	}
+	billing.Before = time.Minute
+	if billing.Provider.Certificate().SerialNumber.Cmp(serial) == 0 {
+		t.Fatal("expected a new certificate")
+	}
+	if _, err = call(l.Addr().String(), billing); err != nil {
+		t.Fatal(err)
+	}
+
+	web := localTransport(t, lca, dir, "web", nil)
+	if _, err = call(l.Addr().String(), web); err == nil {
+		t.Fatal("expected the web peer to be refused")
+	}
+}
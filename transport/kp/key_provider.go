@@ -9,7 +9,9 @@
 // private keys. DiskFallback is a provider that will attempt to
 // retrieve the certificate from a CA first, falling back to a
 // disk-backed pair. This is useful for test a CA while providing a
-// failover solution.
+// failover solution. The MemoryProvider keeps an ephemeral key in
+// memory only, and the SignerProvider uses a key held elsewhere, such
+// as in an HSM, through a crypto.Signer.
 package kp
 
 import (
@@ -91,6 +93,27 @@ type KeyProvider interface {
 	X509KeyPair() (tls.Certificate, error)
 }
 
+// New builds the key provider selected by the "provider" key of the
+// identity's "key" profile: "standard" (the default), "memory" or
+// "signer". The signer provider uses the signer registered with
+// RegisterSigner under the profile's "signer" key.
+func New(id *core.Identity) (KeyProvider, error) {
+	if id == nil {
+		return nil, errors.New("transport: the identity hasn't been initialised. Has it been loaded from disk?")
+	}
+
+	switch provider := id.Profiles["key"]["provider"]; provider {
+	case "", "standard":
+		return NewStandardProvider(id)
+	case "memory":
+		return NewMemoryProvider(id)
+	case "signer":
+		return newSignerProviderFromIdentity(id)
+	default:
+		return nil, errors.New("transport: unknown key provider " + provider)
+	}
+}
+
 // StandardPaths contains a path to a key file and certificate file.
 type StandardPaths struct {
 	KeyFile  string `json:"private_key"`
@@ -0,0 +1,164 @@
+package kp
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"strings"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+// keyPair holds a key and its certificate chain in memory. It
+// implements the parts of KeyProvider that don't depend on where the
+// key comes from.
+type keyPair struct {
+	priv  crypto.Signer
+	chain []*x509.Certificate
+}
+
+// Certificate returns the associated certificate, or nil if
+// one isn't ready.
+func (p *keyPair) Certificate() *x509.Certificate {
+	if len(p.chain) == 0 {
+		return nil
+	}
+	return p.chain[0]
+}
+
+// Check always returns nil; a key pair held in memory has no setup to
+// get wrong.
+func (p *keyPair) Check() error {
+	return nil
+}
+
+// Persistent always returns false.
+func (p *keyPair) Persistent() bool {
+	return false
+}
+
+// Ready returns true if the provider has a key and certificate.
+func (p *keyPair) Ready() bool {
+	return p.priv != nil && len(p.chain) > 0
+}
+
+// SetCertificatePEM receives a PEM-encoded certificate, optionally
+// followed by its intermediates, and loads it into the provider.
+func (p *keyPair) SetCertificatePEM(certPEM []byte) error {
+	chain, err := helpers.ParseCertificatesPEM(certPEM)
+	if err != nil || len(chain) == 0 {
+		return errors.New("transport: invalid certificate")
+	}
+
+	p.chain = chain
+	return nil
+}
+
+// SignalFailure is provided to implement the KeyProvider interface,
+// and always returns false.
+func (p *keyPair) SignalFailure(err error) bool {
+	return false
+}
+
+// SignCSR takes a template certificate request and signs it.
+func (p *keyPair) SignCSR(tpl *x509.CertificateRequest) ([]byte, error) {
+	if p.priv == nil {
+		return nil, errors.New("transport: provider has no key")
+	}
+	return x509.CreateCertificateRequest(rand.Reader, tpl, p.priv)
+}
+
+// Store does nothing: the key and certificate only live in memory.
+func (p *keyPair) Store() error {
+	return nil
+}
+
+// X509KeyPair returns a tls.Certificate for the provider. The private
+// key is the provider's crypto.Signer, so it is never serialised.
+func (p *keyPair) X509KeyPair() (tls.Certificate, error) {
+	if !p.Ready() {
+		return tls.Certificate{}, errors.New("transport: provider does not have a key and certificate")
+	}
+
+	cert := tls.Certificate{
+		PrivateKey: p.priv,
+		Leaf:       p.chain[0],
+	}
+	for _, c := range p.chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
+
+// MemoryProvider keeps an ephemeral key and certificate in memory. The
+// key is never written to disk or encoded, and a new one is generated
+// whenever the process starts. It is meant for short-lived workloads.
+type MemoryProvider struct {
+	keyPair
+}
+
+// NewMemoryProvider returns an empty MemoryProvider. The identity must
+// not set key and certificate paths.
+func NewMemoryProvider(id *core.Identity) (*MemoryProvider, error) {
+	if id == nil {
+		return nil, errors.New("transport: the identity hasn't been initialised. Has it been loaded from disk?")
+	}
+
+	if id.Profiles["paths"] != nil {
+		return nil, errors.New("transport: the memory key provider can't store a key and certificate on disk")
+	}
+	return &MemoryProvider{}, nil
+}
+
+// Generate generates a new private key, discarding the current key
+// and certificate.
+func (mp *MemoryProvider) Generate(algo string, size int) error {
+	mp.priv = nil
+	mp.chain = nil
+
+	kr := &csr.BasicKeyRequest{A: strings.ToLower(algo), S: size}
+	priv, err := kr.Generate()
+	if err != nil {
+		return errors.New("transport: " + err.Error())
+	}
+
+	mp.priv = priv.(crypto.Signer)
+	return nil
+}
+
+// CertificateRequest takes some metadata about a certificate request,
+// and attempts to produce a certificate signing request suitable for
+// sending to a certificate authority. A key is generated if there
+// isn't one yet.
+func (mp *MemoryProvider) CertificateRequest(req *csr.CertificateRequest) ([]byte, error) {
+	if mp.priv == nil {
+		if req.KeyRequest == nil {
+			return nil, errors.New("transport: invalid key request in csr.CertificateRequest")
+		}
+
+		if err := mp.Generate(req.KeyRequest.Algo(), req.KeyRequest.Size()); err != nil {
+			return nil, err
+		}
+	}
+	return csr.Generate(mp.priv, req)
+}
+
+var errNoMemoryKey = errors.New("transport: memory key provider has no key")
+
+// Load has nothing to read. It returns ErrCertificateUnavailable if a
+// key has been generated but not yet certified, and an error if there
+// is no key, so that the caller generates one.
+func (mp *MemoryProvider) Load() error {
+	switch {
+	case mp.priv == nil:
+		return errNoMemoryKey
+	case len(mp.chain) == 0:
+		return ErrCertificateUnavailable
+	default:
+		return nil
+	}
+}
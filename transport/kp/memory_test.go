@@ -0,0 +1,157 @@
+package kp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/transport/ca/localca"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+// certify runs a provider through what a transport does on its first
+// refresh: load, generate if needed, request and set a certificate.
+func certify(t *testing.T, p KeyProvider) {
+	lca, err := localca.New(localca.ExampleRequest(), localca.ExampleSigningConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = p.Load(); err != nil && err != ErrCertificateUnavailable {
+		if err = p.Generate("ecdsa", 256); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := p.CertificateRequest(&csr.CertificateRequest{
+		CN:         "in-memory test certificate",
+		KeyRequest: csr.NewBasicKeyRequest(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := lca.SignCSR(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.SetCertificatePEM(cert); err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Ready() {
+		t.Fatal("provider should be ready")
+	}
+	if err = p.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Persistent() {
+		t.Fatal("provider shouldn't be persistent")
+	}
+
+	pair, err := p.X509KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Leaf != p.Certificate() || len(pair.Certificate) == 0 {
+		t.Fatal("key pair doesn't hold the provider's certificate")
+	}
+}
+
+func TestMemoryProvider(t *testing.T) {
+	p, err := NewMemoryProvider(&core.Identity{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Ready() {
+		t.Fatal("provider shouldn't be ready before a key is generated")
+	}
+	if err = p.Load(); err == nil || err == ErrCertificateUnavailable {
+		t.Fatalf("expected Load without a key to ask for a new key, have %v", err)
+	}
+
+	certify(t, p)
+
+	if err = p.Generate("rsa", 1024); err == nil {
+		t.Fatal("expected a weak RSA key to be rejected")
+	}
+	if p.Ready() {
+		t.Fatal("generating a key should discard the certificate")
+	}
+
+	if _, err = NewMemoryProvider(testIdentity); err == nil {
+		t.Fatal("expected an identity with paths to be rejected")
+	}
+}
+
+func TestSignerProvider(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewSignerProvider(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Load(); err != ErrCertificateUnavailable {
+		t.Fatalf("expected %v, have %v", ErrCertificateUnavailable, err)
+	}
+	if err = p.Generate("ecdsa", 256); err != ErrExternalKey {
+		t.Fatalf("expected %v, have %v", ErrExternalKey, err)
+	}
+
+	certify(t, p)
+
+	pair, err := p.X509KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.PrivateKey != priv {
+		t.Fatal("key pair doesn't use the external signer")
+	}
+}
+
+func TestNew(t *testing.T) {
+	key := func(profile map[string]string) *core.Identity {
+		return &core.Identity{Profiles: map[string]map[string]string{"key": profile}}
+	}
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterSigner("test", priv)
+	defer UnregisterSigner("test")
+
+	var tests = []struct {
+		id *core.Identity
+		ok bool
+	}{
+		{testIdentity, true},
+		{key(map[string]string{"provider": "standard"}), true},
+		{key(map[string]string{"provider": "memory"}), true},
+		{key(map[string]string{"provider": "signer", "signer": "test"}), true},
+		{key(map[string]string{"provider": "signer", "signer": "missing"}), false},
+		{key(map[string]string{"provider": "signer"}), false},
+		{key(map[string]string{"provider": "pkcs11"}), false},
+		{nil, false},
+	}
+
+	for i, test := range tests {
+		_, err := New(test.id)
+		if test.ok && err != nil {
+			t.Errorf("%d: %v", i, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+	}
+
+	if p, _ := New(key(map[string]string{"provider": "memory"})); p == nil {
+		t.Fatal("expected a memory provider")
+	} else if _, ok := p.(*MemoryProvider); !ok {
+		t.Fatalf("expected a memory provider, have %T", p)
+	}
+}
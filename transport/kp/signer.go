@@ -0,0 +1,98 @@
+package kp
+
+import (
+	"crypto"
+	"errors"
+	"sync"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+// signers maps names to keys held outside the process, such as in an
+// HSM or behind an agent socket.
+var signers = struct {
+	sync.RWMutex
+	m map[string]crypto.Signer
+}{m: map[string]crypto.Signer{}}
+
+// RegisterSigner makes s available under name to identities that
+// select the "signer" key provider. Programs register their signers
+// before building transports with such identities. A signer already
+// registered under name is replaced.
+func RegisterSigner(name string, s crypto.Signer) {
+	signers.Lock()
+	defer signers.Unlock()
+	signers.m[name] = s
+}
+
+// UnregisterSigner removes the signer registered under name.
+func UnregisterSigner(name string) {
+	signers.Lock()
+	defer signers.Unlock()
+	delete(signers.m, name)
+}
+
+func lookupSigner(name string) (crypto.Signer, bool) {
+	signers.RLock()
+	defer signers.RUnlock()
+	s, ok := signers.m[name]
+	return s, ok
+}
+
+// SignerProvider uses an existing crypto.Signer for CSRs and TLS. The
+// key is managed elsewhere, so it can't be generated or replaced by
+// the provider; only the certificate is kept, in memory.
+type SignerProvider struct {
+	keyPair
+}
+
+// NewSignerProvider returns a provider for the key s.
+func NewSignerProvider(s crypto.Signer) (*SignerProvider, error) {
+	if s == nil {
+		return nil, errors.New("transport: the signer key provider requires a signer")
+	}
+
+	sp := &SignerProvider{}
+	sp.priv = s
+	return sp, nil
+}
+
+// newSignerProviderFromIdentity looks up the signer named in the
+// identity's key profile.
+func newSignerProviderFromIdentity(id *core.Identity) (*SignerProvider, error) {
+	name := id.Profiles["key"]["signer"]
+	if name == "" {
+		return nil, errors.New("transport: the signer key provider requires a signer name")
+	}
+
+	s, ok := lookupSigner(name)
+	if !ok {
+		return nil, errors.New("transport: no signer named " + name)
+	}
+	return NewSignerProvider(s)
+}
+
+// ErrExternalKey is returned when a SignerProvider is asked to
+// generate a key.
+var ErrExternalKey = errors.New("transport: keys of the signer key provider are managed externally")
+
+// Generate always fails, since the key is managed externally.
+func (sp *SignerProvider) Generate(algo string, size int) error {
+	return ErrExternalKey
+}
+
+// CertificateRequest produces a certificate signing request signed by
+// the external key. The request's key request is ignored.
+func (sp *SignerProvider) CertificateRequest(req *csr.CertificateRequest) ([]byte, error) {
+	return csr.Generate(sp.priv, req)
+}
+
+// Load returns ErrCertificateUnavailable until a certificate has been
+// set.
+func (sp *SignerProvider) Load() error {
+	if len(sp.chain) == 0 {
+		return ErrCertificateUnavailable
+	}
+	return nil
+}
@@ -53,8 +53,10 @@ func pollWait(target time.Time) {
 // AutoUpdate will automatically update the listener. If a non-nil
 // certUpdates chan is provided, it will receive timestamps for
 // reissued certificates. If errChan is non-nil, any errors that occur
-// in the updater will be passed along.
+// in the updater will be passed along, as will pin mismatches seen
+// during handshakes.
 func (l *Listener) AutoUpdate(certUpdates chan<- time.Time, errChan chan<- error) {
+	l.setErrChan(errChan)
 	defer func() {
 		if r := recover(); r != nil {
 			log.Criticalf("AutoUpdate panicked: %v", r)
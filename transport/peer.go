@@ -0,0 +1,121 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/url"
+	"path"
+
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+// ErrPeerNotAuthorized is returned when a peer's certificate is
+// trusted but matches none of the identity's peer rules.
+var ErrPeerNotAuthorized = errors.New("transport: peer isn't authorized by any peer rule")
+
+// checkPeerRules makes sure every pattern in the rules is well-formed.
+func checkPeerRules(rules []*core.PeerRule) error {
+	for _, rule := range rules {
+		if rule == nil {
+			return errors.New("transport: empty peer rule")
+		}
+
+		for _, patterns := range [][]string{rule.CommonName, rule.Organization, rule.OrganizationalUnit, rule.DNSNames, rule.URIs, rule.Issuer} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return errors.New("transport: invalid peer rule pattern " + pattern)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether any of the patterns matches any of the
+// values. An empty list of patterns matches anything.
+func matchAny(patterns, values []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchRule(rule *core.PeerRule, cert *x509.Certificate) bool {
+	certURIs := peerURIs(cert)
+	uris := make([]string, len(certURIs))
+	for i, uri := range certURIs {
+		uris[i] = uri.String()
+	}
+
+	return matchAny(rule.CommonName, []string{cert.Subject.CommonName}) &&
+		matchAny(rule.Organization, cert.Subject.Organization) &&
+		matchAny(rule.OrganizationalUnit, cert.Subject.OrganizationalUnit) &&
+		matchAny(rule.DNSNames, cert.DNSNames) &&
+		matchAny(rule.URIs, uris) &&
+		matchAny(rule.Issuer, []string{cert.Issuer.CommonName})
+}
+
+// authorize checks the peer's leaf certificate against the rules. With
+// no rules, every trusted peer is authorized.
+func authorize(rules []*core.PeerRule, cert *x509.Certificate) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if matchRule(rule, cert) {
+			return nil
+		}
+	}
+	return ErrPeerNotAuthorized
+}
+
+// A PeerIdentity describes the verified certificate of the other end
+// of a connection.
+type PeerIdentity struct {
+	Subject     pkix.Name
+	Issuer      pkix.Name
+	DNSNames    []string
+	URIs        []*url.URL
+	Certificate *x509.Certificate
+}
+
+// Peer returns the identity of the other end of a connection accepted
+// by a Listener or returned by Dial. It completes the handshake if it
+// hasn't happened yet, so an error is returned if the peer isn't
+// trusted or authorized.
+func Peer(conn net.Conn) (*PeerIdentity, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, errors.New("transport: connection doesn't use TLS")
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("transport: peer didn't present a certificate")
+	}
+
+	cert := state.PeerCertificates[0]
+	return &PeerIdentity{
+		Subject:     cert.Subject,
+		Issuer:      cert.Issuer,
+		DNSNames:    cert.DNSNames,
+		URIs:        peerURIs(cert),
+		Certificate: cert,
+	}, nil
+}
@@ -0,0 +1,234 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/transport/ca/localca"
+	"github.com/cloudflare/cfssl/transport/core"
+	"github.com/cloudflare/cfssl/transport/kp"
+	"github.com/cloudflare/cfssl/transport/roots"
+)
+
+// newPeerCertificate returns a certificate for a billing API, whose
+// subject alternative names are set through the extension so that the
+// URI is encoded by every Go version.
+func newPeerCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	san, err := asn1.Marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("api.billing.example.net")},
+		{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("spiffe://example.net/billing/api")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName:         "api",
+			Organization:       []string{"Example"},
+			OrganizationalUnit: []string{"billing"},
+		},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}, Value: san}},
+	}
+	issuer := &x509.Certificate{Subject: pkix.Name{CommonName: "Example Services CA"}}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestAuthorize(t *testing.T) {
+	cert := newPeerCertificate(t)
+	if uris := peerURIs(cert); len(uris) != 1 || uris[0].String() != "spiffe://example.net/billing/api" {
+		t.Fatalf("unexpected URIs %v", uris)
+	}
+
+	var tests = []struct {
+		rules []*core.PeerRule
+		ok    bool
+	}{
+		{nil, true},
+		{[]*core.PeerRule{{}}, true},
+		{[]*core.PeerRule{{OrganizationalUnit: []string{"billing"}}}, true},
+		{[]*core.PeerRule{{OrganizationalUnit: []string{"web"}}}, false},
+		{[]*core.PeerRule{{OrganizationalUnit: []string{"web"}}, {CommonName: []string{"api"}}}, true},
+		{[]*core.PeerRule{{OrganizationalUnit: []string{"billing"}, CommonName: []string{"web"}}}, false},
+		{[]*core.PeerRule{{DNSNames: []string{"*.billing.example.net"}}}, true},
+		{[]*core.PeerRule{{DNSNames: []string{"*.web.example.net"}}}, false},
+		{[]*core.PeerRule{{URIs: []string{"spiffe://example.net/billing/*"}}}, true},
+		{[]*core.PeerRule{{URIs: []string{"spiffe://example.net/web/*"}}}, false},
+		{[]*core.PeerRule{{Issuer: []string{"Example * CA"}}}, true},
+		{[]*core.PeerRule{{Issuer: []string{"Other CA"}}}, false},
+		{[]*core.PeerRule{{Organization: []string{"Example", "Other"}}}, true},
+	}
+
+	for i, test := range tests {
+		err := authorize(test.rules, cert)
+		if test.ok && err != nil {
+			t.Errorf("%d: expected peer to be authorized, have %v", i, err)
+		} else if !test.ok && err != ErrPeerNotAuthorized {
+			t.Errorf("%d: expected peer to be refused, have %v", i, err)
+		}
+	}
+}
+
+func TestCheckPeerRules(t *testing.T) {
+	if err := checkPeerRules([]*core.PeerRule{{DNSNames: []string{"*.example.net"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPeerRules([]*core.PeerRule{{CommonName: []string{"["}}}); err == nil {
+		t.Fatal("expected a malformed pattern to be rejected")
+	}
+	if err := checkPeerRules([]*core.PeerRule{nil}); err == nil {
+		t.Fatal("expected a nil rule to be rejected")
+	}
+}
+
+// localTransport returns a transport with a certificate for the given
+// organizational unit, issued by lca and trusting lca for both servers
+// and clients.
+func localTransport(t *testing.T, lca *localca.CA, dir, ou string, peers []*core.PeerRule) *Transport {
+	caPEM, err := lca.CACertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "ca.pem")
+	if err = ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	caRoots := []*core.Root{{Type: "file", Metadata: map[string]string{"source": caFile}}}
+	id := &core.Identity{
+		Request: &csr.CertificateRequest{
+			CN:         ou + " test certificate",
+			Names:      []csr.Name{{OU: ou}},
+			Hosts:      []string{"127.0.0.1"},
+			KeyRequest: csr.NewBasicKeyRequest(),
+		},
+		Roots:       caRoots,
+		ClientRoots: caRoots,
+		Profiles: map[string]map[string]string{
+			"paths": {
+				"private_key": filepath.Join(dir, ou+"-key.pem"),
+				"certificate": filepath.Join(dir, ou+".pem"),
+			},
+		},
+	}
+
+	provider, err := kp.NewStandardProvider(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := roots.New(caRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := &Transport{
+		Before:           time.Minute,
+		Provider:         provider,
+		CA:               lca,
+		TrustStore:       store,
+		ClientTrustStore: store,
+		Identity:         id,
+		Backoff:          &core.Backoff{},
+		RevokeSoftFail:   true,
+		Peers:            peers,
+	}
+	if err = tr.RefreshKeys(); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestPeerRulesHandshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport-peer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lca, err := localca.New(localca.ExampleRequest(), localca.ExampleSigningConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := localTransport(t, lca, dir, "server", []*core.PeerRule{
+		{OrganizationalUnit: []string{"billing"}},
+	})
+	l, err := Listen("127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	type result struct {
+		peer *PeerIdentity
+		err  error
+	}
+	results := make(chan result)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			peer, err := Peer(conn)
+			results <- result{peer, err}
+			conn.Close()
+		}
+	}()
+
+	billing := localTransport(t, lca, dir, "billing", nil)
+	conn, err := Dial(l.Addr().String(), billing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := <-results
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if ou := res.peer.Subject.OrganizationalUnit; len(ou) != 1 || ou[0] != "billing" {
+		t.Fatalf("expected the billing peer, have %v", ou)
+	}
+
+	peer, err := Peer(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peer.Subject.CommonName != "server test certificate" {
+		t.Fatalf("expected the server's identity, have %s", peer.Subject.CommonName)
+	}
+	conn.Close()
+
+	web := localTransport(t, lca, dir, "web", nil)
+	if conn, err = Dial(l.Addr().String(), web); err == nil {
+		conn.Close()
+	}
+	if res = <-results; res.err == nil {
+		t.Fatal("expected the web peer to be refused")
+	}
+}
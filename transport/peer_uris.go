@@ -0,0 +1,13 @@
+// +build go1.10
+
+package transport
+
+import (
+	"crypto/x509"
+	"net/url"
+)
+
+// peerURIs returns the URI subject alternative names of cert.
+func peerURIs(cert *x509.Certificate) []*url.URL {
+	return cert.URIs
+}
@@ -0,0 +1,43 @@
+// +build !go1.10
+
+package transport
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"net/url"
+)
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// peerURIs returns the URI subject alternative names of cert. Before Go
+// 1.10, crypto/x509 doesn't parse them, so they are read from the
+// extension; malformed names are skipped.
+func peerURIs(cert *x509.Certificate) []*url.URL {
+	var uris []*url.URL
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+
+		var seq asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &seq); err != nil || len(rest) != 0 {
+			return nil
+		}
+		for rest := seq.Bytes; len(rest) > 0; {
+			var name asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+				return uris
+			}
+			// uniformResourceIdentifier [6] IA5String
+			if name.Class != asn1.ClassContextSpecific || name.Tag != 6 {
+				continue
+			}
+			if uri, err := url.Parse(string(name.Bytes)); err == nil {
+				uris = append(uris, uri)
+			}
+		}
+	}
+	return uris
+}
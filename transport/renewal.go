@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"crypto/x509"
+	"errors"
+	mrand "math/rand"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	"github.com/cloudflare/cfssl/transport/ca"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+// checkRenewal makes sure the renewal fractions are within the
+// certificate's lifetime.
+func checkRenewal(r *core.Renewal) error {
+	if r.Window < 0 || r.Window >= 1 {
+		return errors.New("transport: renewal window must be between 0 and 1")
+	}
+	if r.Jitter < 0 || r.Jitter >= 1 {
+		return errors.New("transport: renewal jitter must be between 0 and 1")
+	}
+	if r.Window > 0 && r.Jitter >= r.Window {
+		return errors.New("transport: renewal jitter must be less than the renewal window")
+	}
+	return nil
+}
+
+// window returns the renewal window in use: the transport's own, or
+// else the CA's suggestion. Zero means Before is used.
+func (tr *Transport) window() float64 {
+	if tr.RenewalWindow > 0 {
+		return tr.RenewalWindow
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.caWindow
+}
+
+// askCA fetches the CA's suggested renewal window, if the transport
+// doesn't set its own and the CA can make a suggestion. Unless again
+// is true, the CA is only asked once.
+func (tr *Transport) askCA(again bool) {
+	advisor, ok := tr.CA.(ca.RenewalAdvisor)
+	if !ok || tr.RenewalWindow > 0 {
+		return
+	}
+
+	tr.mu.Lock()
+	asked := tr.caAsked
+	tr.mu.Unlock()
+	if asked && !again {
+		return
+	}
+
+	window, err := advisor.RenewalWindow()
+	if err != nil {
+		log.Debugf("couldn't get the CA's renewal window: %v", err)
+		return
+	}
+	if window < 0 || window >= 1 {
+		log.Warningf("ignoring invalid renewal window %v from the CA", window)
+		window = 0
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.caAsked = true
+	if window != tr.caWindow {
+		tr.caWindow = window
+		tr.renewCert = nil
+	}
+}
+
+// renewalTime returns when cert should be renewed. The time is chosen
+// once per certificate, so that the jitter doesn't change between
+// calls.
+func (tr *Transport) renewalTime(cert *x509.Certificate) time.Time {
+	window := tr.window()
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.renewCert == cert {
+		return tr.renewAfter
+	}
+
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	renewAfter := cert.NotAfter.Add(-tr.Before)
+	if window > 0 {
+		renewAfter = cert.NotBefore.Add(time.Duration(float64(lifetime) * window))
+	}
+
+	// The jitter can't bring renewal forward to before the certificate
+	// was issued, which a CA's window or Before may leave it larger
+	// than; every new certificate would be due at once.
+	jitter := time.Duration(float64(lifetime) * tr.RenewalJitter)
+	if untilRenewal := renewAfter.Sub(cert.NotBefore); jitter > untilRenewal {
+		jitter = untilRenewal
+	}
+	if jitter > 0 {
+		renewAfter = renewAfter.Add(-time.Duration(mrand.Int63n(int64(jitter))))
+	}
+
+	tr.renewCert = cert
+	tr.renewAfter = renewAfter
+	return renewAfter
+}
+
+// renewalDue reports whether RefreshKeys should request a new
+// certificate, given the certificate's lifespan. Without a renewal
+// window, the certificate is renewed once less than Before remains
+// before its renewal time.
+func (tr *Transport) renewalDue(lifespan time.Duration) bool {
+	if tr.window() > 0 {
+		return lifespan == 0
+	}
+	return lifespan < tr.Before
+}
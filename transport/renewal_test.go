@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/transport/ca/localca"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+func TestCheckRenewal(t *testing.T) {
+	if err := checkRenewal(&core.Renewal{Window: 0.7, Jitter: 0.1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []*core.Renewal{{Window: -0.1}, {Window: 1}, {Jitter: -0.1}, {Jitter: 1}, {Window: 0.05, Jitter: 0.5}} {
+		if err := checkRenewal(r); err == nil {
+			t.Fatalf("expected %+v to be rejected", *r)
+		}
+	}
+}
+
+func TestRenewalTime(t *testing.T) {
+	notBefore := time.Now().Truncate(time.Second)
+	cert := &x509.Certificate{NotBefore: notBefore, NotAfter: notBefore.Add(100 * time.Hour)}
+
+	tr := &Transport{Before: time.Hour}
+	if at := tr.renewalTime(cert); !at.Equal(cert.NotAfter.Add(-time.Hour)) {
+		t.Fatalf("expected renewal an hour before expiry, have %s", at)
+	}
+
+	tr = &Transport{Before: time.Hour, RenewalWindow: 0.5}
+	if at := tr.renewalTime(cert); !at.Equal(notBefore.Add(50 * time.Hour)) {
+		t.Fatalf("expected renewal half way through the lifetime, have %s", at)
+	}
+
+	tr = &Transport{RenewalWindow: 0.5, RenewalJitter: 0.1}
+	at := tr.renewalTime(cert)
+	if at.After(notBefore.Add(50*time.Hour)) || at.Before(notBefore.Add(40*time.Hour)) {
+		t.Fatalf("expected renewal between 40 and 50 hours in, have %s", at.Sub(notBefore))
+	}
+	if again := tr.renewalTime(cert); !again.Equal(at) {
+		t.Fatal("renewal time changed between calls")
+	}
+
+	other := &x509.Certificate{NotBefore: cert.NotBefore, NotAfter: cert.NotAfter}
+	times := map[time.Time]bool{}
+	for i := 0; i < 10; i++ {
+		tr = &Transport{RenewalWindow: 0.5, RenewalJitter: 0.1}
+		times[tr.renewalTime(other)] = true
+	}
+	if len(times) == 1 {
+		t.Fatal("jitter didn't spread the renewal times")
+	}
+
+	// Jitter larger than a CA's window or the time until Before
+	// doesn't bring renewal forward past issuance.
+	for _, tr := range []*Transport{
+		{caWindow: 0.05, RenewalJitter: 0.5},
+		{Before: 98 * time.Hour, RenewalJitter: 0.5},
+	} {
+		for i := 0; i < 20; i++ {
+			tr.renewCert = nil
+			if at := tr.renewalTime(cert); !at.After(notBefore) {
+				t.Fatalf("expected renewal after issuance, have %s", at.Sub(notBefore))
+			}
+		}
+	}
+}
+
+func TestCARenewalWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport-renewal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy := localca.ExampleSigningConfig()
+	policy.Default.RenewalWindow = 0.5
+	lca, err := localca.New(localca.ExampleRequest(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := localTransport(t, lca, dir, "renewal", nil)
+	cert := tr.Provider.Certificate()
+	half := cert.NotAfter.Sub(cert.NotBefore) / 2
+	expected := time.Until(cert.NotBefore.Add(half))
+	if ls := tr.Lifespan(); ls > expected || ls < expected-time.Minute {
+		t.Fatalf("expected renewal half way through the lifetime, have lifespan %s", ls)
+	}
+	if tr.renewalDue(tr.Lifespan()) {
+		t.Fatal("renewal shouldn't be due yet")
+	}
+
+	// The transport's own window takes precedence.
+	tr.RenewalWindow = 0.9
+	tr.renewCert = nil
+	if ls := tr.Lifespan(); ls < expected+half/2 {
+		t.Fatalf("expected the transport's window to be used, have lifespan %s", ls)
+	}
+}
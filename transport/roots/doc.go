@@ -12,4 +12,14 @@
 // The "file" provider takes a source file (specified under the
 // "source" key) that contains one or more certificates and adds
 // them into the source tree.
+//
+// The "pin" type trusts keys rather than whole roots: a peer is
+// trusted if its chain leads up to a certificate whose SubjectPublicKeyInfo
+// hash is pinned. It takes a comma-separated list of "sha256/<base64>"
+// hashes under the "spki" key, a "source" file of certificates (for
+// example a specific intermediate) whose keys are pinned, or both.
+//
+// A TrustStore can be refreshed from its sources with Refresh or
+// AutoRefresh, so that long-running programs pick up added or rotated
+// roots.
 package roots
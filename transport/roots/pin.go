@@ -0,0 +1,122 @@
+package roots
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrPinMismatch is returned when a peer's chain contains none of the
+// pinned keys.
+var ErrPinMismatch = errors.New("transport: peer certificate chain doesn't match a pinned key")
+
+// pinPrefix is the only supported pin hash, written as in RFC 7469.
+const pinPrefix = "sha256/"
+
+// Pins is a set of SPKI hashes.
+type Pins map[string]bool
+
+// SPKIPin returns the pin of the certificate's public key, in the form
+// "sha256/<base64 digest>".
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// ParsePins checks and collects pins of the form "sha256/<base64
+// digest>".
+func ParsePins(pins []string) (Pins, error) {
+	set := Pins{}
+	for _, pin := range pins {
+		pin = strings.TrimSpace(pin)
+		if !strings.HasPrefix(pin, pinPrefix) {
+			return nil, errors.New("transport: pin " + pin + " must start with " + pinPrefix)
+		}
+
+		digest, err := base64.StdEncoding.DecodeString(pin[len(pinPrefix):])
+		if err != nil || len(digest) != sha256.Size {
+			return nil, errors.New("transport: pin " + pin + " isn't a base64 SHA-256 digest")
+		}
+		set[pin] = true
+	}
+	return set, nil
+}
+
+// Match reports whether any certificate in the chain has a pinned key.
+func (p Pins) Match(chain []*x509.Certificate) bool {
+	for _, cert := range chain {
+		if p[SPKIPin(cert)] {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustPins loads the pins of a "pin" root. The "spki" key holds a
+// comma-separated list of pins; the "source" key names a file of
+// certificates, such as a specific intermediate, whose keys are
+// pinned. Either or both may be given.
+func TrustPins(metadata map[string]string) (Pins, error) {
+	var pins []string
+	if spki := metadata["spki"]; spki != "" {
+		pins = strings.Split(spki, ",")
+	}
+
+	set, err := ParsePins(pins)
+	if err != nil {
+		return nil, err
+	}
+
+	if metadata["source"] != "" {
+		certs, err := TrustPEM(metadata)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			set[SPKIPin(cert)] = true
+		}
+	}
+
+	if len(set) == 0 {
+		return nil, errors.New("transport: pin root requires an spki list or a source file")
+	}
+	return set, nil
+}
+
+// pinnedChain verifies the peer's certificates up to the first one with
+// a pinned key, which is trusted in place of a root: the leaf must be
+// valid for the host and usage, and every certificate above it, up to
+// and including the pinned one, must be a CA within its path length and
+// name constraints. It returns the chain up to the pinned certificate.
+func pinnedChain(certs []*x509.Certificate, pins Pins, host string, usage x509.ExtKeyUsage) ([]*x509.Certificate, bool) {
+	for i, cert := range certs {
+		if !pins[SPKIPin(cert)] {
+			continue
+		}
+		// Verify doesn't hold the anchor to being a CA.
+		if i > 0 && (!cert.BasicConstraintsValid || !cert.IsCA) {
+			return nil, false
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         x509.NewCertPool(),
+			DNSName:       host,
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		}
+		opts.Roots.AddCert(cert)
+		if i > 0 {
+			for _, inter := range certs[1:i] {
+				opts.Intermediates.AddCert(inter)
+			}
+		}
+		chains, err := certs[0].Verify(opts)
+		if err != nil {
+			return nil, false
+		}
+		return chains[0], true
+	}
+	return nil, false
+}
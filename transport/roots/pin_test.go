@@ -0,0 +1,218 @@
+package roots
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/helpers"
+	"github.com/cloudflare/cfssl/transport/ca/localca"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+// testChain returns a leaf certificate and the CA that issued it.
+func testChain(t *testing.T) (leaf, ca *x509.Certificate) {
+	lca, err := localca.New(localca.ExampleRequest(), localca.ExampleSigningConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPEM, err := lca.CACertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err = helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &csr.Generator{Validator: func(*csr.CertificateRequest) error { return nil }}
+	csrPEM, _, err := g.ProcessRequest(&csr.CertificateRequest{
+		CN:         "pinned leaf",
+		KeyRequest: csr.NewBasicKeyRequest(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafPEM, err := lca.SignCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err = helpers.ParseCertificatePEM(leafPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf, ca
+}
+
+func pinStore(t *testing.T, pins ...string) *TrustStore {
+	spki := ""
+	for i, pin := range pins {
+		if i > 0 {
+			spki += ","
+		}
+		spki += pin
+	}
+
+	store, err := New([]*core.Root{{Type: "pin", Metadata: map[string]string{"spki": spki}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestParsePins(t *testing.T) {
+	leaf, _ := testChain(t)
+	if _, err := ParsePins([]string{SPKIPin(leaf)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pin := range []string{"", "sha1/AAAA", "sha256/not base64", "sha256/AAAA"} {
+		if _, err := ParsePins([]string{pin}); err == nil {
+			t.Fatalf("expected pin %q to be rejected", pin)
+		}
+	}
+
+	if _, err := New([]*core.Root{{Type: "pin", Metadata: map[string]string{}}}); err == nil {
+		t.Fatal("expected a pin root without pins to be rejected")
+	}
+}
+
+func TestVerifyPinnedIntermediate(t *testing.T) {
+	leaf, ca := testChain(t)
+	store := pinStore(t, SPKIPin(ca))
+	if !store.Pinned() {
+		t.Fatal("store should report pinned keys")
+	}
+
+	chains, err := store.Verify([]*x509.Certificate{leaf, ca}, "", x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 2 {
+		t.Fatalf("expected one chain of two certificates, have %v", chains)
+	}
+
+	// Without the intermediate, the leaf can't be tied to the pin.
+	if _, err = store.Verify([]*x509.Certificate{leaf}, "", x509.ExtKeyUsageServerAuth); err != ErrPinMismatch {
+		t.Fatalf("expected a pin mismatch, have %v", err)
+	}
+
+	// A chain that claims the pinned issuer must be signed by it.
+	other, _ := testChain(t)
+	if _, err = store.Verify([]*x509.Certificate{other, ca}, "", x509.ExtKeyUsageServerAuth); err != ErrPinMismatch {
+		t.Fatalf("expected a pin mismatch, have %v", err)
+	}
+}
+
+func TestVerifyPinnedLeaf(t *testing.T) {
+	leaf, _ := testChain(t)
+	store := pinStore(t, SPKIPin(leaf))
+
+	if _, err := store.Verify([]*x509.Certificate{leaf}, "", x509.ExtKeyUsageClientAuth); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Verify([]*x509.Certificate{leaf}, "example.com", x509.ExtKeyUsageClientAuth); err != ErrPinMismatch {
+		t.Fatalf("expected a host mismatch to fail, have %v", err)
+	}
+}
+
+func TestPinsMatch(t *testing.T) {
+	leaf, ca := testChain(t)
+	pins, err := ParsePins([]string{SPKIPin(ca)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pins.Match([]*x509.Certificate{leaf, ca}) {
+		t.Fatal("chain with the pinned CA didn't match")
+	}
+	if pins.Match([]*x509.Certificate{leaf}) {
+		t.Fatal("chain without the pinned CA matched")
+	}
+}
+
+func TestVerifyPinnedConstraints(t *testing.T) {
+	// The leaf must be usable for what it is verified for.
+	policy := localca.ExampleSigningConfig()
+	policy.Default.Usage = []string{"client auth", "signing", "key encipherment"}
+	lca, err := localca.New(localca.ExampleRequest(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := lca.CACertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := helpers.ParseCertificatePEM(caPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM, _, err := (&csr.Generator{Validator: func(*csr.CertificateRequest) error { return nil }}).ProcessRequest(
+		&csr.CertificateRequest{CN: "client", KeyRequest: csr.NewBasicKeyRequest()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPEM, err := lca.SignCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := helpers.ParseCertificatePEM(leafPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := pinStore(t, SPKIPin(ca))
+	if _, err = store.Verify([]*x509.Certificate{leaf, ca}, "", x509.ExtKeyUsageClientAuth); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Verify([]*x509.Certificate{leaf, ca}, "", x509.ExtKeyUsageServerAuth); err != ErrPinMismatch {
+		t.Fatalf("expected a client certificate to fail server auth, have %v", err)
+	}
+
+	// Certificates above the leaf must be CAs.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "not a CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notCA, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(2)
+	template.Subject.CommonName = "issued by a non-CA"
+	if der, err = x509.CreateCertificate(rand.Reader, template, notCA, &leafKey.PublicKey, key); err != nil {
+		t.Fatal(err)
+	}
+	issued, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = pinStore(t, SPKIPin(notCA))
+	if _, err = store.Verify([]*x509.Certificate{issued, notCA}, "", x509.ExtKeyUsageServerAuth); err != ErrPinMismatch {
+		t.Fatalf("expected a chain through a non-CA to fail, have %v", err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/x509"
 	"errors"
 	"io/ioutil"
+	"sync"
+	"time"
 
 	"github.com/cloudflare/cfssl/helpers"
 	"github.com/cloudflare/cfssl/transport/core"
@@ -20,23 +22,43 @@ var Providers = map[string]func(map[string]string) ([]*x509.Certificate, error){
 }
 
 // A TrustStore contains a pool of certificate that are trusted for a
-// given TLS configuration.
+// given TLS configuration. A TrustStore built by New can be refreshed
+// from its root definitions while it is in use.
 type TrustStore struct {
+	mu    sync.RWMutex
+	defs  []*core.Root
 	roots map[string]*x509.Certificate
+	pins  Pins
+	pool  *x509.CertPool
 }
 
 // Pool returns a certificate pool containing the certificates
-// loaded into the provider.
+// loaded into the provider. The pool reflects the roots as of the
+// last refresh and must not be modified.
 func (ts *TrustStore) Pool() *x509.CertPool {
-	var pool = x509.NewCertPool()
-	for _, cert := range ts.roots {
-		pool.AddCert(cert)
+	ts.mu.RLock()
+	pool := ts.pool
+	ts.mu.RUnlock()
+	if pool != nil {
+		return pool
 	}
-	return pool
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.pool == nil {
+		ts.pool = x509.NewCertPool()
+		for _, cert := range ts.roots {
+			ts.pool.AddCert(cert)
+		}
+	}
+	return ts.pool
 }
 
 // Certificates returns a slice of the loaded certificates.
 func (ts *TrustStore) Certificates() []*x509.Certificate {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
 	var roots = make([]*x509.Certificate, 0, len(ts.roots))
 	for _, cert := range ts.roots {
 		roots = append(roots, cert)
@@ -53,6 +75,151 @@ func (ts *TrustStore) addCerts(certs []*x509.Certificate) {
 		digest := sha256.Sum256(cert.Raw)
 		ts.roots[string(digest[:])] = cert
 	}
+	ts.pool = nil
+}
+
+func (ts *TrustStore) addPins(pins Pins) {
+	if ts.pins == nil {
+		ts.pins = Pins{}
+	}
+
+	for pin := range pins {
+		ts.pins[pin] = true
+	}
+}
+
+// Refresh reloads the roots from the store's definitions. It reports
+// whether the set of roots changed. If any provider fails, the current
+// roots are kept.
+func (ts *TrustStore) Refresh() (bool, error) {
+	ts.mu.RLock()
+	defs := ts.defs
+	ts.mu.RUnlock()
+	if len(defs) == 0 {
+		return false, nil
+	}
+
+	fresh, err := load(defs)
+	if err != nil {
+		return false, err
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if sameRoots(ts.roots, fresh.roots) && samePins(ts.pins, fresh.pins) {
+		return false, nil
+	}
+	ts.roots = fresh.roots
+	ts.pins = fresh.pins
+	ts.pool = nil
+	return true, nil
+}
+
+func samePins(a, b Pins) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for pin := range a {
+		if !b[pin] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameRoots(a, b map[string]*x509.Certificate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for digest := range a {
+		if _, ok := b[digest]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// AutoRefresh refreshes the store at the given interval until stop is
+// closed. If a non-nil changes chan is provided, it will receive a
+// timestamp each time the roots change. If errChan is non-nil, refresh
+// errors are passed along.
+func (ts *TrustStore) AutoRefresh(interval time.Duration, stop <-chan struct{}, changes chan<- time.Time, errChan chan<- error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		changed, err := ts.Refresh()
+		if err != nil {
+			if errChan != nil {
+				select {
+				case errChan <- err:
+				case <-stop:
+					return
+				}
+			}
+			continue
+		}
+
+		if changed && changes != nil {
+			select {
+			case changes <- time.Now():
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+// Pinned reports whether the store contains pinned keys.
+func (ts *TrustStore) Pinned() bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return len(ts.pins) > 0
+}
+
+// Verify checks a peer's certificates, leaf first, for the given host
+// and key usage. The chain is trusted if it verifies against the
+// store's roots, or if it leads up to a pinned key. If host is empty,
+// the host name isn't checked. It returns the verified chains; a chain
+// that matched none of the store's pins fails with ErrPinMismatch.
+func (ts *TrustStore) Verify(certs []*x509.Certificate, host string, usage x509.ExtKeyUsage) ([][]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("transport: peer presented no certificates")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         ts.Pool(),
+		DNSName:       host,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	chains, err := certs[0].Verify(opts)
+	if err == nil {
+		return chains, nil
+	}
+
+	ts.mu.RLock()
+	pins := ts.pins
+	ts.mu.RUnlock()
+	if len(pins) == 0 {
+		return nil, err
+	}
+
+	chain, ok := pinnedChain(certs, pins, host, usage)
+	if !ok {
+		return nil, ErrPinMismatch
+	}
+	return [][]*x509.Certificate{chain}, nil
 }
 
 // Trusted contains a store of trusted certificates.
@@ -72,6 +239,15 @@ type Trusted interface {
 // New produces a new trusted root provider from a collection of
 // roots. If there are no roots, the system roots will be used.
 func New(rootDefs []*core.Root) (*TrustStore, error) {
+	store, err := load(rootDefs)
+	if err != nil {
+		return nil, err
+	}
+	store.defs = rootDefs
+	return store, nil
+}
+
+func load(rootDefs []*core.Root) (*TrustStore, error) {
 	var err error
 
 	var store = &TrustStore{}
@@ -89,6 +265,17 @@ func New(rootDefs []*core.Root) (*TrustStore, error) {
 
 	err = errors.New("transport: no supported root providers found")
 	for _, root := range rootDefs {
+		if root.Type == "pin" {
+			var pins Pins
+			pins, err = TrustPins(root.Metadata)
+			if err != nil {
+				break
+			}
+
+			store.addPins(pins)
+			continue
+		}
+
 		pfn, ok := Providers[root.Type]
 		if ok {
 			roots, err = pfn(root.Metadata)
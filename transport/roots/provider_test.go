@@ -0,0 +1,125 @@
+package roots
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+const (
+	testCert   = "../../testdata/server.crt"
+	testBundle = "../../testdata/gd_bundle.crt"
+)
+
+func copyFile(t *testing.T, src, dst string) {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fileStore(t *testing.T) (*TrustStore, string, func()) {
+	dir, err := ioutil.TempDir("", "roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := filepath.Join(dir, "roots.pem")
+	copyFile(t, testCert, source)
+
+	store, err := New([]*core.Root{{
+		Type:     "file",
+		Metadata: map[string]string{"source": source},
+	}})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, source, func() { os.RemoveAll(dir) }
+}
+
+func TestRefresh(t *testing.T) {
+	store, source, cleanup := fileStore(t)
+	defer cleanup()
+
+	if n := len(store.Certificates()); n != 1 {
+		t.Fatalf("expected 1 root, have %d", n)
+	}
+	pool := store.Pool()
+
+	changed, err := store.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Fatal("refresh of unchanged roots reported a change")
+	}
+	if store.Pool() != pool {
+		t.Fatal("pool was rebuilt without a change")
+	}
+
+	copyFile(t, testBundle, source)
+	changed, err = store.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("refresh of new roots didn't report a change")
+	}
+	if n := len(store.Certificates()); n != 3 {
+		t.Fatalf("expected 3 roots, have %d", n)
+	}
+	if store.Pool() == pool {
+		t.Fatal("pool wasn't rebuilt after a change")
+	}
+}
+
+func TestRefreshKeepsRootsOnError(t *testing.T) {
+	store, source, cleanup := fileStore(t)
+	defer cleanup()
+
+	os.Remove(source)
+	if _, err := store.Refresh(); err == nil {
+		t.Fatal("expected refresh of a missing file to fail")
+	}
+	if n := len(store.Certificates()); n != 1 {
+		t.Fatalf("expected the 1 root to be kept, have %d", n)
+	}
+}
+
+func TestAutoRefresh(t *testing.T) {
+	store, source, cleanup := fileStore(t)
+	defer cleanup()
+
+	changes := make(chan time.Time)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		store.AutoRefresh(10*time.Millisecond, stop, changes, nil)
+		close(stopped)
+	}()
+
+	copyFile(t, testBundle, source)
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change was reported")
+	}
+	if n := len(store.Certificates()); n != 3 {
+		t.Fatalf("expected 3 roots, have %d", n)
+	}
+
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AutoRefresh did not stop")
+	}
+}
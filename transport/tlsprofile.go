@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+// tlsVersions maps version names to crypto/tls versions. "1.3" is added
+// by tlsprofile_tls13.go on toolchains that support it.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// versionTLS13 is tls.VersionTLS13, or zero if the toolchain doesn't
+// support TLS 1.3.
+var versionTLS13 uint16
+
+// tlsCipherSuites maps the names of the configurable cipher suites to
+// their IDs. Suites that crypto/tls considers insecure are left out;
+// the ChaCha20-Poly1305 suites are accepted with or without the hash in
+// their name.
+var tlsCipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":                  tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":                  tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":               tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":               tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":        tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":          tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+}
+
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P-256":  tls.CurveP256,
+	"P-384":  tls.CurveP384,
+	"P-521":  tls.CurveP521,
+}
+
+// tlsSettings holds a TLS profile resolved to crypto/tls values.
+type tlsSettings struct {
+	minVersion   uint16
+	maxVersion   uint16
+	cipherSuites []uint16
+	curves       []tls.CurveID
+	nextProtos   []string
+	noTickets    bool
+}
+
+// resolveTLSProfile turns a profile into the settings applied to TLS
+// configurations. A nil profile is the intermediate profile.
+func resolveTLSProfile(profile *core.TLSProfile) (*tlsSettings, error) {
+	settings := &tlsSettings{
+		minVersion:   tls.VersionTLS12,
+		cipherSuites: core.CipherSuites,
+		curves:       []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384},
+	}
+	if profile == nil {
+		return settings, nil
+	}
+
+	settings.nextProtos = profile.ALPN
+	settings.noTickets = profile.DisableSessionTickets
+
+	custom := profile.MinVersion != "" || profile.MaxVersion != "" ||
+		len(profile.CipherSuites) > 0 || len(profile.Curves) > 0
+
+	switch profile.Name {
+	case "", core.TLSProfileIntermediate:
+	case core.TLSProfileModern:
+		if versionTLS13 == 0 {
+			return nil, errors.New("transport: the modern TLS profile requires TLS 1.3 support (Go 1.12 or later)")
+		}
+		// TLS 1.3 cipher suites aren't configurable.
+		settings.minVersion = versionTLS13
+		settings.cipherSuites = nil
+		settings.curves = []tls.CurveID{tls.X25519, tls.CurveP256}
+	case core.TLSProfileCustom:
+		custom = false
+	default:
+		return nil, errors.New("transport: unknown TLS profile " + profile.Name)
+	}
+	if custom {
+		return nil, errors.New("transport: TLS versions, cipher suites and curves can only be set in a custom profile")
+	}
+
+	if profile.MinVersion != "" {
+		version, ok := tlsVersions[profile.MinVersion]
+		if !ok {
+			return nil, errors.New("transport: unknown TLS version " + profile.MinVersion)
+		}
+		settings.minVersion = version
+	}
+
+	if profile.MaxVersion != "" {
+		version, ok := tlsVersions[profile.MaxVersion]
+		if !ok {
+			return nil, errors.New("transport: unknown TLS version " + profile.MaxVersion)
+		}
+		if version < settings.minVersion {
+			return nil, errors.New("transport: the maximum TLS version is below the minimum")
+		}
+		settings.maxVersion = version
+	}
+
+	if len(profile.CipherSuites) > 0 {
+		settings.cipherSuites = nil
+		for _, name := range profile.CipherSuites {
+			id, ok := tlsCipherSuites[name]
+			if !ok {
+				return nil, errors.New("transport: unknown or insecure cipher suite " + name)
+			}
+			settings.cipherSuites = append(settings.cipherSuites, id)
+		}
+	}
+
+	if len(profile.Curves) > 0 {
+		settings.curves = nil
+		for _, name := range profile.Curves {
+			curve, ok := tlsCurves[name]
+			if !ok {
+				return nil, errors.New("transport: unknown curve " + name)
+			}
+			settings.curves = append(settings.curves, curve)
+		}
+	}
+
+	return settings, nil
+}
+
+// applyTLSProfile sets the versions, cipher suites, curves, protocols
+// and session ticket behaviour of the transport's TLS profile on
+// config.
+func (tr *Transport) applyTLSProfile(config *tls.Config) error {
+	settings, err := resolveTLSProfile(tr.TLSProfile)
+	if err != nil {
+		return err
+	}
+
+	config.MinVersion = settings.minVersion
+	config.MaxVersion = settings.maxVersion
+	config.CipherSuites = settings.cipherSuites
+	config.CurvePreferences = settings.curves
+	config.NextProtos = settings.nextProtos
+	config.SessionTicketsDisabled = settings.noTickets
+	return nil
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+func TestResolveTLSProfile(t *testing.T) {
+	settings, err := resolveTLSProfile(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.minVersion != tls.VersionTLS12 || len(settings.cipherSuites) != len(core.CipherSuites) {
+		t.Fatal("expected the default profile to match the intermediate suites and versions")
+	}
+
+	settings, err = resolveTLSProfile(&core.TLSProfile{Name: core.TLSProfileIntermediate, ALPN: []string{"h2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings.nextProtos) != 1 || settings.nextProtos[0] != "h2" {
+		t.Fatal("expected ALPN to apply to a named profile")
+	}
+
+	settings, err = resolveTLSProfile(&core.TLSProfile{
+		Name:                  core.TLSProfileCustom,
+		MinVersion:            "1.2",
+		MaxVersion:            "1.2",
+		CipherSuites:          []string{"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"},
+		Curves:                []string{"P-384"},
+		DisableSessionTickets: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.maxVersion != tls.VersionTLS12 ||
+		len(settings.cipherSuites) != 1 || settings.cipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305 ||
+		len(settings.curves) != 1 || settings.curves[0] != tls.CurveP384 ||
+		!settings.noTickets {
+		t.Fatalf("custom profile wasn't applied: %+v", settings)
+	}
+
+	invalid := []*core.TLSProfile{
+		{Name: "legacy"},
+		{Name: core.TLSProfileModern, MinVersion: "1.2"},
+		{Name: core.TLSProfileCustom, MinVersion: "1.4"},
+		{Name: core.TLSProfileCustom, MinVersion: "1.3", MaxVersion: "1.2"},
+		{Name: core.TLSProfileCustom, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{Name: core.TLSProfileCustom, Curves: []string{"P-224"}},
+	}
+	for _, profile := range invalid {
+		if _, err = resolveTLSProfile(profile); err == nil {
+			t.Fatalf("expected %+v to be rejected", *profile)
+		}
+	}
+}
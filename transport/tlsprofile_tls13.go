@@ -0,0 +1,10 @@
+// +build go1.12
+
+package transport
+
+import "crypto/tls"
+
+func init() {
+	versionTLS13 = tls.VersionTLS13
+	tlsVersions["1.3"] = tls.VersionTLS13
+}
@@ -0,0 +1,92 @@
+// +build go1.12
+
+package transport
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cloudflare/cfssl/transport/ca/localca"
+	"github.com/cloudflare/cfssl/transport/core"
+)
+
+func TestResolveModernTLSProfile(t *testing.T) {
+	settings, err := resolveTLSProfile(&core.TLSProfile{Name: core.TLSProfileModern})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.minVersion != tls.VersionTLS13 || settings.cipherSuites != nil {
+		t.Fatal("expected the modern profile to require TLS 1.3")
+	}
+
+	settings, err = resolveTLSProfile(&core.TLSProfile{Name: core.TLSProfileCustom, MinVersion: "1.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.minVersion != tls.VersionTLS13 {
+		t.Fatal("expected a custom profile to allow TLS 1.3")
+	}
+}
+
+func TestTLSProfileHandshake(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transport-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lca, err := localca.New(localca.ExampleRequest(), localca.ExampleSigningConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := &core.TLSProfile{Name: core.TLSProfileModern, ALPN: []string{"test/1"}}
+	server := localTransport(t, lca, dir, "server", nil)
+	server.TLSProfile = profile
+	l, err := Listen("127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("hello"))
+		conn.Close()
+	}()
+
+	client := localTransport(t, lca, dir, "client", nil)
+	client.TLSProfile = profile
+	conn, err := Dial(l.Addr().String(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if state.Version != tls.VersionTLS13 {
+		t.Fatalf("expected TLS 1.3, have %x", state.Version)
+	}
+	if state.NegotiatedProtocol != "test/1" {
+		t.Fatalf("expected ALPN to negotiate test/1, have %q", state.NegotiatedProtocol)
+	}
+
+	// A client limited to TLS 1.2 can't reach a modern server.
+	old := localTransport(t, lca, dir, "old", nil)
+	old.TLSProfile = &core.TLSProfile{Name: core.TLSProfileCustom, MaxVersion: "1.2"}
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+	if conn, err := Dial(l.Addr().String(), old); err == nil {
+		conn.Close()
+		t.Fatal("expected a TLS 1.2 client to be refused")
+	}
+}
@@ -0,0 +1,351 @@
+package ubiquity
+
+// Chain selection is a pipeline of stages, each filtering out all but the highest ranked chains. A stage
+// ranks chains by one or more named ranking functions, weighted against each other, so that selection
+// strategies can be configured and extended with rankers of our own.
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+var (
+	rankersLock sync.RWMutex
+	// rankers are the ranking functions that pipelines can use, by name.
+	rankers = map[string]RankingFunc{
+		"platform":          ComparePlatformUbiquity,
+		"sha2-homogeneity":  CompareSHA2Homogeneity,
+		"length":            CompareChainLength,
+		"hash-ubiquity":     CompareChainHashUbiquity,
+		"key-algo-ubiquity": CompareChainKeyAlgoUbiquity,
+		"expiry-ubiquity":   CompareExpiryUbiquity,
+		"expiry":            CompareChainExpiry,
+		"crypto-suite":      CompareChainCryptoSuite,
+		"hash-priority":     CompareChainHashPriority,
+		"key-algo-priority": CompareChainKeyAlgoPriority,
+	}
+
+	// parameterizedRankers build the ranking functions of rankers that take an argument, which
+	// pipelines name as "name=argument".
+	parameterizedRankers = map[string]parameterizedRanker{
+		"chain-through":    {build: chainThroughFile, configOnly: true},
+		"chain-size-under": {build: chainSizeUnder},
+	}
+
+	// resolvedRankers are the ranking functions ResolvePipeline built for configuration only
+	// parameterized rankers, by their "name=argument" spec.
+	resolvedRankers = map[string]RankingFunc{}
+)
+
+// A parameterizedRanker builds ranking functions from an argument. Configuration only rankers
+// read files, so they are built once by ResolvePipeline instead of whenever a pipeline names them.
+type parameterizedRanker struct {
+	build      func(arg string) (RankingFunc, error)
+	configOnly bool
+}
+
+// RegisterRanker makes a ranking function available to pipelines under name. Names are made of
+// lower case letters, digits and dashes, and can't be registered twice.
+func RegisterRanker(name string, f RankingFunc) error {
+	if name == "" || strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+		return fmt.Errorf("invalid ranker name %q", name)
+	}
+	if f == nil {
+		return fmt.Errorf("ranker %s has no ranking function", name)
+	}
+
+	rankersLock.Lock()
+	defer rankersLock.Unlock()
+	if _, ok := rankers[name]; ok {
+		return fmt.Errorf("ranker %s is already registered", name)
+	}
+	rankers[name] = f
+	return nil
+}
+
+// LookupRanker returns the ranking function registered under name, or resolved for it by
+// ResolvePipeline.
+func LookupRanker(name string) (RankingFunc, bool) {
+	rankersLock.RLock()
+	defer rankersLock.RUnlock()
+	f, ok := rankers[name]
+	if !ok {
+		f, ok = resolvedRankers[name]
+	}
+	return f, ok
+}
+
+// RankerNames returns the names of the registered rankers, sorted.
+func RankerNames() []string {
+	rankersLock.RLock()
+	defer rankersLock.RUnlock()
+	names := make([]string, 0, len(rankers))
+	for name := range rankers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A Ranker is a registered ranking function, by name, and its weight within a stage.
+type Ranker struct {
+	Name   string
+	Weight int
+}
+
+// rankingFunc returns the ranking function of a registered or resolved ranker, or of a
+// parameterized ranker and its argument, such as "chain-size-under=4096".
+func rankingFunc(name string) (RankingFunc, error) {
+	if f, ok := LookupRanker(name); ok {
+		return f, nil
+	}
+	if i := strings.Index(name, "="); i >= 0 {
+		if ranker, ok := parameterizedRankers[name[:i]]; ok {
+			if ranker.configOnly {
+				return nil, fmt.Errorf("ranker %q isn't configured", name)
+			}
+			f, err := ranker.build(name[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ranker %q: %v", name, err)
+			}
+			return f, nil
+		}
+	}
+
+	var parameterized []string
+	for name := range parameterizedRankers {
+		parameterized = append(parameterized, name+"=")
+	}
+	sort.Strings(parameterized)
+	return nil, fmt.Errorf("unknown ranker %q; registered rankers are %s, and %s take an argument",
+		name, strings.Join(RankerNames(), ", "), strings.Join(parameterized, " and "))
+}
+
+// resolveRanker builds the ranking function of a configuration only parameterized ranker, unless
+// it was already resolved. Other rankers are left to rankingFunc.
+func resolveRanker(name string) error {
+	i := strings.Index(name, "=")
+	if i < 0 || !parameterizedRankers[name[:i]].configOnly {
+		return nil
+	}
+	if _, ok := LookupRanker(name); ok {
+		return nil
+	}
+
+	f, err := parameterizedRankers[name[:i]].build(name[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid ranker %q: %v", name, err)
+	}
+	rankersLock.Lock()
+	defer rankersLock.Unlock()
+	resolvedRankers[name] = f
+	return nil
+}
+
+// A Stage ranks chains by the weighted sum of the ranks its rankers give them.
+type Stage []Ranker
+
+// RankingFunc returns the ranking function of the stage, or an error if any of its rankers is
+// unknown.
+func (s Stage) RankingFunc() (RankingFunc, error) {
+	funcs := make([]RankingFunc, len(s))
+	weights := make([]int, len(s))
+	for i, ranker := range s {
+		f, err := rankingFunc(ranker.Name)
+		if err != nil {
+			return nil, err
+		}
+		funcs[i], weights[i] = f, ranker.Weight
+	}
+
+	return func(chain1, chain2 []*x509.Certificate) int {
+		rank := 0
+		for i, f := range funcs {
+			switch r := f(chain1, chain2); {
+			case r > 0:
+				rank += weights[i]
+			case r < 0:
+				rank -= weights[i]
+			}
+		}
+		return rank
+	}, nil
+}
+
+// A Pipeline selects chains by filtering them through its stages in order, each keeping the chains it
+// ranks highest.
+type Pipeline []Stage
+
+// Filter returns the chains the pipeline selects.
+func (p Pipeline) Filter(chains [][]*x509.Certificate) ([][]*x509.Certificate, error) {
+	for _, stage := range p {
+		f, err := stage.RankingFunc()
+		if err != nil {
+			return nil, err
+		}
+		chains = Filter(chains, f)
+	}
+	return chains, nil
+}
+
+// String returns the pipeline in the form ParsePipeline accepts.
+func (p Pipeline) String() string {
+	stages := make([]string, len(p))
+	for i, stage := range p {
+		rankers := make([]string, len(stage))
+		for j, ranker := range stage {
+			rankers[j] = ranker.Name
+			if ranker.Weight != 1 {
+				rankers[j] += ":" + strconv.Itoa(ranker.Weight)
+			}
+		}
+		stages[i] = strings.Join(rankers, "+")
+	}
+	return strings.Join(stages, ",")
+}
+
+// ParsePipeline parses a pipeline of comma separated stages. Each stage is one or more registered
+// rankers joined by "+", each optionally followed by ":" and a positive weight, which defaults to 1.
+// For example, "platform,length:2+expiry,crypto-suite" first keeps the chains trusted by the most
+// platforms, then ranks those by length with twice the weight of expiry, and breaks the remaining ties
+// by crypto suite.
+//
+// Rankers can also be "chain-size-under=bytes" (see ChainSizeUnder), and "chain-through=file" once
+// ResolvePipeline resolved it. Their arguments can't contain ",", "+" or ":".
+func ParsePipeline(spec string) (Pipeline, error) {
+	return parsePipeline(spec, false)
+}
+
+// ResolvePipeline parses spec as ParsePipeline does, but first resolves the "chain-through=file"
+// rankers it names, which rank chains through the PEM certificate in file above the others (see
+// ChainThrough), so that later pipelines can name them too. As it reads files, it is meant for
+// configuration, not for pipelines of requests.
+func ResolvePipeline(spec string) (Pipeline, error) {
+	return parsePipeline(spec, true)
+}
+
+func parsePipeline(spec string, resolve bool) (Pipeline, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, errors.New("empty ranking pipeline")
+	}
+
+	var p Pipeline
+	for _, stageSpec := range strings.Split(spec, ",") {
+		var stage Stage
+		for _, rankerSpec := range strings.Split(stageSpec, "+") {
+			ranker := Ranker{Name: strings.TrimSpace(rankerSpec), Weight: 1}
+			if i := strings.LastIndex(ranker.Name, ":"); i >= 0 {
+				weight, err := strconv.Atoi(ranker.Name[i+1:])
+				if err != nil || weight <= 0 {
+					return nil, fmt.Errorf("invalid weight in %q", rankerSpec)
+				}
+				ranker.Name, ranker.Weight = ranker.Name[:i], weight
+			}
+			if resolve {
+				if err := resolveRanker(ranker.Name); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := rankingFunc(ranker.Name); err != nil {
+				return nil, err
+			}
+			stage = append(stage, ranker)
+		}
+		p = append(p, stage)
+	}
+	return p, nil
+}
+
+// mustParsePipeline parses the pipeline spec of a built in strategy.
+func mustParsePipeline(spec string) Pipeline {
+	p, err := ParsePipeline(spec)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+var (
+	// OptimalPipeline selects the shortest chains, with newest intermediates and most advanced crypto
+	// suite being the tie breakers.
+	OptimalPipeline = mustParsePipeline("length,expiry,crypto-suite")
+
+	// UbiquitousPipeline selects the chains with highest platform coverage, preferring chains of SHA-2
+	// intermediates for SHA-2 leaves, then short chains with ubiquitous crypto and long lasting
+	// intermediates, and breaks ties with OptimalPipeline.
+	UbiquitousPipeline = mustParsePipeline("platform,sha2-homogeneity,length,hash-ubiquity,key-algo-ubiquity,expiry-ubiquity," +
+		OptimalPipeline.String())
+)
+
+// ChainThrough returns a ranking function that ranks chains including cert, such as a cross-signed
+// root or intermediate, above chains that don't.
+func ChainThrough(cert *x509.Certificate) RankingFunc {
+	through := func(chain []*x509.Certificate) int {
+		for _, c := range chain {
+			if bytes.Equal(c.Raw, cert.Raw) {
+				return 1
+			}
+		}
+		return 0
+	}
+	return func(chain1, chain2 []*x509.Certificate) int {
+		return through(chain1) - through(chain2)
+	}
+}
+
+// ChainSizeUnder returns a ranking function that ranks chains whose certificates, excluding the root,
+// total fewer than size bytes when DER encoded above chains that don't, and shorter of those chains
+// higher. The root isn't counted since it isn't sent in the TLS handshake.
+func ChainSizeUnder(size int) RankingFunc {
+	chainSize := func(chain []*x509.Certificate) int {
+		total := 0
+		for _, c := range chain[:len(chain)-1] {
+			total += len(c.Raw)
+		}
+		return total
+	}
+	return func(chain1, chain2 []*x509.Certificate) int {
+		size1, size2 := chainSize(chain1), chainSize(chain2)
+		switch {
+		case size1 < size && size2 < size:
+			return size2 - size1
+		case size1 < size:
+			return 1
+		case size2 < size:
+			return -1
+		default:
+			return 0
+		}
+	}
+}
+
+// chainThroughFile returns ChainThrough of the PEM certificate in file.
+func chainThroughFile(file string) (RankingFunc, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := helpers.ParseCertificatePEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return ChainThrough(cert), nil
+}
+
+// chainSizeUnder returns ChainSizeUnder of a positive number of bytes.
+func chainSizeUnder(size string) (RankingFunc, error) {
+	n, err := strconv.Atoi(size)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid size %q", size)
+	}
+	return ChainSizeUnder(n), nil
+}
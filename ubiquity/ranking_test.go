@@ -0,0 +1,158 @@
+package ubiquity
+
+import (
+	"crypto/x509"
+	"reflect"
+	"testing"
+)
+
+func TestParsePipeline(t *testing.T) {
+	p, err := ParsePipeline("platform, length:2+expiry,crypto-suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Pipeline{
+		{{"platform", 1}},
+		{{"length", 2}, {"expiry", 1}},
+		{{"crypto-suite", 1}},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("expected %v, have %v", expected, p)
+	}
+	if p.String() != "platform,length:2+expiry,crypto-suite" {
+		t.Fatalf("unexpected pipeline %s", p)
+	}
+
+	for _, spec := range []string{"", "shortest", "length:0", "length:x", "length,", "length+"} {
+		if _, err = ParsePipeline(spec); err == nil {
+			t.Fatalf("%q: expected an error", spec)
+		}
+	}
+
+	if UbiquitousPipeline.String() != "platform,sha2-homogeneity,length,hash-ubiquity,key-algo-ubiquity,expiry-ubiquity,length,expiry,crypto-suite" {
+		t.Fatalf("unexpected ubiquitous pipeline %s", UbiquitousPipeline)
+	}
+}
+
+func TestRegisterRanker(t *testing.T) {
+	if err := RegisterRanker("test-prefer-rsa4096", ChainThrough(rsa4096Cert)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := LookupRanker("test-prefer-rsa4096"); !ok {
+		t.Fatal("expected the registered ranker")
+	}
+	if _, err := ParsePipeline("test-prefer-rsa4096,length"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, f := range map[string]RankingFunc{
+		"test-prefer-rsa4096": CompareChainLength,
+		"length":              CompareChainLength,
+		"Bad Name":            CompareChainLength,
+		"":                    CompareChainLength,
+		"no-func":             nil,
+	} {
+		if err := RegisterRanker(name, f); err == nil {
+			t.Fatalf("%q: expected an error", name)
+		}
+	}
+}
+
+func TestPipelineFilter(t *testing.T) {
+	short := []*x509.Certificate{rsa2048Cert, rsa4096Cert}
+	long := []*x509.Certificate{ecdsa256Cert, ecdsa384Cert, ecdsa521Cert}
+	chains := [][]*x509.Certificate{long, short}
+
+	// Weights decide between rankers that disagree.
+	p := Pipeline{{{"length", 1}, {"crypto-suite", 2}}}
+	if filtered, err := p.Filter(chains); err != nil || len(filtered) != 1 || len(filtered[0]) != 3 {
+		t.Fatalf("expected the long chain, have %v", filtered)
+	}
+	p = Pipeline{{{"length", 2}, {"crypto-suite", 1}}}
+	if filtered, err := p.Filter(chains); err != nil || len(filtered) != 1 || len(filtered[0]) != 2 {
+		t.Fatalf("expected the short chain, have %v", filtered)
+	}
+	// Equal weights tie, and the next stage decides.
+	p = Pipeline{{{"length", 1}, {"crypto-suite", 1}}}
+	if filtered, err := p.Filter(chains); err != nil || len(filtered) != 2 {
+		t.Fatalf("expected a tie, have %v", filtered)
+	}
+	p = append(p, Stage{{"length", 1}})
+	if filtered, err := p.Filter(chains); err != nil || len(filtered) != 1 || len(filtered[0]) != 2 {
+		t.Fatalf("expected the short chain, have %v", filtered)
+	}
+
+	// Unknown rankers aren't skipped.
+	p = append(p, Stage{{"unregistered", 5}})
+	if _, err := p.Filter(chains); err == nil {
+		t.Fatal("expected an error for an unregistered ranker")
+	}
+
+	// The built in strategies are unchanged.
+	if filtered, err := OptimalPipeline.Filter(chains); err != nil || !reflect.DeepEqual(filtered, Filter(chains, CompareChainLength)) {
+		t.Fatal("unexpected optimal chains")
+	}
+}
+
+func TestCustomRankers(t *testing.T) {
+	short := []*x509.Certificate{rsa2048Cert, rsa4096Cert}
+	long := []*x509.Certificate{ecdsa256Cert, ecdsa384Cert, ecdsa521Cert}
+
+	through := ChainThrough(ecdsa521Cert)
+	if through(long, short) <= 0 || through(short, long) >= 0 || through(short, short) != 0 {
+		t.Fatal("expected chains through the certificate to rank higher")
+	}
+
+	// Roots aren't counted: the short chain is a single certificate.
+	shortSize, longSize := len(rsa2048Cert.Raw), len(ecdsa256Cert.Raw)+len(ecdsa384Cert.Raw)
+	if under := ChainSizeUnder(shortSize + longSize); under(short, long) != longSize-shortSize {
+		t.Fatal("expected the smaller chain to rank higher")
+	}
+	if under := ChainSizeUnder(shortSize + 1); under(short, long) <= 0 || under(long, short) >= 0 {
+		t.Fatal("expected the chain under the size to rank higher")
+	}
+	if under := ChainSizeUnder(1); under(short, long) != 0 {
+		t.Fatal("expected chains over the size to tie")
+	}
+}
+
+func TestParameterizedRankers(t *testing.T) {
+	short := []*x509.Certificate{rsa2048Cert, rsa4096Cert}
+	long := []*x509.Certificate{ecdsa256Cert, ecdsa384Cert, ecdsa521Cert}
+	chains := [][]*x509.Certificate{short, long}
+
+	spec := "chain-through=testdata/ecdsa521sha2.pem:2+length,chain-size-under=4096"
+	if _, err := ParsePipeline(spec); err == nil {
+		t.Fatal("expected an error for an unresolved chain-through ranker")
+	}
+	p, err := ResolvePipeline(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Pipeline{
+		{{"chain-through=testdata/ecdsa521sha2.pem", 2}, {"length", 1}},
+		{{"chain-size-under=4096", 1}},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("expected %v, have %v", expected, p)
+	}
+	if filtered, err := p.Filter(chains); err != nil || len(filtered) != 1 || len(filtered[0]) != 3 {
+		t.Fatalf("expected the chain through ecdsa521, have %v %v", filtered, err)
+	}
+	// Once resolved, pipelines can name it without reading the file again.
+	if p, err = ParsePipeline(spec); err != nil || !reflect.DeepEqual(p, expected) {
+		t.Fatalf("expected %v, have %v %v", expected, p, err)
+	}
+
+	for _, spec := range []string{
+		"chain-through=testdata/missing.pem",
+		"chain-through=",
+		"chain-size-under=0",
+		"chain-size-under=big",
+		"length=1",
+	} {
+		if _, err = ResolvePipeline(spec); err == nil {
+			t.Fatalf("%q: expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package ubiquity
+
+// This is for building platform definitions from the trust stores of the devices we serve, and checking
+// platform metadata files before bundling relies on them.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cloudflare/cfssl/helpers"
+)
+
+// LoadRoots reads root certificates from path, which is either a PEM bundle, a Mozilla
+// certdata.txt file, or a directory of PEM or DER encoded certificates.
+func LoadRoots(path string) ([]*x509.Certificate, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadRootsDir(path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("CKA_CLASS")) {
+		return ParseCertdata(data)
+	}
+	return parseRoots(data)
+}
+
+// parseRoots parses the certificates of a PEM bundle or a single DER certificate. PEM blocks that
+// don't hold a parseable certificate are skipped, as ParseAndLoad does.
+func parseRoots(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{cert}, nil
+	}
+
+	var roots []*x509.Certificate
+	for len(data) > 0 {
+		certs, rest, err := helpers.ParseOneCertificateFromPEM(data)
+		if err == nil {
+			roots = append(roots, certs...)
+		}
+		if len(rest) >= len(data) {
+			break
+		}
+		data = rest
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return roots, nil
+}
+
+// loadRootsDir reads the certificates of each file in dir, skipping files that hold none.
+func loadRootsDir(dir string) ([]*x509.Certificate, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*x509.Certificate
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		certs, err := parseRoots(data)
+		if err != nil {
+			continue
+		}
+		roots = append(roots, certs...)
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", dir)
+	}
+	return roots, nil
+}
+
+// certdataObject is the attributes of an object in a certdata.txt file.
+type certdataObject map[string]string
+
+// issuerSerial identifies the certificate a trust object applies to.
+func (o certdataObject) issuerSerial() string {
+	return o["CKA_ISSUER"] + "/" + o["CKA_SERIAL_NUMBER"]
+}
+
+// unescapeOctal decodes the lines of a MULTILINE_OCTAL value, such as "\060\202".
+func unescapeOctal(lines []string) (string, error) {
+	var value []byte
+	for _, line := range lines {
+		for _, octal := range strings.Split(line, `\`)[1:] {
+			b, err := strconv.ParseUint(octal, 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid octal value %q", octal)
+			}
+			value = append(value, byte(b))
+		}
+	}
+	return string(value), nil
+}
+
+// parseCertdataObjects returns the objects of a certdata.txt file.
+func parseCertdataObjects(data []byte) ([]certdataObject, error) {
+	var objects []certdataObject
+	var object certdataObject
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if !strings.HasPrefix(fields[0], "CKA_") || len(fields) < 2 {
+			continue
+		}
+		if fields[0] == "CKA_CLASS" {
+			object = certdataObject{}
+			objects = append(objects, object)
+		}
+		if object == nil {
+			return nil, fmt.Errorf("line %d: attribute outside of an object", lineNo)
+		}
+
+		if fields[1] != "MULTILINE_OCTAL" {
+			object[fields[0]] = strings.Join(fields[2:], " ")
+			continue
+		}
+		var lines []string
+		for scanner.Scan() {
+			lineNo++
+			if value := strings.TrimSpace(scanner.Text()); value != "END" {
+				lines = append(lines, value)
+			} else {
+				break
+			}
+		}
+		value, err := unescapeOctal(lines)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		object[fields[0]] = value
+	}
+	return objects, scanner.Err()
+}
+
+// ParseCertdata returns the certificates of a Mozilla certdata.txt file that are trusted to issue
+// server certificates.
+func ParseCertdata(data []byte) ([]*x509.Certificate, error) {
+	objects, err := parseCertdataObjects(data)
+	if err != nil {
+		return nil, err
+	}
+
+	trusted := make(map[string]bool)
+	for _, object := range objects {
+		if object["CKA_CLASS"] == "CKO_NSS_TRUST" &&
+			object["CKA_TRUST_SERVER_AUTH"] == "CKT_NSS_TRUSTED_DELEGATOR" {
+			trusted[object.issuerSerial()] = true
+		}
+	}
+
+	var roots []*x509.Certificate
+	for _, object := range objects {
+		if object["CKA_CLASS"] != "CKO_CERTIFICATE" || !trusted[object.issuerSerial()] {
+			continue
+		}
+		cert, err := x509.ParseCertificate([]byte(object["CKA_VALUE"]))
+		if err != nil {
+			return nil, fmt.Errorf("certificate %s: %v", object["CKA_LABEL"], err)
+		}
+		roots = append(roots, cert)
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("no trusted certificates found")
+	}
+	return roots, nil
+}
+
+// nonAlphanumeric matches the characters of a platform name left out of its key store file name.
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// readMetadata returns the platform entries of a metadata file, undecoded so that fields Platform
+// doesn't know about are kept, or no entries if the file doesn't exist.
+func readMetadata(filename string) ([]json.RawMessage, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []json.RawMessage
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("platform metadata failed to parse: %v", err)
+	}
+	return entries, nil
+}
+
+// ImportPlatform writes roots to the key store file of platform and adds the platform to the
+// metadata file, replacing any platform of the same name. If the platform has no key store file,
+// the replaced platform's is used, or one named after the platform next to the metadata file.
+// Other platforms are kept as they are.
+func ImportPlatform(metadata string, platform Platform, roots []*x509.Certificate) (*Platform, error) {
+	if platform.Name == "" {
+		return nil, errors.New("platform has no name")
+	}
+	if platform.hashUbiquity() == UnknownHashUbiquity {
+		return nil, fmt.Errorf("unknown hash algorithm %q", platform.HashAlgo)
+	}
+	if platform.keyAlgoUbiquity() == UnknownAlgoUbiquity {
+		return nil, fmt.Errorf("unknown key algorithm %q", platform.KeyAlgo)
+	}
+
+	entries, err := readMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	replaced := -1
+	for i, entry := range entries {
+		var existing Platform
+		if err = json.Unmarshal(entry, &existing); err != nil {
+			return nil, fmt.Errorf("platform metadata failed to parse: %v", err)
+		}
+		if existing.Name == platform.Name {
+			replaced = i
+			if platform.KeyStoreFile == "" {
+				platform.KeyStoreFile = existing.KeyStoreFile
+			}
+		}
+	}
+	if platform.KeyStoreFile == "" {
+		platform.KeyStoreFile = strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(platform.Name), "-"), "-") + ".pem"
+	}
+
+	var keyStore bytes.Buffer
+	for _, root := range roots {
+		pem.Encode(&keyStore, &pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+	}
+	if err = ioutil.WriteFile(filepath.Join(filepath.Dir(metadata), platform.KeyStoreFile), keyStore.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+
+	entry, err := json.Marshal(platform)
+	if err != nil {
+		return nil, err
+	}
+	if replaced >= 0 {
+		entries[replaced] = entry
+	} else {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(metadata, append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	return &platform, nil
+}
+
+// ValidatePlatforms checks the platforms of a metadata file, returning the problems found: missing
+// or duplicate names, negative weights, unknown algorithms, and key stores that can't be read or
+// hold no certificates. An error is returned if the file can't be read or parsed.
+func ValidatePlatforms(filename string) ([]string, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	entries, err := readMetadata(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []string{}
+	names := make(map[string]bool)
+	for i, entry := range entries {
+		var platform Platform
+		if err = json.Unmarshal(entry, &platform); err != nil {
+			problems = append(problems, fmt.Sprintf("platform %d: %v", i, err))
+			continue
+		}
+		name := platform.Name
+		switch {
+		case name == "":
+			name = fmt.Sprintf("platform %d", i)
+			problems = append(problems, name+": no name")
+		case names[name]:
+			problems = append(problems, name+": duplicate name")
+		}
+		names[platform.Name] = true
+
+		if platform.Weight < 0 {
+			problems = append(problems, fmt.Sprintf("%s: negative weight %d", name, platform.Weight))
+		}
+		if platform.hashUbiquity() == UnknownHashUbiquity {
+			problems = append(problems, fmt.Sprintf("%s: unknown hash algorithm %q", name, platform.HashAlgo))
+		}
+		if platform.keyAlgoUbiquity() == UnknownAlgoUbiquity {
+			problems = append(problems, fmt.Sprintf("%s: unknown key algorithm %q", name, platform.KeyAlgo))
+		}
+		if platform.KeyStoreFile == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), platform.KeyStoreFile))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		} else if _, err = parseRoots(data); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: key store %s: %v", name, platform.KeyStoreFile, err))
+		}
+	}
+	return problems, nil
+}
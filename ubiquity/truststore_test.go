@@ -0,0 +1,216 @@
+package ubiquity
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// octal encodes data as a certdata.txt MULTILINE_OCTAL value.
+func octal(data []byte) string {
+	var buf bytes.Buffer
+	for i, b := range data {
+		fmt.Fprintf(&buf, "\\%03o", b)
+		if i%16 == 15 {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String() + "\nEND\n"
+}
+
+// certdata returns a certdata.txt file holding certs, each with the server auth trust given.
+func certdata(certs []*x509.Certificate, trust []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Mozilla certdata\nBEGINDATA\nCKA_CLASS CK_OBJECT_CLASS CKO_NSS_BUILTIN_ROOT_LIST\n\n")
+	for i, cert := range certs {
+		fmt.Fprintf(&buf, "# Certificate %q\nCKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE\n", cert.Subject.CommonName)
+		fmt.Fprintf(&buf, "CKA_LABEL UTF8 %q\n", cert.Subject.CommonName)
+		fmt.Fprintf(&buf, "CKA_ISSUER MULTILINE_OCTAL\n%s", octal(cert.RawIssuer))
+		fmt.Fprintf(&buf, "CKA_SERIAL_NUMBER MULTILINE_OCTAL\n%s", octal(cert.SerialNumber.Bytes()))
+		fmt.Fprintf(&buf, "CKA_VALUE MULTILINE_OCTAL\n%s\n", octal(cert.Raw))
+
+		fmt.Fprintf(&buf, "# Trust for %q\nCKA_CLASS CK_OBJECT_CLASS CKO_NSS_TRUST\n", cert.Subject.CommonName)
+		fmt.Fprintf(&buf, "CKA_ISSUER MULTILINE_OCTAL\n%s", octal(cert.RawIssuer))
+		fmt.Fprintf(&buf, "CKA_SERIAL_NUMBER MULTILINE_OCTAL\n%s", octal(cert.SerialNumber.Bytes()))
+		fmt.Fprintf(&buf, "CKA_TRUST_SERVER_AUTH CK_TRUST %s\n\n", trust[i])
+	}
+	return buf.Bytes()
+}
+
+func sameCerts(a, b []*x509.Certificate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLoadRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ubiquity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certs := []*x509.Certificate{rsa2048Cert, ecdsa256Cert, ecdsa384Cert}
+
+	data := certdata(certs, []string{"CKT_NSS_TRUSTED_DELEGATOR", "CKT_NSS_MUST_VERIFY_TRUST", "CKT_NSS_TRUSTED_DELEGATOR"})
+	if err := ioutil.WriteFile(filepath.Join(dir, "certdata.txt"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	roots, err := LoadRoots(filepath.Join(dir, "certdata.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameCerts(roots, []*x509.Certificate{rsa2048Cert, ecdsa384Cert}) {
+		t.Fatalf("unexpected certdata roots %v", roots)
+	}
+
+	roots, err = LoadRoots(rsa2048)
+	if err != nil || !sameCerts(roots, []*x509.Certificate{rsa2048Cert}) {
+		t.Fatalf("unexpected PEM roots %v %v", roots, err)
+	}
+
+	// A directory of PEM and DER certificates, and other files.
+	rootsDir := filepath.Join(dir, "roots")
+	if err = os.Mkdir(rootsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	pemData, _ := ioutil.ReadFile(ecdsa256)
+	for name, data := range map[string][]byte{
+		"a.pem":     pemData,
+		"b.der":     rsa2048Cert.Raw,
+		"README.md": []byte("Device roots"),
+	} {
+		if err = ioutil.WriteFile(filepath.Join(rootsDir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	roots, err = LoadRoots(rootsDir)
+	if err != nil || !sameCerts(roots, []*x509.Certificate{ecdsa256Cert, rsa2048Cert}) {
+		t.Fatalf("unexpected directory roots %v %v", roots, err)
+	}
+
+	if _, err = LoadRoots(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+	if _, err = ParseCertdata([]byte("CKA_CLASS CK_OBJECT_CLASS CKO_CERTIFICATE\nCKA_VALUE MULTILINE_OCTAL\n\\999\nEND\n")); err == nil {
+		t.Fatal("expected an error for invalid octal")
+	}
+}
+
+func TestImportPlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ubiquity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := filepath.Join(dir, "platforms.json")
+	data, _ := ioutil.ReadFile(caMetadata)
+	if err := ioutil.WriteFile(metadata, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pineapple, _ := ioutil.ReadFile("testdata/pineapple.pem")
+	if err := ioutil.WriteFile(filepath.Join(dir, "pineapple.pem"), pineapple, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	platform, err := ImportPlatform(metadata, Platform{Name: "Fleet Devices 2.0", Weight: 5, HashAlgo: "SHA2", KeyAlgo: "RSA"},
+		[]*x509.Certificate{rsa2048Cert, rsa4096Cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if platform.KeyStoreFile != "fleet-devices-2-0.pem" {
+		t.Fatalf("unexpected key store %s", platform.KeyStoreFile)
+	}
+	// Replacing a platform keeps its key store.
+	if platform, err = ImportPlatform(metadata, Platform{Name: "Pineapple", Weight: 2, HashAlgo: "SHA2", KeyAlgo: "ECDSA256"},
+		[]*x509.Certificate{ecdsa256Cert}); err != nil || platform.KeyStoreFile != "pineapple.pem" {
+		t.Fatalf("unexpected platform %+v %v", platform, err)
+	}
+	if _, err = ImportPlatform(metadata, Platform{Name: "Unknown", HashAlgo: "MD5", KeyAlgo: "RSA"}, nil); err == nil {
+		t.Fatal("expected an error for an unknown hash algorithm")
+	}
+
+	Platforms = nil
+	defer func() { Platforms = nil }()
+	if err = LoadPlatforms(metadata); err != nil {
+		t.Fatal(err)
+	}
+	if len(Platforms) != 3 || Platforms[1].Name != "Pineapple" || Platforms[2].Name != "Fleet Devices 2.0" {
+		t.Fatalf("unexpected platforms %v", Platforms)
+	}
+	if !Platforms[2].Trust(rsa4096Cert) || Platforms[2].Trust(ecdsa256Cert) || Platforms[2].Weight != 5 {
+		t.Fatalf("unexpected imported platform %+v", Platforms[2])
+	}
+	if !Platforms[1].Trust(ecdsa256Cert) || len(Platforms[1].KeyStore) != 1 || Platforms[1].KeyAlgo != "ECDSA256" {
+		t.Fatalf("unexpected replaced platform %+v", Platforms[1])
+	}
+
+	if problems, err := ValidatePlatforms(metadata); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected problems %v %v", problems, err)
+	}
+}
+
+func TestValidatePlatforms(t *testing.T) {
+	if problems, err := ValidatePlatforms(caMetadata); err != nil || len(problems) != 0 {
+		t.Fatalf("unexpected problems %v %v", problems, err)
+	}
+
+	dir, err := ioutil.TempDir("", "ubiquity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	metadata := filepath.Join(dir, "platforms.json")
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty.pem"), []byte("no certificates here\n-----BEGIN"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(metadata, []byte(`[
+	{"name": "A", "weight": 1, "hash_algo": "SHA2", "key_algo": "RSA"},
+	{"name": "A", "weight": -1, "hash_algo": "SHA3", "key_algo": "DSA"},
+	{"weight": 1, "hash_algo": "SHA1", "key_algo": "RSA", "keystore": "missing.pem"},
+	{"name": "B", "weight": 1, "hash_algo": "SHA1", "key_algo": "RSA", "keystore": "empty.pem"}
+]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := ValidatePlatforms(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"A: duplicate name",
+		"A: negative weight -1",
+		`A: unknown hash algorithm "SHA3"`,
+		`A: unknown key algorithm "DSA"`,
+		"platform 2: no name",
+		"platform 2: open",
+		"B: key store empty.pem: no certificates found",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems, have %q", len(expected), problems)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(problems[i], expected[i]) {
+			t.Fatalf("expected %q, have %q", expected[i], problems[i])
+		}
+	}
+
+	if err = ioutil.WriteFile(metadata, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ValidatePlatforms(metadata); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+	if _, err = ValidatePlatforms(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
@@ -37,14 +37,14 @@ func (s CertSet) Add(cert *x509.Certificate) {
 
 // A Platform contains ubiquity information on supported crypto algorithms and root certificate store name.
 type Platform struct {
-	Name            string `json:"name"`
-	Weight          int    `json:"weight"`
-	HashAlgo        string `json:"hash_algo"`
-	KeyAlgo         string `json:"key_algo"`
-	KeyStoreFile    string `json:"keystore"`
-	KeyStore        CertSet
-	HashUbiquity    HashUbiquity
-	KeyAlgoUbiquity KeyAlgoUbiquity
+	Name            string          `json:"name"`
+	Weight          int             `json:"weight"`
+	HashAlgo        string          `json:"hash_algo"`
+	KeyAlgo         string          `json:"key_algo"`
+	KeyStoreFile    string          `json:"keystore"`
+	KeyStore        CertSet         `json:"-"`
+	HashUbiquity    HashUbiquity    `json:"-"`
+	KeyAlgoUbiquity KeyAlgoUbiquity `json:"-"`
 }
 
 // Trust returns whether the platform has the root cert in the trusted store.